@@ -10,6 +10,10 @@ import (
 	"github.com/IPampurin/UrlShortener/pkg/cache"
 	"github.com/IPampurin/UrlShortener/pkg/configuration"
 	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/IPampurin/UrlShortener/pkg/geoip"
+	"github.com/IPampurin/UrlShortener/pkg/ingest"
+	"github.com/IPampurin/UrlShortener/pkg/retention"
+	"github.com/IPampurin/UrlShortener/pkg/rollup"
 	"github.com/IPampurin/UrlShortener/pkg/server"
 	"github.com/IPampurin/UrlShortener/pkg/service"
 	"github.com/wb-go/wbf/logger"
@@ -42,25 +46,68 @@ func main() {
 	}
 	defer func() { _ = appLogger.(*logger.ZapAdapter) }()
 
-	// получаем экземпляр хранилища
-	storage, err := db.InitDB(ctx, &cfg.DB, appLogger)
+	// команда migrate управляет схемой БД и завершается, не запуская сервис
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err = runMigrate(ctx, os.Args[2:], &cfg.DB, appLogger); err != nil {
+			appLogger.Error("ошибка миграций", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// без годного ключа администратора с включённой аутентификацией сервис не запускается
+	if err = cfg.Auth.Validate(); err != nil {
+		appLogger.Error("ошибка конфигурации аутентификации", "error", err)
+		os.Exit(1)
+	}
+
+	// получаем экземпляр хранилища (PostgreSQL, SQLite или память - DB_BACKEND)
+	storage, err := initStorage(ctx, cfg.DB.Backend, &cfg.DB, appLogger)
 	if err != nil {
 		appLogger.Error("ошибка подключения к БД", "error", err)
 		return
 	}
-	defer func() { _ = db.CloseDB(storage) }()
+	defer storage.Close()
 
-	// получаем экземпляр кэша
-	cache, err := cache.InitCache(ctx, storage, &cfg.Redis, appLogger)
+	// получаем экземпляр кэша (без Redis сервис работает в деградированном режиме и подключится позже)
+	cache := cache.InitCache(ctx, storage, &cfg.Redis, appLogger)
+
+	// открываем GeoIP базы (необязательны)
+	geo := geoip.InitGeoIP(ctx, &cfg.GeoIP, appLogger)
+
+	// запускаем конвейер записи переходов
+	clicks, err := ingest.InitIngest(ctx, storage, cache, geo, &cfg.Ingest, appLogger)
 	if err != nil {
-		appLogger.Warn("кэш не работает", "error", err)
+		appLogger.Error("ошибка запуска конвейера записи переходов", "error", err)
+		return
+	}
+
+	// дневные сводки и секции analytics есть только в PostgreSQL
+	if pg, ok := storage.(*db.DataBase); ok {
+		// запускаем сворачивание аналитики в дневные сводки
+		rollup.InitRollup(ctx, pg, &cfg.Rollup, appLogger)
+
+		// запускаем создание будущих секций analytics и удаление устаревших
+		retention.InitRetention(ctx, pg, &cfg.Retention, appLogger)
+	} else {
+		appLogger.Info("сводки и хранение секций отключены: хранилище не PostgreSQL", "backend", cfg.DB.Backend)
 	}
 
 	// получаем экземпляр слоя бизнес-логики
-	service := service.InitService(ctx, storage, cache)
+	service, err := service.InitService(ctx, storage, cache, clicks, &cfg.Generator, &cfg.Bots)
+	if err != nil {
+		appLogger.Error("ошибка инициализации сервиса", "error", err)
+		return
+	}
+
+	// регистрируем ключ администратора из конфигурации
+	if err = service.BootstrapAdmin(ctx, appLogger, cfg.Auth.AdminKey); err != nil {
+		appLogger.Error("ошибка регистрации ключа администратора", "error", err)
+		return
+	}
 
 	// запускаем сервер
-	err = server.Run(ctx, &cfg.Server, service, appLogger)
+	err = server.Run(ctx, &cfg.Server, &cfg.Auth, service, appLogger)
 	if err != nil {
 		appLogger.Error("Ошибка сервера", "error", err)
 		cancel()
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/configuration"
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/wb-go/wbf/logger"
+)
+
+// migrateUsage - подсказка по команде migrate
+const migrateUsage = `использование:
+  UrlShortener migrate up          применить все недостающие миграции
+  UrlShortener migrate down [N]    откатить N последних миграций (по умолчанию 1)
+  UrlShortener migrate status      показать состояние миграций`
+
+// runMigrate выполняет команду migrate и не запускает сервис
+func runMigrate(ctx context.Context, args []string, cfgDb *configuration.ConfDB, log logger.Logger) error {
+
+	if len(args) == 0 {
+		return fmt.Errorf("не указано действие\n%s", migrateUsage)
+	}
+
+	steps := 1
+	switch args[0] {
+	case "up", "status":
+		if len(args) > 1 {
+			return fmt.Errorf("лишние аргументы\n%s", migrateUsage)
+		}
+	case "down":
+		if len(args) > 2 {
+			return fmt.Errorf("лишние аргументы\n%s", migrateUsage)
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("количество миграций для отката должно быть положительным числом\n%s", migrateUsage)
+			}
+			steps = n
+		}
+	default:
+		return fmt.Errorf("неизвестное действие %q\n%s", args[0], migrateUsage)
+	}
+
+	storage, err := db.ConnectDB(ctx, cfgDb, log)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.CloseDB(storage) }()
+
+	switch args[0] {
+	case "up":
+		applied, err := storage.Migration(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("применено миграций: %d %v\n", len(applied), applied)
+
+	case "down":
+		reverted, err := storage.MigrateDown(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("откачено миграций: %d %v\n", len(reverted), reverted)
+
+	case "status":
+		statuses, err := storage.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		printMigrationStatus(statuses)
+	}
+
+	return nil
+}
+
+// printMigrationStatus выводит таблицу миграций
+func printMigrationStatus(statuses []db.MigrationStatus) {
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer func() { _ = w.Flush() }()
+
+	_, _ = fmt.Fprintln(w, "НОМЕР\tНАЗВАНИЕ\tПРИМЕНЕНА")
+	for _, s := range statuses {
+		applied := "нет"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Local().Format(time.DateTime)
+		}
+		_, _ = fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+}
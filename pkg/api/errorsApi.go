@@ -0,0 +1,133 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/IPampurin/UrlShortener/pkg/service"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/wb-go/wbf/logger"
+)
+
+// коды ошибок уровня API (коды ошибок сервиса берутся из service.Error)
+const (
+	codeBadRequest       = "bad_request"       // тело запроса не разбирается
+	codeValidationFailed = "validation_failed" // тело разобрано, но поля не прошли проверку
+	codeMissingParameter = "missing_parameter" // не передан обязательный параметр запроса
+	codeInternal         = "internal_error"    // необработанная ошибка сервера
+)
+
+// messages - переводы сообщений по кодам ошибок (первым идёт русский как язык по умолчанию)
+var messages = map[string]map[string]string{
+	codeBadRequest:       {"ru": "неверный формат запроса", "en": "malformed request"},
+	codeValidationFailed: {"ru": "поля запроса не прошли проверку", "en": "request validation failed"},
+	codeMissingParameter: {"ru": "не передан обязательный параметр", "en": "required parameter is missing"},
+	codeInternal:         {"ru": "внутренняя ошибка сервера", "en": "internal server error"},
+
+	"short_url_taken":       {"ru": "короткая ссылка уже занята", "en": "short URL is already taken"},
+	"user_name_taken":       {"ru": "имя пользователя уже занято", "en": "user name is already taken"},
+	"link_not_found":        {"ru": "ссылка не найдена", "en": "link not found"},
+	"trash_link_not_found":  {"ru": "ссылка в корзине не найдена", "en": "link not found in trash"},
+	"link_expired":          {"ru": "срок действия ссылки истёк", "en": "link has expired"},
+	"expires_at_in_past":    {"ru": "expires_at должен быть в будущем", "en": "expires_at must be in the future"},
+	"invalid_redirect_type": {"ru": "неизвестный способ перенаправления", "en": "unknown redirect type"},
+	"unknown_dimension":     {"ru": "неизвестное измерение аналитики", "en": "unknown analytics dimension"},
+	"invalid_range":         {"ru": "неверный период: from и to в формате RFC 3339 или YYYY-MM-DD, from раньше to", "en": "invalid range: from and to must be RFC 3339 or YYYY-MM-DD, from before to"},
+	"invalid_granularity":   {"ru": "шаг должен быть minute, hour, day, week или month", "en": "granularity must be minute, hour, day, week or month"},
+	"invalid_timezone":      {"ru": "неизвестный часовой пояс", "en": "unknown time zone"},
+	"range_too_large":       {"ru": "слишком много шагов: сократите период или увеличьте шаг", "en": "too many buckets: shorten the range or use a coarser granularity"},
+	"invalid_cursor":        {"ru": "неверный курсор", "en": "invalid cursor"},
+	"invalid_export_format": {"ru": "формат выгрузки должен быть csv, ndjson или parquet", "en": "export format must be csv, ndjson or parquet"},
+	"nothing_to_update":     {"ru": "нет полей для изменения", "en": "nothing to update"},
+	"link_forbidden":        {"ru": "ссылка принадлежит другому пользователю", "en": "link belongs to another user"},
+	"admin_required":        {"ru": "требуются права администратора", "en": "administrator rights required"},
+	"api_key_required":      {"ru": "не передан API-ключ", "en": "API key is required"},
+	"invalid_api_key":       {"ru": "недействительный API-ключ", "en": "invalid API key"},
+	"short_url_exhausted":   {"ru": "не удалось подобрать свободную короткую ссылку", "en": "failed to generate a free short URL"},
+	"short_url_limit":       {"ru": "короткие ссылки достигли предельной длины, свободных больше нет", "en": "short URLs reached their maximum length, no free ones left"},
+	"cache_unavailable":     {"ru": "кэш выключен или Redis недоступен", "en": "cache is disabled or Redis is unavailable"},
+	"click_dropped":         {"ru": "переход не записан: очередь переполнена", "en": "click not recorded: the queue is full"},
+}
+
+// statusByKind - HTTP-статусы для категорий ошибок сервиса
+var statusByKind = []struct {
+	kind   error
+	status int
+}{
+	{service.ErrUnauthorized, http.StatusUnauthorized},
+	{service.ErrConflict, http.StatusConflict},
+	{service.ErrNotFound, http.StatusNotFound},
+	{service.ErrExpired, http.StatusGone},
+	{service.ErrForbidden, http.StatusForbidden},
+	{service.ErrValidation, http.StatusUnprocessableEntity},
+	{service.ErrUnavailable, http.StatusServiceUnavailable},
+}
+
+// respondError - единая точка преобразования ошибок в HTTP-ответ
+func respondError(c *gin.Context, log logger.Logger, err error) {
+
+	var svcErr *service.Error
+	if errors.As(err, &svcErr) {
+		for _, m := range statusByKind {
+			if errors.Is(svcErr, m.kind) {
+				log.Ctx(c.Request.Context()).Info("запрос отклонён", "code", svcErr.Code, "error", err)
+				writeError(c, m.status, svcErr.Code)
+				return
+			}
+		}
+	}
+
+	log.Ctx(c.Request.Context()).Error("ошибка обработки запроса", "error", err)
+	writeError(c, http.StatusInternalServerError, codeInternal)
+}
+
+// RespondError - respondError для middleware из других пакетов (аутентификация в pkg/server)
+func RespondError(c *gin.Context, log logger.Logger, err error) {
+
+	respondError(c, log, err)
+	c.Abort()
+}
+
+// respondBindError отвечает на ошибку разбора тела запроса (422 для непрошедших проверку полей, 400 для остального)
+func respondBindError(c *gin.Context, log logger.Logger, err error) {
+
+	log.Ctx(c.Request.Context()).Info("неверный формат запроса", "error", err)
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		writeError(c, http.StatusUnprocessableEntity, codeValidationFailed)
+		return
+	}
+
+	writeError(c, http.StatusBadRequest, codeBadRequest)
+}
+
+// writeError пишет ErrorResponse с переведённым под Accept-Language сообщением
+func writeError(c *gin.Context, status int, code string) {
+
+	c.JSON(status, ErrorResponse{
+		Code:  code,
+		Error: translate(code, c.GetHeader("Accept-Language")),
+	})
+}
+
+// translate возвращает сообщение для кода ошибки на языке клиента (русский по умолчанию)
+func translate(code, acceptLanguage string) string {
+
+	texts, ok := messages[code]
+	if !ok {
+		texts = messages[codeInternal]
+	}
+
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		lang, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ = strings.Cut(strings.ToLower(lang), "-")
+		if text, ok := texts[lang]; ok {
+			return text
+		}
+	}
+
+	return texts["ru"]
+}
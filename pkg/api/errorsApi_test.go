@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/IPampurin/UrlShortener/pkg/service"
+	"github.com/gin-gonic/gin"
+	"github.com/wb-go/wbf/logger"
+)
+
+// serviceErrors - все ошибки сервиса с ожидаемыми HTTP-статусами
+// (новая ошибка в errorsService.go должна попасть и сюда)
+var serviceErrors = []struct {
+	err    *service.Error
+	status int
+}{
+	{service.ErrShortURLTaken, http.StatusConflict},
+	{service.ErrUserNameTaken, http.StatusConflict},
+	{service.ErrLinkNotFound, http.StatusNotFound},
+	{service.ErrTrashLinkNotFound, http.StatusNotFound},
+	{service.ErrLinkForbidden, http.StatusForbidden},
+	{service.ErrAdminRequired, http.StatusForbidden},
+	{service.ErrAPIKeyRequired, http.StatusUnauthorized},
+	{service.ErrInvalidAPIKey, http.StatusUnauthorized},
+	{service.ErrLinkExpired, http.StatusGone},
+	{service.ErrExpiresInPast, http.StatusUnprocessableEntity},
+	{service.ErrInvalidRedirectType, http.StatusUnprocessableEntity},
+	{service.ErrUnknownDimension, http.StatusUnprocessableEntity},
+	{service.ErrInvalidRange, http.StatusUnprocessableEntity},
+	{service.ErrInvalidGranularity, http.StatusUnprocessableEntity},
+	{service.ErrInvalidTimezone, http.StatusUnprocessableEntity},
+	{service.ErrRangeTooLarge, http.StatusUnprocessableEntity},
+	{service.ErrInvalidCursor, http.StatusUnprocessableEntity},
+	{service.ErrInvalidExportFormat, http.StatusUnprocessableEntity},
+	{service.ErrNothingToUpdate, http.StatusUnprocessableEntity},
+	{service.ErrShortURLExhausted, http.StatusServiceUnavailable},
+	{service.ErrShortURLLimit, http.StatusServiceUnavailable},
+	{service.ErrCacheUnavailable, http.StatusServiceUnavailable},
+	{service.ErrClickDropped, http.StatusServiceUnavailable},
+}
+
+func testLogger(t *testing.T) logger.Logger {
+
+	t.Helper()
+
+	log, err := logger.InitLogger(logger.SlogEngine, "UrlShortener", "test", logger.WithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("ошибка создания логгера: %v", err)
+	}
+
+	return log
+}
+
+// recordError прогоняет err через respondError и возвращает статус и тело ответа
+func recordError(t *testing.T, log logger.Logger, err error, acceptLanguage string) (int, ErrorResponse) {
+
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.Header.Set("Accept-Language", acceptLanguage)
+
+	respondError(c, log, err)
+
+	var resp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("тело ответа не разбирается: %v (%s)", err, rec.Body.String())
+	}
+
+	return rec.Code, resp
+}
+
+func TestRespondErrorServiceErrors(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+	log := testLogger(t)
+
+	for _, tt := range serviceErrors {
+		t.Run(tt.err.Code, func(t *testing.T) {
+			// ошибка сервиса обычно приходит обёрнутой
+			status, resp := recordError(t, log, fmt.Errorf("обработка: %w", tt.err), "en-US,en;q=0.9")
+
+			if status != tt.status {
+				t.Errorf("статус = %d, ожидался %d", status, tt.status)
+			}
+			if resp.Code != tt.err.Code {
+				t.Errorf("код = %q, ожидался %q", resp.Code, tt.err.Code)
+			}
+
+			texts, ok := messages[tt.err.Code]
+			if !ok {
+				t.Fatalf("для кода %q нет переводов", tt.err.Code)
+			}
+			if texts["ru"] == "" || texts["en"] == "" {
+				t.Errorf("для кода %q нет перевода на ru или en: %v", tt.err.Code, texts)
+			}
+			if resp.Error != texts["en"] {
+				t.Errorf("сообщение = %q, ожидалось %q", resp.Error, texts["en"])
+			}
+		})
+	}
+}
+
+func TestRespondErrorInternal(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+	log := testLogger(t)
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"обычная ошибка", errors.New("соединение разорвано")},
+		{"ошибка сервиса категории ErrInternal", &service.Error{Kind: service.ErrInternal, Code: "secret", Message: "подробности"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := recordError(t, log, tt.err, "")
+
+			if status != http.StatusInternalServerError || resp.Code != codeInternal {
+				t.Errorf("ответ %d %q, ожидался %d %q", status, resp.Code, http.StatusInternalServerError, codeInternal)
+			}
+			if resp.Error != messages[codeInternal]["ru"] {
+				t.Errorf("сообщение = %q, ожидался русский текст по умолчанию", resp.Error)
+			}
+		})
+	}
+}
+
+func TestTranslate(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		code           string
+		acceptLanguage string
+		want           string
+	}{
+		{"русский по умолчанию", "link_not_found", "", "ссылка не найдена"},
+		{"регион и вес отбрасываются", "link_not_found", "en-GB;q=0.8", "link not found"},
+		{"первый известный язык", "link_not_found", "de-DE, en;q=0.5", "link not found"},
+		{"неизвестный код", "no_such_code", "en", "internal server error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := translate(tt.code, tt.acceptLanguage); got != tt.want {
+				t.Errorf("translate(%q, %q) = %q, ожидалось %q", tt.code, tt.acceptLanguage, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"context"
 	"net/http"
 
 	"github.com/IPampurin/UrlShortener/pkg/service"
@@ -15,16 +14,21 @@ func CreateShortLink(svc service.ServiceMethods, log logger.Logger) gin.HandlerF
 
 		var req CreateRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			log.Ctx(c.Request.Context()).Error("неверный формат запроса", "error", err)
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "неверный формат запроса"})
+			respondBindError(c, log, err)
 			return
 		}
 
-		link, err := svc.CreateShortLink(c.Request.Context(), log, req.OriginalURL, req.CustomShort)
+		opts := service.CreateOptions{
+			ExpiresAt: req.ExpiresAt,
+			MaxClicks: req.MaxClicks,
+
+			RedirectType: req.RedirectType,
+			PassQuery:    req.PassQuery,
+		}
+
+		link, err := svc.CreateShortLink(c.Request.Context(), log, req.OriginalURL, req.CustomShort, opts)
 		if err != nil {
-			log.Ctx(c.Request.Context()).Error("ошибка создания ссылки", "error", err)
-			// здесь можно проверять конкретные ошибки, если нужно
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "внутренняя ошибка сервера"})
+			respondError(c, log, err)
 			return
 		}
 
@@ -40,46 +44,117 @@ func Redirect(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
 
 		link, err := svc.ShortLinkInfo(c.Request.Context(), log, shortURL)
 		if err != nil {
-			log.Ctx(c.Request.Context()).Error("ошибка получения ссылки", "error", err)
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "внутренняя ошибка"})
+			respondError(c, log, err)
 			return
 		}
-		if link == nil {
-			c.JSON(http.StatusNotFound, ErrorResponse{Error: "ссылка не найдена"})
+
+		// ставим переход в очередь на запись (сама запись идёт пачками в фоне,
+		// потеря перехода при переполнении очереди не должна мешать редиректу)
+		_ = svc.RecordClick(c.Request.Context(), log, link.ID, c.Request.Method, c.GetHeader("User-Agent"), c.ClientIP(), c.GetHeader("Referer"))
+
+		target := link.OriginalURL
+		if link.PassQuery {
+			target = mergeQuery(target, c.Request.URL.Query())
+		}
+
+		writeRedirect(c, link.RedirectType, target)
+	}
+}
+
+// UpdateLink обрабатывает PATCH /links/:short_url
+func UpdateLink(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		shortURL := c.Param("short_url")
+
+		var req UpdateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, log, err)
 			return
 		}
 
-		// асинхронно записываем аналитику
-		go func(linkID int, userAgent, ip, referer string) {
+		opts := service.UpdateOptions{
+			OriginalURL:    req.OriginalURL,
+			ExpiresAt:      req.ExpiresAt,
+			MaxClicks:      req.MaxClicks,
+			ResetExpiresAt: req.ResetExpiresAt,
+			ResetMaxClicks: req.ResetMaxClicks,
+			RedirectType:   req.RedirectType,
+			PassQuery:      req.PassQuery,
+		}
 
-			ctx := context.Background()
-			if err := svc.RecordClick(ctx, log, linkID, userAgent, ip, referer); err != nil {
-				log.Ctx(ctx).Error("ошибка записи аналитики", "error", err)
-			}
-			if err := svc.IncrementClicks(ctx, log, int64(linkID)); err != nil {
-				log.Ctx(ctx).Error("ошибка увеличения счётчика", "error", err)
-			}
+		link, err := svc.UpdateLink(c.Request.Context(), log, shortURL, opts)
+		if err != nil {
+			respondError(c, log, err)
+			return
+		}
 
-		}(link.ID, c.GetHeader("User-Agent"), c.ClientIP(), c.GetHeader("Referer"))
+		c.JSON(http.StatusOK, link)
+	}
+}
+
+// DeleteLink обрабатывает DELETE /links/:short_url
+func DeleteLink(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		shortURL := c.Param("short_url")
 
-		c.Redirect(http.StatusFound, link.OriginalURL)
+		link, err := svc.DeleteLink(c.Request.Context(), log, shortURL)
+		if err != nil {
+			respondError(c, log, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, link)
 	}
 }
 
-// GetAnalytics обрабатывает GET /analytics/:short_url
-func GetAnalytics(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
+// RestoreLink обрабатывает POST /links/:short_url/restore
+func RestoreLink(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		shortURL := c.Param("short_url")
 
-		analytics, err := svc.ShortLinkAnalytics(c.Request.Context(), log, shortURL)
+		link, err := svc.RestoreLink(c.Request.Context(), log, shortURL)
+		if err != nil {
+			respondError(c, log, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, link)
+	}
+}
+
+// GetTrash обрабатывает GET /links/trash
+func GetTrash(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		links, err := svc.DeletedLinks(c.Request.Context(), log)
 		if err != nil {
-			log.Ctx(c.Request.Context()).Error("ошибка получения аналитики", "error", err)
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "внутренняя ошибка"})
+			respondError(c, log, err)
 			return
 		}
-		if analytics == nil {
-			c.JSON(http.StatusNotFound, ErrorResponse{Error: "ссылка не найдена"})
+
+		c.JSON(http.StatusOK, links)
+	}
+}
+
+// GetAnalytics обрабатывает GET /analytics/:short_url (?from=&to=&granularity=&tz=)
+func GetAnalytics(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		shortURL := c.Param("short_url")
+
+		q := service.AnalyticsQuery{
+			From:        c.Query("from"),
+			To:          c.Query("to"),
+			Granularity: c.Query("granularity"),
+			TZ:          c.Query("tz"),
+		}
+
+		analytics, err := svc.ShortLinkAnalytics(c.Request.Context(), log, shortURL, q)
+		if err != nil {
+			respondError(c, log, err)
 			return
 		}
 
@@ -87,14 +162,194 @@ func GetAnalytics(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc
 	}
 }
 
+// GetClickLog обрабатывает GET /analytics/:short_url/clicks (?cursor=&limit=&from=&to=&tz=&referer=&device=&bot=)
+func GetClickLog(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		shortURL := c.Param("short_url")
+
+		var req ClickLogRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			respondBindError(c, log, err)
+			return
+		}
+
+		q := service.ClickLogQuery{
+			ClickFilterQuery: toClickFilterQuery(req.ClickFilterRequest),
+			Cursor:           req.Cursor,
+			Limit:            req.Limit,
+		}
+
+		clicks, err := svc.ClickLog(c.Request.Context(), log, shortURL, q)
+		if err != nil {
+			respondError(c, log, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, clicks)
+	}
+}
+
+// ExportClicks обрабатывает GET /analytics/:short_url/export (?format=csv|ndjson|parquet и фильтры журнала)
+func ExportClicks(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		shortURL := c.Param("short_url")
+
+		var req ExportRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			respondBindError(c, log, err)
+			return
+		}
+
+		export, err := svc.ExportClicks(c.Request.Context(), log, shortURL, toExportQuery(req))
+		if err != nil {
+			respondError(c, log, err)
+			return
+		}
+
+		streamExport(c, export)
+	}
+}
+
+// ExportAllClicks обрабатывает GET /links/export (выгрузка по всем ссылкам пользователя)
+func ExportAllClicks(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req ExportRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			respondBindError(c, log, err)
+			return
+		}
+
+		export, err := svc.ExportAllClicks(c.Request.Context(), log, toExportQuery(req))
+		if err != nil {
+			respondError(c, log, err)
+			return
+		}
+
+		streamExport(c, export)
+	}
+}
+
+// streamExport отдаёт выгрузку файлом: после первых байт статус уже не изменить,
+// поэтому ошибка посреди выгрузки только обрывает ответ (и пишется в лог сервисом)
+func streamExport(c *gin.Context, export *service.Export) {
+
+	c.Header("Content-Type", export.ContentType)
+	c.Header("Content-Disposition", `attachment; filename="`+export.FileName+`"`)
+	c.Status(http.StatusOK)
+
+	if err := export.Stream(c.Request.Context(), c.Writer); err != nil {
+		c.Abort()
+	}
+}
+
+// toClickFilterQuery переводит фильтры из параметров запроса в параметры сервиса
+func toClickFilterQuery(req ClickFilterRequest) service.ClickFilterQuery {
+
+	return service.ClickFilterQuery{
+		From:    req.From,
+		To:      req.To,
+		TZ:      req.TZ,
+		Referer: req.Referer,
+		Device:  req.Device,
+		Bot:     req.Bot,
+	}
+}
+
+// toExportQuery переводит параметры запроса выгрузки в параметры сервиса
+func toExportQuery(req ExportRequest) service.ExportQuery {
+
+	return service.ExportQuery{
+		ClickFilterQuery: toClickFilterQuery(req.ClickFilterRequest),
+		Format:           req.Format,
+	}
+}
+
+// GetBreakdown обрабатывает GET /analytics/:short_url/:dimension (?bots=true - переходы ботов)
+func GetBreakdown(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		shortURL := c.Param("short_url")
+		dimension := c.Param("dimension")
+		bots := c.Query("bots") == "true"
+
+		breakdown, err := svc.ShortLinkBreakdown(c.Request.Context(), log, shortURL, dimension, bots)
+		if err != nil {
+			respondError(c, log, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, breakdown)
+	}
+}
+
+// CreateUser обрабатывает POST /admin/users
+func CreateUser(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var req CreateUserRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, log, err)
+			return
+		}
+
+		user, err := svc.CreateUser(c.Request.Context(), log, req.Name, req.IsAdmin)
+		if err != nil {
+			respondError(c, log, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, user)
+	}
+}
+
+// GetIngestStats обрабатывает GET /admin/ingest
+func GetIngestStats(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		c.JSON(http.StatusOK, svc.IngestStats())
+	}
+}
+
+// WarmCache обрабатывает POST /admin/cache/warm
+func WarmCache(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		result, err := svc.WarmCache(c.Request.Context(), log)
+		if err != nil {
+			respondError(c, log, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// GetLookupStats обрабатывает GET /admin/lookups
+func GetLookupStats(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		c.JSON(http.StatusOK, svc.LookupStats())
+	}
+}
+
+// GetHealth обрабатывает GET /health (деградированный режим - тоже 200: сервис обслуживает запросы)
+func GetHealth(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		c.JSON(http.StatusOK, svc.Health())
+	}
+}
+
 // GetLinks обрабатывает GET /links
 func GetLinks(svc service.ServiceMethods, log logger.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		links, err := svc.LastLinks(c.Request.Context(), log)
 		if err != nil {
-			log.Ctx(c.Request.Context()).Error("ошибка получения списка ссылок", "error", err)
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "внутренняя ошибка"})
+			respondError(c, log, err)
 			return
 		}
 
@@ -108,14 +363,13 @@ func SearchByOriginal(svc service.ServiceMethods, log logger.Logger) gin.Handler
 
 		query := c.Query("q")
 		if query == "" {
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "параметр q обязателен"})
+			writeError(c, http.StatusBadRequest, codeMissingParameter)
 			return
 		}
 
 		links, err := svc.SearchByOriginalURL(c.Request.Context(), log, query)
 		if err != nil {
-			log.Ctx(c.Request.Context()).Error("ошибка поиска по оригинальному URL", "error", err)
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "внутренняя ошибка"})
+			respondError(c, log, err)
 			return
 		}
 
@@ -129,14 +383,13 @@ func SearchByShort(svc service.ServiceMethods, log logger.Logger) gin.HandlerFun
 
 		query := c.Query("q")
 		if query == "" {
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "параметр q обязателен"})
+			writeError(c, http.StatusBadRequest, codeMissingParameter)
 			return
 		}
 
 		links, err := svc.SearchByShortURL(c.Request.Context(), log, query)
 		if err != nil {
-			log.Ctx(c.Request.Context()).Error("ошибка поиска по короткому URL", "error", err)
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "внутренняя ошибка"})
+			respondError(c, log, err)
 			return
 		}
 
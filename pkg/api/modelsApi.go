@@ -1,12 +1,62 @@
 package api
 
+import "time"
+
 // CreateRequest - запрос на создание короткой ссылки (POST /shorten вход)
 type CreateRequest struct {
-	OriginalURL string `json:"original_url" binding:"required,url"`
-	CustomShort string `json:"custom_short" binding:"omitempty,alphanum,max=50"`
+	OriginalURL string     `json:"original_url" binding:"required,url"`
+	CustomShort string     `json:"custom_short" binding:"omitempty,alphanum,max=50"`
+	ExpiresAt   *time.Time `json:"expires_at"   binding:"omitempty"`
+	MaxClicks   *int       `json:"max_clicks"   binding:"omitempty,min=1"`
+
+	RedirectType string `json:"redirect_type" binding:"omitempty,oneof=301 302 307 308 interstitial"`
+	PassQuery    bool   `json:"pass_query"`
+}
+
+// UpdateRequest - запрос на изменение ссылки (PATCH /links/:short_url вход)
+type UpdateRequest struct {
+	OriginalURL    *string    `json:"original_url"     binding:"omitempty,url"`
+	ExpiresAt      *time.Time `json:"expires_at"       binding:"omitempty"`
+	MaxClicks      *int       `json:"max_clicks"       binding:"omitempty,min=1"`
+	ResetExpiresAt bool       `json:"reset_expires_at"`
+	ResetMaxClicks bool       `json:"reset_max_clicks"`
+	RedirectType   *string    `json:"redirect_type"    binding:"omitempty,oneof=301 302 307 308 interstitial"`
+	PassQuery      *bool      `json:"pass_query"`
+}
+
+// CreateUserRequest - запрос на создание пользователя API (POST /admin/users вход)
+type CreateUserRequest struct {
+	Name    string `json:"name"     binding:"required,max=100"`
+	IsAdmin bool   `json:"is_admin"`
+}
+
+// ClickFilterRequest - фильтры переходов в параметрах запроса
+type ClickFilterRequest struct {
+	From    string `form:"from"`
+	To      string `form:"to"`
+	TZ      string `form:"tz"`
+	Referer string `form:"referer"`
+	Device  string `form:"device"  binding:"omitempty,oneof=desktop mobile tablet bot"`
+	Bot     *bool  `form:"bot"`
+}
+
+// ClickLogRequest - параметры запроса GET /analytics/:short_url/clicks
+type ClickLogRequest struct {
+	ClickFilterRequest
+
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit"  binding:"omitempty,min=1,max=500"`
+}
+
+// ExportRequest - параметры запросов выгрузки переходов
+type ExportRequest struct {
+	ClickFilterRequest
+
+	Format string `form:"format" binding:"omitempty,oneof=csv ndjson parquet"`
 }
 
 // ErrorResponse - стандартный ответ с ошибкой
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Code  string `json:"code"`  // стабильный машиночитаемый код ошибки
+	Error string `json:"error"` // сообщение на языке клиента (Accept-Language)
 }
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+// interstitialDelay - сколько секунд промежуточная страница показывается перед переходом
+const interstitialDelay = 2
+
+// interstitialPage - промежуточная страница: meta refresh для браузеров без JS и location.replace для остальных
+var interstitialPage = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+    <meta charset="UTF-8">
+    <meta http-equiv="refresh" content="{{.Delay}}; url={{.Target}}">
+    <meta name="robots" content="noindex">
+    <title>Переход по ссылке</title>
+</head>
+<body>
+    <p>Сейчас вы будете перенаправлены на <a href="{{.Target}}">{{.Target}}</a></p>
+    <script>setTimeout(function () { window.location.replace({{.Target}}); }, {{.Delay}} * 1000);</script>
+</body>
+</html>
+`))
+
+// redirectStatuses - HTTP-статусы для способов перенаправления
+var redirectStatuses = map[string]int{
+	db.RedirectMovedPermanently: http.StatusMovedPermanently,
+	db.RedirectFound:            http.StatusFound,
+	db.RedirectTemporary:        http.StatusTemporaryRedirect,
+	db.RedirectPermanent:        http.StatusPermanentRedirect,
+}
+
+// writeRedirect перенаправляет посетителя на target указанным способом
+func writeRedirect(c *gin.Context, redirectType, target string) {
+
+	if redirectType == db.RedirectInterstitial && isWebURL(target) {
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		_ = interstitialPage.Execute(c.Writer, struct {
+			Target string
+			Delay  int
+		}{target, interstitialDelay})
+		return
+	}
+
+	status, ok := redirectStatuses[redirectType]
+	if !ok {
+		status = http.StatusFound
+	}
+
+	c.Redirect(status, target)
+}
+
+// mergeQuery добавляет к target параметры запроса посетителя
+// (одноимённые параметры посетителя заменяют параметры исходной ссылки)
+func mergeQuery(target string, incoming url.Values) string {
+
+	if len(incoming) == 0 {
+		return target
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+
+	query := u.Query()
+	for key, values := range incoming {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// isWebURL проверяет, что адрес http(s): промежуточная страница не должна исполнять javascript: и подобные схемы
+func isWebURL(target string) bool {
+
+	u, err := url.Parse(target)
+
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
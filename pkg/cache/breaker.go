@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker - предохранитель обращений к Redis: после threshold ошибок подряд размыкается,
+// и обращения сразу получают ErrUnavailable, не дожидаясь таймаута; замыкает его только
+// фоновая проверка соединения (reconnect), когда Redis снова отвечает
+type breaker struct {
+	mu        sync.Mutex
+	threshold int       // ошибок подряд до размыкания
+	failures  int       // ошибок подряд на текущий момент
+	openedAt  time.Time // момент размыкания (нулевой - предохранитель замкнут)
+	lastErr   error     // ошибка, разомкнувшая предохранитель
+}
+
+// newBreaker создаёт замкнутый предохранитель
+func newBreaker(threshold int) *breaker {
+
+	return &breaker{threshold: max(threshold, 1)}
+}
+
+// allow сообщает, можно ли обращаться к Redis
+func (b *breaker) allow() bool {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.openedAt.IsZero()
+}
+
+// record учитывает результат обращения и возвращает true, если именно эта ошибка разомкнула предохранитель
+func (b *breaker) record(err error) bool {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		return false
+	}
+
+	b.failures++
+	if b.failures < b.threshold || !b.openedAt.IsZero() {
+		return false
+	}
+
+	b.openedAt = time.Now()
+	b.lastErr = err
+
+	return true
+}
+
+// trip размыкает предохранитель сразу (Redis недоступен при старте)
+func (b *breaker) trip(err error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = b.threshold
+	b.openedAt = time.Now()
+	b.lastErr = err
+}
+
+// reset замыкает предохранитель и возвращает, сколько он был разомкнут
+func (b *breaker) reset() time.Duration {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	down := time.Since(b.openedAt)
+	b.failures = 0
+	b.openedAt = time.Time{}
+	b.lastErr = nil
+
+	return down
+}
+
+// status возвращает состояние предохранителя
+func (b *breaker) status() Status {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openedAt.IsZero() {
+		return Status{State: StateConnected}
+	}
+
+	since := b.openedAt
+	status := Status{State: StateDegraded, Since: &since}
+	if b.lastErr != nil {
+		status.LastError = b.lastErr.Error()
+	}
+
+	return status
+}
@@ -5,69 +5,260 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"math"
+	"math/rand/v2"
 	"time"
 
 	"github.com/IPampurin/UrlShortener/pkg/db"
-	"github.com/wb-go/wbf/redis"
+	goredis "github.com/go-redis/redis/v8"
 	"github.com/wb-go/wbf/retry"
 )
 
-// LoadDataToCache загружает данные за последнее время в кэш при старте
-func (c *Cache) LoadDataToCache(ctx context.Context, lastLinks []*db.Link) error {
+// LoadDataToCache загружает ссылки в кэш и возвращает, сколько из них загружено
+// (ссылки, которые кэшировать нельзя, и ссылки с ошибкой записи пропускаются)
+func (c *Cache) LoadDataToCache(ctx context.Context, lastLinks []*db.Link) (int, error) {
 
+	loaded := 0
 	strategy := retry.Strategy{Attempts: 3, Delay: 100 * time.Millisecond, Backoff: 2}
 
 	for _, link := range lastLinks {
 
-		key := link.ShortURL
+		key := c.keys.link(link.ShortURL)
+		ttl, ok := c.linkTTL(link)
+		if !ok {
+			continue
+		}
+
 		data, err := json.Marshal(link)
 		if err != nil {
 			log.Printf("ошибка маршалинга ссылки %s при прогреве кэша: %v", key, err)
 			continue
 		}
 
-		err = c.redis.SetWithExpirationAndRetry(ctx, strategy, key, data, c.ttl)
+		err = c.do(ctx, func(ctx context.Context) error {
+			return retry.DoContext(ctx, strategy, func() error {
+				return c.redis.Set(ctx, key, data, ttl).Err()
+			})
+		})
+		if errors.Is(err, ErrUnavailable) {
+			// Redis отказал посреди прогрева, остальные ссылки прогреются после восстановления
+			return loaded, err
+		}
 		if err != nil {
 			log.Printf("ошибка добавления ссылки %s при прогреве кэша: %v", key, err)
 			continue
 		}
+		loaded++
 	}
 
-	return nil
+	return loaded, nil
 }
 
-// GetLink возвращает ссылку из кэша по короткому URL (или nil, nil)
-func (c *Cache) GetLink(ctx context.Context, shortURL string) (*db.Link, error) {
+// GetLink возвращает ссылку из локального кэша или из Redis по короткому URL
+// (пустой LinkEntry - промах, в том числе пока Redis недоступен); незадолго до истечения TTL
+// записи отдельные запросы получают Refresh и обновляют её из БД заранее (XFetch)
+func (c *Cache) GetLink(ctx context.Context, shortURL string) (LinkEntry, error) {
+
+	if link := c.local.get(shortURL, time.Now()); link != nil {
+		return LinkEntry{Link: link}, nil
+	}
+	seen := c.local.version()
 
-	data, err := c.redis.Get(ctx, shortURL)
+	var (
+		data string
+		left time.Duration
+	)
+	err := c.do(ctx, func(ctx context.Context) error {
+		pipe := c.redis.Pipeline()
+		get := pipe.Get(ctx, c.keys.link(shortURL))
+		pttl := pipe.PTTL(ctx, c.keys.link(shortURL))
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+		data, left = get.Val(), pttl.Val()
+		return nil
+	})
 	if err != nil {
-		if errors.Is(err, redis.NoMatches) {
-			return nil, nil
+		if errors.Is(err, goredis.Nil) || errors.Is(err, ErrUnavailable) {
+			return LinkEntry{}, nil
 		}
-		return nil, err
+		return LinkEntry{}, err
+	}
+
+	if data == negativeEntry {
+		return LinkEntry{Missing: true}, nil
 	}
 
 	var link db.Link
 	if err := json.Unmarshal([]byte(data), &link); err != nil {
-		return nil, err
+		return LinkEntry{}, err
+	}
+
+	refresh := c.refreshEarly(left)
+	if ttl, ok := c.linkTTL(&link); ok && !refresh {
+		c.local.set(&link, ttl, seen)
+	}
+
+	return LinkEntry{Link: &link, Refresh: refresh}, nil
+}
+
+// refreshEarly решает, обновить ли запись с оставшимся временем жизни left заранее:
+// вероятность растёт по мере приближения к истечению TTL (XFetch, характерное время - earlyRefresh),
+// поэтому обновляет запись обычно один запрос, а остальные продолжают получать её из кэша
+func (c *Cache) refreshEarly(left time.Duration) bool {
+
+	if c.earlyRefresh <= 0 || left <= 0 {
+		return false // обновление заранее выключено или запись бессрочная
+	}
+
+	return -float64(c.earlyRefresh)*math.Log(rand.Float64()) >= float64(left)
+}
+
+// SetMissing сохраняет негативную запись: короткой ссылки нет в БД, и ближайшие negativeTTL
+// запросы этой ссылки получают ответ без обращения к БД (существующая запись не перезаписывается,
+// а созданная ссылка сразу заменяет негативную запись через SetLink)
+func (c *Cache) SetMissing(ctx context.Context, shortURL string) error {
+
+	if c.negativeTTL <= 0 {
+		return nil
+	}
+
+	err := c.do(ctx, func(ctx context.Context) error {
+		return c.redis.SetNX(ctx, c.keys.link(shortURL), negativeEntry, c.negativeTTL).Err()
+	})
+	if errors.Is(err, ErrUnavailable) {
+		return nil
 	}
 
-	return &link, nil
+	return err
 }
 
 // SetLink сохраняет ссылку в кэш с внутренним TTL
+// (TTL не превышает оставшийся срок жизни ссылки, ссылки с бюджетом переходов не кэшируются;
+// пока Redis недоступен, ссылка сохраняется только в локальный кэш)
 func (c *Cache) SetLink(ctx context.Context, shortURL string, link *db.Link) error {
 
+	seen := c.local.version()
+	ttl, ok := c.linkTTL(link)
+	if !ok {
+		// кэшировать нечего: прежние версии ссылки другие экземпляры уже убрали по
+		// PUBLISH из DeleteLink при изменении или удалении, здесь чистим только локальную копию
+		c.local.remove(shortURL)
+		return nil
+	}
+
 	data, err := json.Marshal(link)
 	if err != nil {
 		return err
 	}
 
-	return c.redis.SetWithExpiration(ctx, shortURL, data, c.ttl)
+	c.local.set(link, ttl, seen)
+
+	err = c.do(ctx, func(ctx context.Context) error {
+		return c.redis.Set(ctx, c.keys.link(shortURL), data, ttl).Err()
+	})
+	if errors.Is(err, ErrUnavailable) {
+		return nil
+	}
+
+	return err
+}
+
+// linkTTL определяет время жизни ссылки в кэше, ok == false означает, что кэшировать ссылку нельзя
+// (счётчик переходов в кэше не обновляется, поэтому ссылки с MaxClicks всегда читаем из БД)
+func (c *Cache) linkTTL(link *db.Link) (ttl time.Duration, ok bool) {
+
+	if link.MaxClicks != nil {
+		return 0, false
+	}
+
+	ttl = c.ttl
+	if link.ExpiresAt != nil {
+		left := time.Until(*link.ExpiresAt)
+		if left <= 0 {
+			return 0, false
+		}
+		if ttl <= 0 || left < ttl {
+			ttl = left
+		}
+	}
+
+	return ttl, true
 }
 
-// DeleteLink удаляет ссылку из кэша
+// DeleteLink удаляет ссылку из кэша и сообщает об этом остальным экземплярам сервиса;
+// если Redis недоступен, ссылка запоминается и удаляется после восстановления соединения
 func (c *Cache) DeleteLink(ctx context.Context, shortURL string) error {
 
-	return c.redis.Del(ctx, shortURL)
+	c.local.remove(shortURL)
+
+	err := c.do(ctx, func(ctx context.Context) error {
+		pipe := c.redis.Pipeline()
+		pipe.Del(ctx, c.keys.link(shortURL))
+		pipe.Publish(ctx, c.keys.invalidation(), shortURL)
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+	if err == nil {
+		return nil
+	}
+
+	c.remember(shortURL)
+	if errors.Is(err, ErrUnavailable) {
+		return nil
+	}
+
+	return err
+}
+
+// remember запоминает ссылку для удаления из кэша после восстановления соединения
+func (c *Cache) remember(shortURL string) {
+
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	if len(c.pending) >= maxPending {
+		// устаревшая версия этой ссылки проживёт в кэше не дольше REDIS_TTL
+		c.log.Warn("слишком много ссылок ждут удаления из кэша", "short_url", shortURL, "pending", len(c.pending))
+		return
+	}
+
+	c.pending[shortURL] = struct{}{}
+}
+
+// flushPending удаляет из кэша ссылки, изменённые, пока Redis был недоступен, и сообщает о них
+// остальным экземплярам (в обход предохранителя)
+func (c *Cache) flushPending(ctx context.Context) error {
+
+	c.pendingMu.Lock()
+	keys := make([]string, 0, len(c.pending))
+	for key := range c.pending {
+		keys = append(keys, key)
+	}
+	c.pendingMu.Unlock()
+
+	for start := 0; start < len(keys); start += 1000 {
+		chunk := keys[start:min(start+1000, len(keys))]
+
+		ctx, cancel := context.WithTimeout(ctx, c.timeout)
+		pipe := c.redis.Pipeline()
+		for _, key := range chunk {
+			// ключи удаляются по одному: в Redis Cluster они лежат в разных слотах
+			pipe.Del(ctx, c.keys.link(key))
+			pipe.Publish(ctx, c.keys.invalidation(), key)
+		}
+		_, err := pipe.Exec(ctx)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		c.pendingMu.Lock()
+		for _, key := range chunk {
+			delete(c.pending, key)
+		}
+		c.pendingMu.Unlock()
+	}
+
+	return nil
 }
@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/IPampurin/UrlShortener/pkg/configuration"
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// режимы подключения к Redis (REDIS_MODE)
+const (
+	modeStandalone = "standalone" // один сервер REDIS_HOST_NAME:REDIS_PORT (или первый из REDIS_ADDRS)
+	modeSentinel   = "sentinel"   // мастер REDIS_SENTINEL_MASTER, адрес которого сообщают сентинелы из REDIS_ADDRS
+	modeCluster    = "cluster"    // Redis Cluster, REDIS_ADDRS - начальные узлы
+)
+
+// newClient создаёт клиента Redis в режиме из конфигурации (соединения открываются при первом обращении,
+// ошибка - только у неверных параметров)
+func newClient(cfgCache *configuration.ConfCache) (goredis.UniversalClient, error) {
+
+	addrs := make([]string, 0, len(cfgCache.Addrs))
+	for _, addr := range cfgCache.Addrs {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		addrs = append(addrs, fmt.Sprintf("%s:%d", cfgCache.HostName, cfgCache.Port))
+	}
+
+	switch strings.ToLower(cfgCache.Mode) {
+	case "", modeStandalone:
+		return goredis.NewClient(&goredis.Options{
+			Addr:     addrs[0],
+			Password: cfgCache.Password,
+			DB:       cfgCache.DB,
+		}), nil
+
+	case modeSentinel:
+		if cfgCache.SentinelMaster == "" {
+			return nil, fmt.Errorf("для REDIS_MODE=%s нужно имя мастера REDIS_SENTINEL_MASTER", modeSentinel)
+		}
+		return goredis.NewFailoverClient(&goredis.FailoverOptions{
+			MasterName:       cfgCache.SentinelMaster,
+			SentinelAddrs:    addrs,
+			SentinelPassword: cfgCache.SentinelPassword,
+			Password:         cfgCache.Password,
+			DB:               cfgCache.DB,
+		}), nil
+
+	case modeCluster:
+		if cfgCache.DB != 0 {
+			return nil, fmt.Errorf("в Redis Cluster есть только БД 0, а REDIS_DB=%d", cfgCache.DB)
+		}
+		return goredis.NewClusterClient(&goredis.ClusterOptions{
+			Addrs:    addrs,
+			Password: cfgCache.Password,
+		}), nil
+	}
+
+	return nil, fmt.Errorf("неизвестный режим подключения REDIS_MODE=%q (ожидается %s, %s или %s)",
+		cfgCache.Mode, modeStandalone, modeSentinel, modeCluster)
+}
+
+// configureMemory устанавливает параметры памяти Redis, только если они заданы в REDIS_MAXMEMORY
+// и REDIS_MAXMEMORY_POLICY (в кластере - на каждом мастере): по умолчанию настройки сервера Redis
+// не меняются; ошибка не фатальна, в управляемом Redis команда CONFIG обычно запрещена
+func (c *Cache) configureMemory(ctx context.Context) {
+
+	if c.maxMemory == "" && c.memoryPolicy == "" {
+		return
+	}
+
+	configure := func(ctx context.Context, client goredis.UniversalClient) error {
+		if c.maxMemory != "" {
+			if err := client.ConfigSet(ctx, "maxmemory", c.maxMemory).Err(); err != nil {
+				return err
+			}
+		}
+		if c.memoryPolicy != "" {
+			return client.ConfigSet(ctx, "maxmemory-policy", c.memoryPolicy).Err()
+		}
+		return nil
+	}
+
+	var err error
+	if cluster, ok := c.redis.(*goredis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, node *goredis.Client) error {
+			return configure(ctx, node)
+		})
+	} else {
+		err = configure(ctx, c.redis)
+	}
+
+	if err != nil {
+		c.log.Warn("не удалось установить параметры памяти Redis", "error", err)
+	}
+}
+
+// checkEviction предупреждает, если Redis может вытеснить HyperLogLog уникальных посетителей: у них есть TTL,
+// поэтому при заданном maxmemory их вытесняют и allkeys-*, и volatile-* политики, а сохраняет только noeviction
+// (если CONFIG запрещена, как в управляемом Redis, проверка пропускается)
+func (c *Cache) checkEviction(ctx context.Context) {
+
+	if !c.visitors {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	values, err := c.redis.ConfigGet(ctx, "maxmemory*").Result()
+	if err != nil {
+		return
+	}
+
+	settings := make(map[string]string, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		name, _ := values[i].(string)
+		value, _ := values[i+1].(string)
+		settings[name] = value
+	}
+
+	maxMemory, policy := settings["maxmemory"], settings["maxmemory-policy"]
+	if maxMemory == "" || maxMemory == "0" || policy == "" || policy == "noeviction" {
+		return
+	}
+
+	c.log.Warn("Redis может вытеснять HyperLogLog уникальных посетителей: нужен Redis с maxmemory-policy noeviction "+
+		"или REDIS_VISITORS=false (посетители в БД)", "maxmemory", maxMemory, "policy", policy)
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// Disabled - кэш, выключенный в конфигурации: ссылки всегда читаются из БД,
+// а посетители и окно дедупликации ведутся запасным способом (ErrUnavailable)
+type Disabled struct{}
+
+// GetLink всегда сообщает о промахе
+func (Disabled) GetLink(ctx context.Context, shortURL string) (LinkEntry, error) {
+
+	return LinkEntry{}, nil
+}
+
+// SetLink ничего не сохраняет
+func (Disabled) SetLink(ctx context.Context, shortURL string, link *db.Link) error {
+
+	return nil
+}
+
+// SetMissing ничего не сохраняет
+func (Disabled) SetMissing(ctx context.Context, shortURL string) error {
+
+	return nil
+}
+
+// DeleteLink ничего не удаляет
+func (Disabled) DeleteLink(ctx context.Context, shortURL string) error {
+
+	return nil
+}
+
+// GetOriginal всегда сообщает о промахе
+func (Disabled) GetOriginal(ctx context.Context, key OriginalKey) (string, error) {
+
+	return "", nil
+}
+
+// SetOriginal ничего не сохраняет
+func (Disabled) SetOriginal(ctx context.Context, key OriginalKey, shortURL string) error {
+
+	return nil
+}
+
+// DeleteOriginal ничего не удаляет
+func (Disabled) DeleteOriginal(ctx context.Context, key OriginalKey) error {
+
+	return nil
+}
+
+// LoadDataToCache ничего не прогревает
+func (Disabled) LoadDataToCache(ctx context.Context, lastLinks []*db.Link) (int, error) {
+
+	return 0, nil
+}
+
+// Warm сообщает, что прогревать нечего
+func (Disabled) Warm(ctx context.Context) (WarmResult, error) {
+
+	return WarmResult{}, ErrUnavailable
+}
+
+// AddVisitors отказывает, чтобы посетители записались в БД
+func (Disabled) AddVisitors(ctx context.Context, linkID int, day string, hashes []string) error {
+
+	return ErrUnavailable
+}
+
+// CountVisitors возвращает пустую оценку: без кэша все посетители записаны в БД
+func (Disabled) CountVisitors(ctx context.Context, linkID int, days []string) (int, map[string]int, error) {
+
+	return 0, map[string]int{}, nil
+}
+
+// FirstSeen отказывает, чтобы окно дедупликации велось в памяти процесса
+func (Disabled) FirstSeen(ctx context.Context, keys []string, window time.Duration) ([]bool, error) {
+
+	return nil, ErrUnavailable
+}
+
+// Status сообщает, что кэш выключен
+func (Disabled) Status() Status {
+
+	return Status{State: StateDisabled}
+}
@@ -2,20 +2,51 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/IPampurin/UrlShortener/pkg/db"
 )
 
+// CacheMethods - кэш ссылок и счётчиков посетителей (*Cache поверх Redis или Disabled);
+// пока Redis недоступен, ссылки не кэшируются (GetLink сообщает о промахе), а методы посетителей
+// и дедупликации возвращают ErrUnavailable
 type CacheMethods interface {
-	// GetLink возвращает ссылку из кэша по её короткому URL
-	GetLink(ctx context.Context, shortURL string) (*db.Link, error)
+	// GetLink возвращает ссылку из кэша по её короткому URL, негативную запись или промах
+	GetLink(ctx context.Context, shortURL string) (LinkEntry, error)
 
 	// SetLink сохраняет ссылку в кэш с предустановленным TTL
 	SetLink(ctx context.Context, shortURL string, link *db.Link) error
 
+	// SetMissing сохраняет короткоживущую негативную запись для короткой ссылки, которой нет в БД
+	SetMissing(ctx context.Context, shortURL string) error
+
 	// DeleteLink удаляет ссылку из кэша
 	DeleteLink(ctx context.Context, shortURL string) error
 
-	// LoadDataToCache выполняет прогрев кэша, сохраняя переданный список ссылок
-	LoadDataToCache(ctx context.Context, lastLinks []*db.Link) error
+	// GetOriginal возвращает короткую ссылку, выданную для оригинального URL ("" - промах)
+	GetOriginal(ctx context.Context, key OriginalKey) (string, error)
+
+	// SetOriginal запоминает короткую ссылку, выданную для оригинального URL
+	SetOriginal(ctx context.Context, key OriginalKey, shortURL string) error
+
+	// DeleteOriginal забывает короткую ссылку, выданную для оригинального URL
+	DeleteOriginal(ctx context.Context, key OriginalKey) error
+
+	// LoadDataToCache сохраняет переданный список ссылок и возвращает, сколько из них загружено
+	LoadDataToCache(ctx context.Context, lastLinks []*db.Link) (int, error)
+
+	// Warm прогревает кэш ссылками, по которым больше всего переходили за период прогрева
+	Warm(ctx context.Context) (WarmResult, error)
+
+	// AddVisitors добавляет хэши посетителей в HyperLogLog ссылки за день
+	AddVisitors(ctx context.Context, linkID int, day string, hashes []string) error
+
+	// CountVisitors оценивает число уникальных посетителей ссылки по дням и за все дни вместе
+	CountVisitors(ctx context.Context, linkID int, days []string) (int, map[string]int, error)
+
+	// FirstSeen сообщает для каждого ключа посетителя, что он первый в окне дедупликации window
+	FirstSeen(ctx context.Context, keys []string, window time.Duration) ([]bool, error)
+
+	// Status возвращает состояние кэша для проверки здоровья сервиса
+	Status() Status
 }
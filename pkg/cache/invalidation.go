@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// subscribePing - как долго ждать сообщений до проверки, что подписка жива
+const subscribePing = 30 * time.Second
+
+// subscribe получает инвалидации ссылок от всех экземпляров сервиса (включая этот) из канала
+// keys.invalidation(), куда публикуются изменённые и удалённые короткие ссылки, и удаляет
+// ссылки из локального кэша; при каждой (пере)подписке локальный кэш очищается, потому что
+// пока подписки не было, сообщения могли быть пропущены
+func (c *Cache) subscribe(ctx context.Context, retry time.Duration) {
+
+	pubsub := c.redis.Subscribe(ctx, c.keys.invalidation())
+
+	// Receive не прерывается отменой контекста, закрытие подписки его разблокирует
+	go func() {
+		<-ctx.Done()
+		_ = pubsub.Close()
+	}()
+
+	for {
+		msg, err := pubsub.ReceiveTimeout(ctx, subscribePing)
+		if ctx.Err() != nil {
+			return
+		}
+
+		var netErr net.Error
+		switch {
+		case errors.As(err, &netErr) && netErr.Timeout():
+			// давно нет сообщений: Ping на мёртвом соединении вызовет переподключение
+			_ = pubsub.Ping(ctx)
+			continue
+		case err != nil:
+			// Redis недоступен: локальный кэш очистится при следующей подписке
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retry):
+			}
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *goredis.Subscription:
+			if msg.Kind == "subscribe" {
+				c.local.clear()
+			}
+		case *goredis.Message:
+			c.local.remove(msg.Payload)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// linkSchemaVersion - версия формата записей ссылок в Redis: увеличивается при изменении структуры
+// db.Link, чтобы новая версия сервиса не читала записи старой (они вытесняются по TTL)
+const linkSchemaVersion = 1
+
+// keyspace строит ключи и каналы Redis с общим префиксом (REDIS_KEY_PREFIX), чтобы кэш сервиса
+// не пересекался с другими данными в том же Redis и с другими установками сервиса
+type keyspace struct {
+	prefix string // пустой или оканчивается двоеточием
+}
+
+// newKeyspace создаёт пространство ключей с префиксом prefix (пустой - без префикса)
+func newKeyspace(prefix string) keyspace {
+
+	prefix = strings.TrimRight(strings.TrimSpace(prefix), ":")
+	if prefix != "" {
+		prefix += ":"
+	}
+
+	return keyspace{prefix: prefix}
+}
+
+// link - ключ записи ссылки (или негативной записи) по короткому URL
+func (k keyspace) link(shortURL string) string {
+
+	return fmt.Sprintf("%slink:v%d:%s", k.prefix, linkSchemaVersion, shortURL)
+}
+
+// original - ключ обратного индекса: короткая ссылка, выданная для оригинального URL
+// с такими же владельцем и параметрами перенаправления (URL хэшируется: он бывает длинным)
+func (k keyspace) original(key OriginalKey) string {
+
+	owner := "-"
+	if key.OwnerID != nil {
+		owner = strconv.Itoa(*key.OwnerID)
+	}
+
+	hash := sha256.Sum256([]byte(key.OriginalURL))
+
+	return fmt.Sprintf("%sorig:%s:%s:%t:%s", k.prefix, owner, key.RedirectType, key.PassQuery, hex.EncodeToString(hash[:]))
+}
+
+// visitors - ключ HyperLogLog уникальных посетителей ссылки за день
+// (идентификатор ссылки в фигурных скобках - хэш-тег: в Redis Cluster все дни ссылки попадают
+// в один слот, и PFCOUNT по нескольким дням работает)
+func (k keyspace) visitors(linkID int, day string) string {
+
+	return fmt.Sprintf("%shll:{%d}:%s", k.prefix, linkID, day)
+}
+
+// dedup - ключ окна дедупликации посетителя
+func (k keyspace) dedup(key string) string {
+
+	return k.prefix + "dedup:" + key
+}
+
+// invalidation - канал pub/sub инвалидаций локального кэша
+func (k keyspace) invalidation() string {
+
+	return k.prefix + "links:invalidate"
+}
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// localCache - ограниченный по числу записей LRU-кэш ссылок в памяти процесса перед Redis:
+// самые популярные ссылки отдаются без сетевого обращения и разбора JSON;
+// записи живут недолго (ttl), а изменения ссылок на других экземплярах приходят через pub/sub
+// (nil - локальный уровень выключен, все методы ничего не делают)
+type localCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	items    map[string]*list.Element
+	order    *list.List // от недавно прочитанных к давно прочитанным
+
+	// счётчик инвалидаций: версия, прочитанная из Redis до инвалидации, не попадает в локальный кэш
+	epoch uint64
+
+	hits   uint64
+	misses uint64
+}
+
+// localEntry - запись локального кэша
+type localEntry struct {
+	shortURL  string
+	link      db.Link
+	expiresAt time.Time
+}
+
+// newLocalCache создаёт локальный кэш (nil, если размер или время жизни не заданы)
+func newLocalCache(capacity int, ttl time.Duration) *localCache {
+
+	if capacity <= 0 || ttl <= 0 {
+		return nil
+	}
+
+	return &localCache{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// get возвращает копию ссылки из локального кэша (nil - промах или запись устарела)
+func (l *localCache) get(shortURL string, now time.Time) *db.Link {
+
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elem, ok := l.items[shortURL]
+	if !ok {
+		l.misses++
+		return nil
+	}
+
+	entry := elem.Value.(*localEntry)
+	if !now.Before(entry.expiresAt) {
+		l.order.Remove(elem)
+		delete(l.items, shortURL)
+		l.misses++
+		return nil
+	}
+
+	l.order.MoveToFront(elem)
+	l.hits++
+
+	link := entry.link
+	return &link
+}
+
+// version возвращает текущее значение счётчика инвалидаций (читается до обращения к Redis)
+func (l *localCache) version() uint64 {
+
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.epoch
+}
+
+// set сохраняет ссылку не дольше ttl и собственного времени жизни локального кэша;
+// если после seen была инвалидация, версия могла устареть и не сохраняется
+func (l *localCache) set(link *db.Link, ttl time.Duration, seen uint64) {
+
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.epoch != seen {
+		return
+	}
+
+	expiresAt := time.Now().Add(min(ttl, l.ttl))
+
+	if elem, ok := l.items[link.ShortURL]; ok {
+		entry := elem.Value.(*localEntry)
+		entry.link = *link
+		entry.expiresAt = expiresAt
+		l.order.MoveToFront(elem)
+		return
+	}
+
+	l.items[link.ShortURL] = l.order.PushFront(&localEntry{shortURL: link.ShortURL, link: *link, expiresAt: expiresAt})
+
+	// вытесняем давно не читанные ссылки
+	for l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*localEntry).shortURL)
+	}
+}
+
+// remove удаляет ссылку из локального кэша
+func (l *localCache) remove(shortURL string) {
+
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.epoch++
+	if elem, ok := l.items[shortURL]; ok {
+		l.order.Remove(elem)
+		delete(l.items, shortURL)
+	}
+}
+
+// clear очищает локальный кэш (инвалидации могли быть пропущены, пока не было связи с Redis)
+func (l *localCache) clear() {
+
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.epoch++
+	clear(l.items)
+	l.order.Init()
+}
+
+// stats дополняет состояние кэша счётчиками локального уровня
+func (l *localCache) stats(status *Status) {
+
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status.Local = &LocalStatus{
+		Entries:  l.order.Len(),
+		Capacity: l.capacity,
+		Hits:     l.hits,
+		Misses:   l.misses,
+	}
+}
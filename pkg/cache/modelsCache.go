@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"errors"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// ErrUnavailable возвращается, пока кэш выключен или Redis недоступен (предохранитель разомкнут):
+// получив её, вызывающий переключается на запасной вариант (БД или память процесса)
+var ErrUnavailable = errors.New("кэш недоступен")
+
+// LinkEntry - результат чтения ссылки из кэша
+type LinkEntry struct {
+	Link    *db.Link // ссылка (nil - промах)
+	Missing bool     // негативная запись: ссылки нет в БД, обращаться к БД не нужно
+	Refresh bool     // запись скоро истечёт: этот запрос обновляет её из БД заранее (Link ещё можно отдать)
+}
+
+// OriginalKey - оригинальный URL с параметрами, при которых созданная для него ссылка переиспользуется
+type OriginalKey struct {
+	OriginalURL  string
+	OwnerID      *int   // владелец ссылок (nil - без ограничения)
+	RedirectType string // код перенаправления
+	PassQuery    bool   // передаётся ли строка запроса
+}
+
+// WarmResult - итог прогрева кэша (POST /admin/cache/warm)
+type WarmResult struct {
+	Candidates int    `json:"candidates"` // популярных ссылок выбрано из БД
+	Loaded     int    `json:"loaded"`     // ссылок загружено в Redis (ссылки с бюджетом переходов и истёкшие пропускаются)
+	Duration   string `json:"duration"`   // длительность прогрева
+}
+
+// состояния кэша
+const (
+	StateConnected = "connected" // Redis отвечает
+	StateDegraded  = "degraded"  // Redis недоступен, сервис работает без кэша и ждёт восстановления соединения
+	StateDisabled  = "disabled"  // кэш выключен в конфигурации (REDIS_ENABLED=false)
+)
+
+// Status - снимок состояния кэша (GET /health)
+type Status struct {
+	State     string     `json:"state"`                // connected, degraded или disabled
+	Since     *time.Time `json:"since,omitempty"`      // с какого момента Redis недоступен
+	LastError string     `json:"last_error,omitempty"` // ошибка, разомкнувшая предохранитель
+	Pending   int        `json:"pending,omitempty"`    // ссылок ждут удаления из кэша после восстановления
+
+	Local *LocalStatus `json:"local,omitempty"` // локальный уровень кэша (nil - выключен)
+}
+
+// LocalStatus - счётчики локального кэша ссылок в памяти процесса
+type LocalStatus struct {
+	Entries  int    `json:"entries"`  // ссылок в кэше
+	Capacity int    `json:"capacity"` // предел числа ссылок
+	Hits     uint64 `json:"hits"`     // ссылок отдано из памяти процесса
+	Misses   uint64 `json:"misses"`   // обращений, ушедших в Redis
+}
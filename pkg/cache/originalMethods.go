@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"errors"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// обратный индекс OriginalURL -> ShortURL позволяет при создании ссылки на уже известный URL
+// не искать существующие ссылки в БД; запись - только подсказка: вызывающий проверяет найденную
+// ссылку (она могла измениться или уйти в корзину) и при несовпадении ищет в БД
+
+// GetOriginal возвращает короткую ссылку, выданную для оригинального URL ("" - промах, в том числе
+// пока Redis недоступен)
+func (c *Cache) GetOriginal(ctx context.Context, key OriginalKey) (string, error) {
+
+	var shortURL string
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		shortURL, err = c.redis.Get(ctx, c.keys.original(key)).Result()
+		return err
+	})
+	if errors.Is(err, goredis.Nil) || errors.Is(err, ErrUnavailable) {
+		return "", nil
+	}
+
+	return shortURL, err
+}
+
+// SetOriginal запоминает короткую ссылку для оригинального URL на время жизни кэша
+func (c *Cache) SetOriginal(ctx context.Context, key OriginalKey, shortURL string) error {
+
+	err := c.do(ctx, func(ctx context.Context) error {
+		return c.redis.Set(ctx, c.keys.original(key), shortURL, c.ttl).Err()
+	})
+	if errors.Is(err, ErrUnavailable) {
+		return nil
+	}
+
+	return err
+}
+
+// DeleteOriginal забывает короткую ссылку для оригинального URL
+// (пока Redis недоступен, устаревшую запись отсеет проверка у вызывающего)
+func (c *Cache) DeleteOriginal(ctx context.Context, key OriginalKey) error {
+
+	err := c.do(ctx, func(ctx context.Context) error {
+		return c.redis.Del(ctx, c.keys.original(key)).Err()
+	})
+	if errors.Is(err, ErrUnavailable) {
+		return nil
+	}
+
+	return err
+}
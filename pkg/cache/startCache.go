@@ -2,74 +2,226 @@ package cache
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/IPampurin/UrlShortener/pkg/configuration"
 	"github.com/IPampurin/UrlShortener/pkg/db"
+	goredis "github.com/go-redis/redis/v8"
 	"github.com/wb-go/wbf/logger"
-	"github.com/wb-go/wbf/redis"
 )
 
-/*
-в кэше должны хранится пары ShortURL - OriginalURL
-также должны быть сочетания OriginalURL - ShortURL // при чём ShortURL в этом случае только сгенерированные! (кастомные ShortURL надо проверять первыми)
-*/
+// negativeEntry - значение негативной записи: короткой ссылки нет в БД (JSON ссылки так выглядеть не может)
+const negativeEntry = "-"
+
+// maxPending - сколько ссылок помнить для удаления из кэша после восстановления соединения
+const maxPending = 10000
 
 // Cache хранит подключение к БД Redis
 type Cache struct {
-	redis   *redis.Client
+	redis   goredis.UniversalClient // отдельный сервер, мастер под наблюдением Sentinel или Redis Cluster
+	keys    keyspace                // ключи и каналы с префиксом REDIS_KEY_PREFIX
 	ttl     time.Duration
-	warming time.Duration
-}
+	warming time.Duration // окно, за которое считаются переходы для прогрева
+	timeout time.Duration // предел одного обращения к Redis
 
-// InitCache запускает работу с Redis
-func InitCache(ctx context.Context, storage *db.DataBase, cfgCache *configuration.ConfCache, log logger.Logger) (*Cache, error) {
+	warmingLimit int        // сколько самых популярных ссылок загружать при прогреве
+	maxMemory    string     // CONFIG SET maxmemory при подключении (пусто - не менять)
+	memoryPolicy string     // CONFIG SET maxmemory-policy при подключении (пусто - не менять)
+	visitors     bool       // уникальные посетители в HyperLogLog (false - только в таблице link_visitors)
+	warmMu       sync.Mutex // прогревы (при старте, периодический, по запросу администратора) не пересекаются
 
-	// определяем конфигурацию подключения к Redis
-	options := redis.Options{
-		Address:   fmt.Sprintf("%s:%d", cfgCache.HostName, cfgCache.Port),
-		Password:  cfgCache.Password,
-		MaxMemory: "100mb",
-		Policy:    "allkeys-lru",
-	}
+	negativeTTL  time.Duration // время жизни негативных записей (0 - не сохраняются)
+	earlyRefresh time.Duration // характерное время обновления записей до истечения TTL (0 - не обновляются)
 
-	// пробуем подключиться
-	clientRedis, err := redis.Connect(options)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка установки соединения с Redis: %v\n", err)
+	breaker *breaker
+	local   *localCache    // горячие ссылки в памяти процесса (nil - только Redis)
+	storage db.LinkMethods // источник ссылок для прогрева после восстановления соединения
+	log     logger.Logger
+
+	// ссылки, которые не удалось удалить из кэша, пока Redis был недоступен
+	// (удаляются после восстановления, чтобы не отдавать устаревшие версии)
+	pendingMu sync.Mutex
+	pending   map[string]struct{}
+}
+
+// InitCache запускает работу с Redis; если кэш выключен, возвращает Disabled, а если Redis
+// недоступен - кэш в деградированном режиме, который подключится, когда Redis поднимется
+func InitCache(ctx context.Context, storage db.LinkMethods, cfgCache *configuration.ConfCache, log logger.Logger) CacheMethods {
+
+	if !cfgCache.Enabled {
+		log.Info("Кэш выключен: ссылки читаются из БД.")
+		return Disabled{}
 	}
 
-	// проверяем подключение
-	err = clientRedis.Ping(context.Background())
+	// создаём клиента в нужном режиме (клиент создаётся и при недоступном Redis, ошибка - только у неверных параметров)
+	clientRedis, err := newClient(cfgCache)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка подключения к Redis: %v\n", err)
+		log.Error("кэш выключен: неверные параметры Redis", "error", err)
+		return Disabled{}
 	}
 
 	// получаем экземпляр
 	cache := &Cache{
 		redis:   clientRedis,
+		keys:    newKeyspace(cfgCache.KeyPrefix),
 		ttl:     cfgCache.TTL,
 		warming: cfgCache.Warming,
+		timeout: cfgCache.Timeout,
+
+		warmingLimit: cfgCache.WarmingLimit,
+		maxMemory:    cfgCache.MaxMemory,
+		memoryPolicy: cfgCache.MaxMemoryPolicy,
+		visitors:     cfgCache.Visitors,
+
+		negativeTTL:  cfgCache.NegativeTTL,
+		earlyRefresh: cfgCache.EarlyRefresh,
+
+		breaker: newBreaker(cfgCache.BreakerFailures),
+		local:   newLocalCache(cfgCache.LocalSize, cfgCache.LocalTTL),
+		storage: storage,
+		log:     log,
+		pending: make(map[string]struct{}),
+	}
+
+	if cache.timeout <= 0 {
+		cache.timeout = time.Second
+	}
+
+	interval := cfgCache.ReconnectInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	// пробуем подключиться
+	err = cache.ping(ctx)
+
+	// Redis недоступен - работаем без кэша, пока фоновая проверка не восстановит соединение
+	if err != nil {
+		cache.breaker.trip(err)
+		log.Warn("Redis недоступен: кэш работает в деградированном режиме", "error", err, "reconnect_interval", interval)
+	} else {
+		// прогреваем кэш, если с ним всё норм
+		cache.configureMemory(ctx)
+		cache.checkEviction(ctx)
+		cache.warm(ctx)
+		log.Info("Кэш работает.", "mode", cfgCache.Mode, "db", cfgCache.DB, "key_prefix", cfgCache.KeyPrefix)
 	}
 
-	// прогреваем кэш, если с ним всё норм
-	if cache.redis != nil {
+	go cache.reconnect(ctx, interval)
+
+	// популярность ссылок меняется, поэтому прогрев повторяется
+	if cfgCache.WarmingInterval > 0 {
+		go cache.rewarm(ctx, cfgCache.WarmingInterval)
+	}
+
+	// локальный кэш согласуется с другими экземплярами через pub/sub
+	if cache.local != nil {
+		go cache.subscribe(ctx, interval)
+		log.Info("Локальный кэш ссылок включён.", "size", cfgCache.LocalSize, "ttl", cfgCache.LocalTTL)
+	}
+
+	return cache
+}
+
+// reconnect раз в interval проверяет соединение с Redis, пока предохранитель разомкнут;
+// когда Redis отвечает, восстанавливает заданные параметры памяти, удаляет из кэша ссылки,
+// изменённые за время простоя, прогревает кэш и замыкает предохранитель
+func (c *Cache) reconnect(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if c.breaker.allow() {
+			continue
+		}
+
+		if err := c.ping(ctx); err != nil {
+			continue
+		}
+
+		// Redis мог перезапуститься с настройками по умолчанию
+		c.configureMemory(ctx)
+		c.checkEviction(ctx)
 
-		// получаем список крайних записей
-		links, err := storage.GetLinksOfPeriod(ctx, cache.warming)
-		if err != nil {
-			log.Warn("ошибка прогрева кэша", "error", err)
+		// устаревшие версии ссылок удаляем до того, как кэш снова начнёт отвечать
+		if err := c.flushPending(ctx); err != nil {
+			c.log.Warn("Redis снова недоступен", "error", err)
+			continue
 		}
 
-		// грузим записи в кэш
-		err = cache.LoadDataToCache(ctx, links)
-		if err != nil {
-			log.Warn("ошибка прогрева кэша", "error", err)
+		// пока Redis был недоступен, инвалидации от других экземпляров не приходили
+		c.local.clear()
+
+		down := c.breaker.reset()
+		c.log.Info("Соединение с Redis восстановлено, кэш снова работает.", "downtime", down.Round(time.Second).String())
+
+		// ссылки, изменённые между удалением и замыканием предохранителя
+		if err := c.flushPending(ctx); err != nil {
+			c.log.Warn("ошибка удаления устаревших ссылок из кэша", "error", err)
 		}
+
+		c.warm(ctx)
+	}
+}
+
+// ping проверяет соединение с Redis в обход предохранителя
+func (c *Cache) ping(ctx context.Context) error {
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.redis.Ping(ctx).Err()
+}
+
+// do выполняет обращение к Redis через предохранитель с ограничением времени
+func (c *Cache) do(ctx context.Context, op func(ctx context.Context) error) error {
+
+	if !c.breaker.allow() {
+		return ErrUnavailable
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	err := op(opCtx)
+
+	// отмена запроса клиентом ничего не говорит о состоянии Redis
+	if ctx.Err() != nil {
+		return err
+	}
+
+	// промах - тоже ответ Redis
+	failure := err
+	if errors.Is(err, goredis.Nil) {
+		failure = nil
 	}
 
-	log.Info("Кэш работает.")
+	if c.breaker.record(failure) {
+		c.log.Warn("Redis недоступен: кэш работает в деградированном режиме до восстановления соединения", "error", err)
+	}
+
+	return err
+}
+
+// Status возвращает состояние кэша
+func (c *Cache) Status() Status {
+
+	status := c.breaker.status()
+
+	c.pendingMu.Lock()
+	status.Pending = len(c.pending)
+	c.pendingMu.Unlock()
+
+	c.local.stats(&status)
 
-	return cache, nil
+	return status
 }
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// visitorsTTL - сколько хранится дневной HyperLogLog-оценка уникальных посетителей
+// (у ключей есть TTL, поэтому их сохраняет только политика вытеснения noeviction, см. checkEviction)
+const visitorsTTL = 400 * 24 * time.Hour
+
+// AddVisitors добавляет хэши посетителей в HyperLogLog ссылки за день (day в формате YYYY-MM-DD);
+// при REDIS_VISITORS=false возвращает ErrUnavailable, и посетители пишутся в БД
+func (c *Cache) AddVisitors(ctx context.Context, linkID int, day string, hashes []string) error {
+
+	if !c.visitors {
+		return ErrUnavailable
+	}
+
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	elements := make([]any, len(hashes))
+	for i, h := range hashes {
+		elements[i] = h
+	}
+
+	key := c.keys.visitors(linkID, day)
+
+	err := c.do(ctx, func(ctx context.Context) error {
+		pipe := c.redis.Pipeline()
+		pipe.PFAdd(ctx, key, elements...)
+		pipe.Expire(ctx, key, visitorsTTL)
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка добавления посетителей в HyperLogLog: %w", err)
+	}
+
+	return nil
+}
+
+// CountVisitors оценивает число уникальных посетителей ссылки за каждый из дней и за все дни вместе
+// (общая оценка - объединение дневных HyperLogLog, посетитель нескольких дней считается один раз)
+func (c *Cache) CountVisitors(ctx context.Context, linkID int, days []string) (int, map[string]int, error) {
+
+	if !c.visitors {
+		return 0, nil, ErrUnavailable
+	}
+
+	byDay := make(map[string]int, len(days))
+	if len(days) == 0 {
+		return 0, byDay, nil
+	}
+
+	keys := make([]string, len(days))
+	for i, day := range days {
+		keys[i] = c.keys.visitors(linkID, day)
+	}
+
+	dayCmds := make([]*goredis.IntCmd, len(keys))
+	var totalCmd *goredis.IntCmd
+	err := c.do(ctx, func(ctx context.Context) error {
+		pipe := c.redis.Pipeline()
+		for i, key := range keys {
+			dayCmds[i] = pipe.PFCount(ctx, key)
+		}
+		totalCmd = pipe.PFCount(ctx, keys...)
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("ошибка оценки уникальных посетителей: %w", err)
+	}
+
+	for i, day := range days {
+		byDay[day] = int(dayCmds[i].Val())
+	}
+
+	return int(totalCmd.Val()), byDay, nil
+}
+
+// FirstSeen для каждого ключа посетителя сообщает, что он не встречался в течение window,
+// и открывает для него новое окно (SET NX с истечением: повтор внутри окна окно не продлевает)
+func (c *Cache) FirstSeen(ctx context.Context, keys []string, window time.Duration) ([]bool, error) {
+
+	first := make([]bool, len(keys))
+	if len(keys) == 0 {
+		return first, nil
+	}
+
+	cmds := make([]*goredis.BoolCmd, len(keys))
+	err := c.do(ctx, func(ctx context.Context) error {
+		pipe := c.redis.Pipeline()
+		for i, key := range keys {
+			cmds[i] = pipe.SetNX(ctx, c.keys.dedup(key), 1, window)
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка проверки окна дедупликации: %w", err)
+	}
+
+	for i, cmd := range cmds {
+		first[i] = cmd.Val()
+	}
+
+	return first, nil
+}
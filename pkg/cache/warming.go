@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Warm загружает в кэш не более warmingLimit ссылок, по которым больше всего переходили
+// за период прогрева (старые, но популярные ссылки тоже попадают в кэш);
+// пока Redis недоступен, возвращает ErrUnavailable, не обращаясь к БД
+func (c *Cache) Warm(ctx context.Context) (WarmResult, error) {
+
+	c.warmMu.Lock()
+	defer c.warmMu.Unlock()
+
+	if !c.breaker.allow() {
+		return WarmResult{}, ErrUnavailable
+	}
+
+	start := time.Now()
+
+	// получаем самые популярные ссылки
+	links, err := c.storage.GetPopularLinks(ctx, c.warming, max(c.warmingLimit, 1))
+	if err != nil {
+		return WarmResult{}, err
+	}
+
+	// грузим записи в кэш
+	loaded, err := c.LoadDataToCache(ctx, links)
+
+	return WarmResult{
+		Candidates: len(links),
+		Loaded:     loaded,
+		Duration:   time.Since(start).Round(time.Millisecond).String(),
+	}, err
+}
+
+// warm прогревает кэш при старте и после восстановления соединения (ошибка не фатальна, только логируется)
+func (c *Cache) warm(ctx context.Context) {
+
+	result, err := c.Warm(ctx)
+	if err != nil {
+		c.log.Warn("ошибка прогрева кэша", "error", err, "loaded", result.Loaded)
+		return
+	}
+
+	c.log.Info("Кэш прогрет.", "candidates", result.Candidates, "loaded", result.Loaded, "duration", result.Duration)
+}
+
+// rewarm раз в interval повторяет прогрев, пока Redis доступен
+// (после простоя кэш прогревает reconnect)
+func (c *Cache) rewarm(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if c.breaker.allow() {
+			c.warm(ctx)
+		}
+	}
+}
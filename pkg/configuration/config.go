@@ -1,6 +1,8 @@
 package configuration
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	cleanenvport "github.com/wb-go/wbf/config/cleanenv-port"
@@ -13,30 +15,121 @@ type ConfServer struct {
 	GinMode  string `env:"GIN_MODE"           env-default:"debug"`
 }
 
-// ConfDB — параметры подключения к PostgreSQL
+// ConfDB — параметры хранилища: postgres (по умолчанию), sqlite (файл DB_SQLITE_PATH) или memory
 type ConfDB struct {
+	Backend    string `env:"DB_BACKEND"     env-default:"postgres"`
+	SQLitePath string `env:"DB_SQLITE_PATH" env-default:"urlshortener.db"`
+
 	HostName string `env:"DB_HOST_NAME" env-default:"dbPostgres"`
 	Port     int    `env:"DB_PORT"      env-default:"5432"`
 	Name     string `env:"DB_NAME"      env-default:"db-postgres"`
 	User     string `env:"DB_USER"      env-default:"postgres"`
 	Password string `env:"DB_PASSWORD"  env-default:"postgres"`
+
+	AutoMigrate bool `env:"DB_AUTO_MIGRATE" env-default:"true"`
 }
 
-// ConfCache — параметры Redis
+// ConfCache — параметры кэша: Redis (отдельный сервер, Sentinel или Cluster) и локальный уровень в памяти процесса
 type ConfCache struct {
+	Enabled  bool          `env:"REDIS_ENABLED"   env-default:"true"`
 	HostName string        `env:"REDIS_HOST_NAME" env-default:"dbRedis"`
 	Port     int           `env:"REDIS_PORT"      env-default:"6379"`
 	Password string        `env:"REDIS_PASSWORD"  env-default:""`
 	DB       int           `env:"REDIS_DB"        env-default:"0"`
 	TTL      time.Duration `env:"REDIS_TTL"       env-default:"600s"`
 	Warming  time.Duration `env:"REDIS_WARMING"   env-default:"24h"`
+
+	Mode             string   `env:"REDIS_MODE"              env-default:"standalone"`
+	Addrs            []string `env:"REDIS_ADDRS"             env-separator:"," env-default:""`
+	SentinelMaster   string   `env:"REDIS_SENTINEL_MASTER"   env-default:""`
+	SentinelPassword string   `env:"REDIS_SENTINEL_PASSWORD" env-default:""`
+	KeyPrefix        string   `env:"REDIS_KEY_PREFIX"        env-default:"urlshortener"`
+
+	MaxMemory       string `env:"REDIS_MAXMEMORY"        env-default:""`
+	MaxMemoryPolicy string `env:"REDIS_MAXMEMORY_POLICY" env-default:""`
+	Visitors        bool   `env:"REDIS_VISITORS"         env-default:"true"`
+
+	WarmingLimit    int           `env:"REDIS_WARMING_LIMIT"    env-default:"1000"`
+	WarmingInterval time.Duration `env:"REDIS_WARMING_INTERVAL" env-default:"10m"`
+
+	NegativeTTL  time.Duration `env:"REDIS_NEGATIVE_TTL"  env-default:"30s"`
+	EarlyRefresh time.Duration `env:"REDIS_EARLY_REFRESH" env-default:"5s"`
+
+	Timeout           time.Duration `env:"REDIS_TIMEOUT"            env-default:"500ms"`
+	BreakerFailures   int           `env:"REDIS_BREAKER_FAILURES"   env-default:"3"`
+	ReconnectInterval time.Duration `env:"REDIS_RECONNECT_INTERVAL" env-default:"5s"`
+
+	LocalSize int           `env:"LOCAL_CACHE_SIZE" env-default:"10000"`
+	LocalTTL  time.Duration `env:"LOCAL_CACHE_TTL"  env-default:"5s"`
+}
+
+// ConfIngest — параметры конвейера записи переходов
+type ConfIngest struct {
+	QueueSize     int           `env:"INGEST_QUEUE_SIZE"     env-default:"10000"`
+	Workers       int           `env:"INGEST_WORKERS"        env-default:"4"`
+	BatchSize     int           `env:"INGEST_BATCH_SIZE"     env-default:"500"`
+	FlushInterval time.Duration `env:"INGEST_FLUSH_INTERVAL" env-default:"1s"`
+	DrainTimeout  time.Duration `env:"INGEST_DRAIN_TIMEOUT"  env-default:"30s"`
+	VisitorSalt   string        `env:"INGEST_VISITOR_SALT"   env-default:""`
+	DedupWindow   time.Duration `env:"INGEST_DEDUP_WINDOW"   env-default:"30s"`
+}
+
+// ConfRollup — параметры сворачивания аналитики в дневные сводки
+type ConfRollup struct {
+	Interval time.Duration `env:"ROLLUP_INTERVAL" env-default:"5m"`
+	Delay    time.Duration `env:"ROLLUP_DELAY"    env-default:"10m"`
+}
+
+// ConfRetention — параметры секций analytics и срока хранения сырых переходов
+type ConfRetention struct {
+	Months          int           `env:"RETENTION_MONTHS"           env-default:"0"`
+	Mode            string        `env:"RETENTION_MODE"             env-default:"drop"`
+	PartitionsAhead int           `env:"RETENTION_PARTITIONS_AHEAD" env-default:"3"`
+	Interval        time.Duration `env:"RETENTION_INTERVAL"         env-default:"1h"`
+}
+
+// ConfGenerator — параметры генерации коротких ссылок
+type ConfGenerator struct {
+	Strategy           string  `env:"SHORT_GENERATOR"           env-default:"random"`
+	Length             int     `env:"SHORT_LENGTH"              env-default:"6"`
+	MaxAttempts        int     `env:"SHORT_MAX_ATTEMPTS"        env-default:"10"`
+	CollisionThreshold float64 `env:"SHORT_COLLISION_THRESHOLD" env-default:"0.1"`
+	Salt               string  `env:"SHORT_SALT"                env-default:""`
+}
+
+// ConfBots — параметры распознавания ботов в аналитике
+type ConfBots struct {
+	ExtraPatterns []string `env:"BOT_PATTERNS" env-separator:"," env-default:""`
+}
+
+// ConfGeoIP — параметры определения местоположения по локальным MMDB-базам (пустой путь - база не используется)
+type ConfGeoIP struct {
+	CityPath       string        `env:"GEOIP_CITY_PATH"       env-default:""`
+	ASNPath        string        `env:"GEOIP_ASN_PATH"        env-default:""`
+	ReloadInterval time.Duration `env:"GEOIP_RELOAD_INTERVAL" env-default:"1m"`
+}
+
+// ConfAuth — параметры аутентификации по API-ключам
+type ConfAuth struct {
+	Enabled  bool   `env:"AUTH_ENABLED"   env-default:"true"`
+	AdminKey string `env:"AUTH_ADMIN_KEY" env-default:""`
 }
 
+// placeholderAdminKey - признак ключа-заглушки из примеров конфигурации (он известен всем)
+const placeholderAdminKey = "change-me"
+
 // Config — корневая структура конфигурации
 type Config struct {
-	Server ConfServer
-	DB     ConfDB
-	Redis  ConfCache
+	Server    ConfServer
+	Auth      ConfAuth
+	DB        ConfDB
+	Redis     ConfCache
+	Ingest    ConfIngest
+	Rollup    ConfRollup
+	Retention ConfRetention
+	Generator ConfGenerator
+	Bots      ConfBots
+	GeoIP     ConfGeoIP
 }
 
 // ReadConfig загружает .env файл из корня проекта и возвращает заполненную структуру Config
@@ -54,3 +147,22 @@ func ReadConfig() (*Config, error) {
 
 	return &config, nil
 }
+
+// Validate проверяет ключ администратора перед запуском HTTP-сервера (команде migrate он не нужен):
+// с включённой аутентификацией без ключа некому выпускать ключи, а с ключом-заглушкой
+// администратором становится любой, кто читал пример конфигурации
+func (c *ConfAuth) Validate() error {
+
+	if !c.Enabled {
+		return nil
+	}
+
+	switch {
+	case c.AdminKey == "":
+		return errors.New("AUTH_ENABLED=true, но AUTH_ADMIN_KEY не задан")
+	case strings.Contains(strings.ToLower(c.AdminKey), placeholderAdminKey):
+		return errors.New("AUTH_ADMIN_KEY содержит ключ-заглушку: задайте собственный случайный ключ")
+	}
+
+	return nil
+}
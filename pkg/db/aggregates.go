@@ -0,0 +1,166 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// агрегаты ниже считаются в Go для хранилищ без date_trunc и регулярных выражений PostgreSQL (память, SQLite)
+// и повторяют результат запросов из analyticsMethods.go
+
+// refererHost выделяет домен из Referer так же, как выражение DimensionReferer в dimensionExpressions
+// (домен длиннее dimensionValueWidth символов обрезается)
+var refererHost = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*://([^/?#:@]{1,512})`)
+
+// DimensionValue возвращает значение измерения dimension для перехода
+// (пустые поля, как и NULL в PostgreSQL, считаются неизвестными)
+func DimensionValue(a *Analytics, dimension string) (string, error) {
+
+	switch dimension {
+	case DimensionUserAgent:
+		return clipValue(a.UserAgent), nil
+	case DimensionBrowser:
+		return orUnknown(a.Browser), nil
+	case DimensionBrowserVersion:
+		return withVersion(a.Browser, a.BrowserVersion), nil
+	case DimensionOS:
+		return orUnknown(a.OS), nil
+	case DimensionOSVersion:
+		return withVersion(a.OS, a.OSVersion), nil
+	case DimensionDevice:
+		return orUnknown(a.Device), nil
+	case DimensionCountry:
+		return orUnknown(a.Country), nil
+	case DimensionRegion:
+		return withCountry(a.Region, a.Country), nil
+	case DimensionCity:
+		return withCountry(a.City, a.Country), nil
+	case DimensionASN:
+		if a.ASN == 0 {
+			return "unknown", nil
+		}
+		if a.ASOrg == "" {
+			return "AS" + strconv.Itoa(a.ASN), nil
+		}
+		return "AS" + strconv.Itoa(a.ASN) + " " + a.ASOrg, nil
+	case DimensionReferer:
+		if match := refererHost.FindStringSubmatch(a.Referer); match != nil {
+			return strings.ToLower(match[1]), nil
+		}
+		return "direct", nil
+	}
+
+	return "", fmt.Errorf("неизвестное измерение %q", dimension)
+}
+
+// clipValue обрезает значение измерения до dimensionValueWidth символов, как LEFT в PostgreSQL
+func clipValue(value string) string {
+
+	if utf8.RuneCountInString(value) <= dimensionValueWidth {
+		return value
+	}
+
+	return string([]rune(value)[:dimensionValueWidth])
+}
+
+// orUnknown заменяет пустое значение на unknown
+func orUnknown(value string) string {
+
+	if value == "" {
+		return "unknown"
+	}
+
+	return value
+}
+
+// withVersion дописывает к семейству версию, если она известна
+func withVersion(family, version string) string {
+
+	if family == "" {
+		return "unknown"
+	}
+	if version == "" {
+		return family
+	}
+
+	return family + " " + version
+}
+
+// withCountry дописывает к месту код страны (без страны место неизвестно)
+func withCountry(place, country string) string {
+
+	if place == "" || country == "" {
+		return "unknown"
+	}
+
+	return place + ", " + country
+}
+
+// granularitySteps - переход к началу следующего шага временной шкалы
+var granularitySteps = map[string]func(t time.Time) time.Time{
+	GranularityMinute: func(t time.Time) time.Time { return t.Add(time.Minute) },
+	GranularityHour:   func(t time.Time) time.Time { return t.Add(time.Hour) },
+	GranularityDay:    func(t time.Time) time.Time { return t.AddDate(0, 0, 1) },
+	GranularityWeek:   func(t time.Time) time.Time { return t.AddDate(0, 0, 7) },
+	GranularityMonth:  func(t time.Time) time.Time { return t.AddDate(0, 1, 0) },
+}
+
+// Timeline раскладывает переходы по шагам granularity в часовом поясе tz за [from, to), включая шаги
+// без переходов, как CountClicksByPeriod; clicks - количество переходов по моментам внутри [from, to)
+// (моменты можно заранее сгруппировать по минутам)
+func Timeline(from, to time.Time, granularity, tz string, clicks []TimeBucket) ([]TimeBucket, error) {
+
+	step, ok := granularitySteps[granularity]
+	if !ok {
+		return nil, fmt.Errorf("неизвестный шаг временной шкалы %q", granularity)
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("неизвестный часовой пояс %q: %w", tz, err)
+	}
+
+	counts := make(map[time.Time]int)
+	for _, c := range clicks {
+		counts[wallBucket(c.Start, granularity, loc)] += c.Clicks
+	}
+
+	// шаги перебираются по показаниям часов пояса, как generate_series по TIMESTAMP в PostgreSQL
+	var buckets []TimeBucket
+	last := wallBucket(to.Add(-time.Microsecond), granularity, loc)
+	for wall := wallBucket(from, granularity, loc); !wall.After(last); wall = step(wall) {
+		buckets = append(buckets, TimeBucket{
+			Start:  time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, loc),
+			Clicks: counts[wall],
+		})
+	}
+
+	return buckets, nil
+}
+
+// wallBucket возвращает начало шага, в который попадает t, в показаниях часов пояса loc
+// (записанных как время UTC, чтобы шаги складывались без переходов на летнее время)
+func wallBucket(t time.Time, granularity string, loc *time.Location) time.Time {
+
+	t = t.In(loc)
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch granularity {
+	case GranularityHour:
+		return wall.Truncate(time.Hour)
+	case GranularityDay:
+		return day
+	case GranularityWeek:
+		// неделя начинается с понедельника, как в date_trunc('week', ...)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case GranularityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	return wall
+}
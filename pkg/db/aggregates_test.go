@@ -0,0 +1,43 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDimensionValueClipsVisitorValues(t *testing.T) {
+
+	longUA := strings.Repeat("ж", 3000)
+	longHost := strings.Repeat("a", 3000) + ".example.com"
+
+	tests := []struct {
+		name      string
+		click     Analytics
+		dimension string
+		want      string
+	}{
+		{"короткий User-Agent", Analytics{UserAgent: "Mozilla/5.0"}, DimensionUserAgent, "Mozilla/5.0"},
+		{"длинный User-Agent", Analytics{UserAgent: longUA}, DimensionUserAgent, strings.Repeat("ж", dimensionValueWidth)},
+		{"домен Referer", Analytics{Referer: "https://WWW.Example.com/path?q=1"}, DimensionReferer, "www.example.com"},
+		{"длинный домен Referer", Analytics{Referer: "https://" + longHost + "/"}, DimensionReferer, strings.Repeat("a", dimensionValueWidth)},
+		{"без Referer", Analytics{}, DimensionReferer, "direct"},
+		{"без страны", Analytics{City: "Berlin"}, DimensionCity, "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DimensionValue(&tt.click, tt.dimension)
+			if err != nil {
+				t.Fatalf("DimensionValue: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("DimensionValue = %.40q... (%d символов), ожидалось %.40q... (%d символов)",
+					got, len([]rune(got)), tt.want, len([]rune(tt.want)))
+			}
+		})
+	}
+
+	if _, err := DimensionValue(&Analytics{}, "color"); err == nil {
+		t.Error("DimensionValue: неизвестное измерение не отклонено")
+	}
+}
@@ -4,17 +4,60 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strings"
 	"time"
+
+	"github.com/jackc/pgx/v5"
+	pgxdriver "github.com/wb-go/wbf/dbpg/pgx-driver"
 )
 
+// analyticsColumns - перечень полей таблицы analytics в порядке сканирования в scanAnalytics
+const analyticsColumns = `id, link_id, accessed_at, user_agent, ip_address, referer, is_bot, is_repeat,
+	COALESCE(browser, ''), COALESCE(browser_version, ''), COALESCE(os, ''), COALESCE(os_version, ''), COALESCE(device, ''),
+	COALESCE(country, ''), COALESCE(region, ''), COALESCE(city, ''), COALESCE(asn, 0), COALESCE(as_org, '')`
+
+// scanAnalytics считывает строку выборки из analytics в структуру Analytics
+func scanAnalytics(row pgx.Row, a *Analytics) error {
+
+	return row.Scan(analyticsDest(a)...)
+}
+
+// analyticsDest возвращает адреса полей Analytics в порядке analyticsColumns
+func analyticsDest(a *Analytics) []any {
+
+	return []any{
+		&a.ID,
+		&a.LinkID,
+		&a.AccessedAt,
+		&a.UserAgent,
+		&a.IPAddress,
+		&a.Referer,
+		&a.IsBot,
+		&a.IsRepeat,
+		&a.Browser,
+		&a.BrowserVersion,
+		&a.OS,
+		&a.OSVersion,
+		&a.Device,
+		&a.Country,
+		&a.Region,
+		&a.City,
+		&a.ASN,
+		&a.ASOrg,
+	}
+}
+
 // SaveAnalytics записывает каждый переход
-func (d *DataBase) SaveAnalytics(ctx context.Context, linkID int, accessedAt time.Time, userAgent, ipAddress, referer string) error {
+func (d *DataBase) SaveAnalytics(ctx context.Context, linkID int, accessedAt time.Time, userAgent, ipAddress, referer string, isBot bool) error {
 
-	query := `INSERT INTO analytics (link_id, accessed_at, user_agent, ip_address, referer)
-              VALUES ($1, $2, $3, $4, $5)`
+	query := `INSERT INTO analytics (link_id, accessed_at, user_agent, ip_address, referer, is_bot)
+              VALUES ($1, $2, $3, $4, $5, $6)`
 
 	ip := net.ParseIP(ipAddress) // если пусто, вернёт nil
-	_, err := d.Pool.Exec(ctx, query, linkID, accessedAt, userAgent, ip, referer)
+	err := d.saveClicks(ctx, []time.Time{accessedAt}, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, query, linkID, accessedAt, userAgent, ip, referer, isBot)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("ошибка добавления записи о переходе в SaveAnalytics: %w", err)
 	}
@@ -22,138 +65,374 @@ func (d *DataBase) SaveAnalytics(ctx context.Context, linkID int, accessedAt tim
 	return nil
 }
 
-// GetAnalyticsByLinkID получение всех записей для конкретной ссылки
-func (d *DataBase) GetAnalyticsByLinkID(ctx context.Context, linkID int) ([]*Analytics, error) {
+// SaveAnalyticsBatch записывает пачку переходов одним COPY
+func (d *DataBase) SaveAnalyticsBatch(ctx context.Context, records []*Analytics) error {
 
-	query := `SELECT *
-	            FROM analytics
-			   WHERE link_id = $1`
+	if len(records) == 0 {
+		return nil
+	}
+
+	columns := []string{"link_id", "accessed_at", "user_agent", "ip_address", "referer", "is_bot", "is_repeat",
+		"browser", "browser_version", "os", "os_version", "device",
+		"country", "region", "city", "asn", "as_org"}
+
+	rows := make([][]any, len(records))
+	accessed := make([]time.Time, len(records))
+	for i, a := range records {
+		rows[i] = []any{a.LinkID, a.AccessedAt, a.UserAgent, a.IPAddress, a.Referer, a.IsBot, a.IsRepeat,
+			a.Browser, a.BrowserVersion, a.OS, a.OSVersion, a.Device,
+			nullString(a.Country), nullString(a.Region), nullString(a.City), nullInt(a.ASN), nullString(a.ASOrg)}
+		accessed[i] = a.AccessedAt
+	}
 
-	rows, err := d.Pool.Query(ctx, query, linkID)
+	err := d.saveClicks(ctx, accessed, func(tx pgx.Tx) error {
+		_, err := pgxdriver.BulkInsert(ctx, tx, "analytics", columns, rows)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при получении списка записей в GetAnalyticsByLinkID: %w", err)
+		return fmt.Errorf("ошибка добавления пачки записей о переходах в SaveAnalyticsBatch: %w", err)
+	}
+
+	return nil
+}
+
+// GetClicks возвращает страницу журнала переходов по ссылке (от новых к старым):
+// не более limit записей с id меньше afterID (0 - с самой новой), подходящих под filter
+func (d *DataBase) GetClicks(ctx context.Context, linkID int, filter ClickFilter, afterID int64, limit int) ([]*Analytics, error) {
+
+	query := `SELECT ` + analyticsColumns + `
+	            FROM analytics
+			   WHERE link_id = $1
+			     AND ($2::BIGINT = 0 OR id < $2)
+			     AND ($3::TIMESTAMPTZ IS NULL OR accessed_at >= $3)
+			     AND ($4::TIMESTAMPTZ IS NULL OR accessed_at < $4)
+			     AND ($5::TEXT = '' OR referer ILIKE '%' || $5 || '%')
+			     AND ($6::TEXT = '' OR device = $6)
+			     AND ($7::BOOLEAN IS NULL OR is_bot = $7)
+			   ORDER BY id DESC
+			   LIMIT $8`
+
+	rows, err := d.Pool.Query(ctx, query, linkID, afterID, filter.From, filter.To,
+		escapeLike(filter.Referer), filter.Device, filter.IsBot, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении журнала переходов в GetClicks: %w", err)
 	}
 	defer rows.Close()
 
 	var analytics []*Analytics
 	for rows.Next() {
 		var a Analytics
-		err := rows.Scan(
-			&a.ID,
-			&a.LinkID,
-			&a.AccessedAt,
-			&a.UserAgent,
-			&a.IPAddress,
-			&a.Referer,
-		)
+		err := scanAnalytics(rows, &a)
 		if err != nil {
-			return nil, fmt.Errorf("ошибка при сканировании строки списка записей в GetAnalyticsByLinkID: %w", err)
+			return nil, fmt.Errorf("ошибка при сканировании строки журнала переходов в GetClicks: %w", err)
 		}
 
 		analytics = append(analytics, &a)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при итерации по списку записей в GetAnalyticsByLinkID: %w", err)
+		return nil, fmt.Errorf("ошибка при итерации по журналу переходов в GetClicks: %w", err)
 	}
 
 	return analytics, nil
 }
 
-// агрегация
+// exportFetchSize - сколько строк выгрузки забирается из серверного курсора за один FETCH
+const exportFetchSize = 1000
 
-// CountClicksByDay - группировка по дням
-func (d *DataBase) CountClicksByDay(ctx context.Context, linkID int, from, to time.Time) (map[string]int, error) {
+// StreamClicks передаёт в fn все переходы по ссылке linkID (или по всем ссылкам владельца ownerID,
+// nil в обоих - по всем ссылкам) от старых к новым; строки читаются серверным курсором порциями,
+// поэтому память не зависит от объёма выгрузки
+func (d *DataBase) StreamClicks(ctx context.Context, linkID, ownerID *int, filter ClickFilter,
+	fn func(shortURL string, a *Analytics) error) error {
 
-	query := `SELECT DATE(accessed_at) AS day,
-	                 COUNT(*) AS count
-                FROM analytics
-               WHERE link_id = $1
-                 AND accessed_at >= $2 AND accessed_at < $3
-               GROUP BY day`
+	query := `DECLARE export_clicks NO SCROLL CURSOR FOR
+	          SELECT ` + analyticsColumns + `,
+	                 (SELECT short_url FROM links WHERE links.id = analytics.link_id)
+	            FROM analytics
+			   WHERE ($1::INT IS NULL OR link_id = $1)
+			     AND ($2::INT IS NULL OR link_id IN (SELECT id FROM links WHERE owner_id = $2))
+			     AND ($3::TIMESTAMPTZ IS NULL OR accessed_at >= $3)
+			     AND ($4::TIMESTAMPTZ IS NULL OR accessed_at < $4)
+			     AND ($5::TEXT = '' OR referer ILIKE '%' || $5 || '%')
+			     AND ($6::TEXT = '' OR device = $6)
+			     AND ($7::BOOLEAN IS NULL OR is_bot = $7)
+			   ORDER BY id`
+
+	// курсор живёт только внутри транзакции
+	tx, err := d.Pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("ошибка открытия транзакции в StreamClicks: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
 
-	rows, err := d.Pool.Query(ctx, query, linkID, from, to)
+	_, err = tx.Exec(ctx, query, linkID, ownerID, filter.From, filter.To, escapeLike(filter.Referer), filter.Device, filter.IsBot)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при выполнении запроса в CountClicksByDay: %w", err)
+		return fmt.Errorf("ошибка объявления курсора в StreamClicks: %w", err)
 	}
-	defer rows.Close()
 
-	dayCountClick := make(map[string]int)
-	var key string
-	var val int
-	for rows.Next() {
-		err := rows.Scan(
-			&key,
-			&val,
-		)
+	fetch := fmt.Sprintf("FETCH %d FROM export_clicks", exportFetchSize)
+
+	for {
+		rows, err := tx.Query(ctx, fetch)
 		if err != nil {
-			return nil, fmt.Errorf("ошибка при сканировании строки запроса в CountClicksByDay: %w", err)
+			return fmt.Errorf("ошибка чтения курсора в StreamClicks: %w", err)
+		}
+
+		fetched := 0
+		for rows.Next() {
+			var a Analytics
+			var shortURL string
+			if err := rows.Scan(append(analyticsDest(&a), &shortURL)...); err != nil {
+				rows.Close()
+				return fmt.Errorf("ошибка при сканировании строки выгрузки в StreamClicks: %w", err)
+			}
+			fetched++
+
+			if err := fn(shortURL, &a); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("ошибка при итерации по курсору в StreamClicks: %w", err)
 		}
 
-		dayCountClick[key] = val
+		if fetched < exportFetchSize {
+			break
+		}
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при итерации по списку записей в CountClicksByDay: %w", err)
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка завершения транзакции в StreamClicks: %w", err)
+	}
+
+	return nil
+}
+
+// CountClicks - количество переходов людей или ботов по ссылке
+// (свёрнутые дни читаются из сводки, остальные - из analytics)
+func (d *DataBase) CountClicks(ctx context.Context, linkID int, isBot bool) (int, error) {
+
+	span, err := d.rollupSpan(ctx, minTime, maxTime)
+	if err != nil {
+		return 0, err
 	}
 
-	return dayCountClick, nil
+	query := `SELECT (SELECT COALESCE(SUM(clicks), 0)
+	                    FROM link_daily_stats
+	                   WHERE link_id = $1
+	                     AND is_bot = $6
+	                     AND ` + rolledDays + `)
+	               + (SELECT COUNT(*)
+	                    FROM analytics
+	                   WHERE link_id = $1
+	                     AND is_bot = $6
+	                     AND ` + rawDays + `)`
+
+	var count int
+	err = d.Pool.QueryRow(ctx, query, span.args(linkID, minTime, maxTime, isBot)...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при подсчёте переходов в CountClicks: %w", err)
+	}
+
+	return count, nil
+}
+
+// агрегация
+
+// CountClicksByDay - группировка по дням (UTC)
+func (d *DataBase) CountClicksByDay(ctx context.Context, linkID int, from, to time.Time, isBot bool) (map[string]int, error) {
+
+	rolled := `SELECT TO_CHAR(day, 'YYYY-MM-DD') AS key,
+	                  SUM(clicks) AS count
+	             FROM link_daily_stats
+	            WHERE link_id = $1
+	              AND is_bot = $6
+	              AND ` + rolledDays + `
+	            GROUP BY key`
+
+	raw := `SELECT TO_CHAR(accessed_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS key,
+	               COUNT(*) AS count
+	          FROM analytics
+	         WHERE link_id = $1
+	           AND is_bot = $6
+	           AND ` + rawDays + `
+	         GROUP BY key`
+
+	return d.countGrouped(ctx, "CountClicksByDay", rolled, raw, linkID, from, to, isBot)
+}
+
+// CountClicksByMonth - группировка по месяцам (UTC)
+func (d *DataBase) CountClicksByMonth(ctx context.Context, linkID int, from, to time.Time, isBot bool) (map[string]int, error) {
+
+	rolled := `SELECT TO_CHAR(day, 'YYYY-MM') AS key,
+	                  SUM(clicks) AS count
+	             FROM link_daily_stats
+	            WHERE link_id = $1
+	              AND is_bot = $6
+	              AND ` + rolledDays + `
+	            GROUP BY key`
+
+	raw := `SELECT TO_CHAR(accessed_at AT TIME ZONE 'UTC', 'YYYY-MM') AS key,
+	               COUNT(*) AS count
+	          FROM analytics
+	         WHERE link_id = $1
+	           AND is_bot = $6
+	           AND ` + rawDays + `
+	         GROUP BY key`
+
+	return d.countGrouped(ctx, "CountClicksByMonth", rolled, raw, linkID, from, to, isBot)
 }
 
-// CountClicksByMonth - группировка по месяцам
-func (d *DataBase) CountClicksByMonth(ctx context.Context, linkID int, from, to time.Time) (map[string]int, error) {
+// CountClicksByPeriod - группировка по шагам временной шкалы в часовом поясе tz
+// (шаги без переходов возвращаются с нулём, чтобы график был непрерывным)
+func (d *DataBase) CountClicksByPeriod(ctx context.Context, linkID int, from, to time.Time, granularity, tz string, isBot bool) ([]TimeBucket, error) {
 
-	query := `SELECT TO_CHAR(accessed_at, 'YYYY-MM') AS month,
-	                 COUNT(*) AS count
-                FROM analytics
-               WHERE link_id = $1
-                 AND accessed_at >= $2 AND accessed_at < $3
-               GROUP BY month`
+	// дневные сводки делятся на шаги только в UTC и только шагами не меньше дня
+	span := emptySpan(from)
+	if rollupGranularity(granularity) && tz == "UTC" {
+		var err error
+		if span, err = d.rollupSpan(ctx, from, to); err != nil {
+			return nil, err
+		}
+	}
 
-	rows, err := d.Pool.Query(ctx, query, linkID, from, to)
+	query := `WITH buckets AS (
+	               SELECT GENERATE_SERIES(
+	                          DATE_TRUNC($7, $2::TIMESTAMPTZ AT TIME ZONE $8),
+	                          DATE_TRUNC($7, ($3::TIMESTAMPTZ - INTERVAL '1 microsecond') AT TIME ZONE $8),
+	                          ('1 ' || $7)::INTERVAL) AS bucket
+	          ),
+	               clicks AS (
+	               SELECT bucket,
+	                      SUM(count) AS count
+	                 FROM (SELECT DATE_TRUNC($7, day::TIMESTAMP) AS bucket,
+	                              SUM(clicks) AS count
+	                         FROM link_daily_stats
+	                        WHERE link_id = $1
+	                          AND is_bot = $6
+	                          AND ` + rolledDays + `
+	                        GROUP BY bucket
+	                        UNION ALL
+	                       SELECT DATE_TRUNC($7, accessed_at AT TIME ZONE $8) AS bucket,
+	                              COUNT(*) AS count
+	                         FROM analytics
+	                        WHERE link_id = $1
+	                          AND is_bot = $6
+	                          AND ` + rawDays + `
+	                        GROUP BY bucket) AS parts
+	                GROUP BY bucket
+	          )
+	          SELECT b.bucket AT TIME ZONE $8,
+	                 COALESCE(c.count, 0)::BIGINT
+	            FROM buckets b
+	            LEFT JOIN clicks c ON c.bucket = b.bucket
+	           ORDER BY b.bucket`
+
+	rows, err := d.Pool.Query(ctx, query, append(span.args(linkID, from, to, isBot), granularity, tz)...)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при выполнении запроса в CountClicksByMonth: %w", err)
+		return nil, fmt.Errorf("ошибка при выполнении запроса в CountClicksByPeriod: %w", err)
 	}
 	defer rows.Close()
 
-	monthCountClick := make(map[string]int)
-	var key string
-	var val int
+	var buckets []TimeBucket
 	for rows.Next() {
+		var b TimeBucket
 		err := rows.Scan(
-			&key,
-			&val,
+			&b.Start,
+			&b.Clicks,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("ошибка при сканировании строки запроса в CountClicksByMonth: %w", err)
+			return nil, fmt.Errorf("ошибка при сканировании строки запроса в CountClicksByPeriod: %w", err)
 		}
 
-		monthCountClick[key] = val
+		buckets = append(buckets, b)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при итерации по списку записей в CountClicksByMonth: %w", err)
+		return nil, fmt.Errorf("ошибка при итерации по списку записей в CountClicksByPeriod: %w", err)
 	}
 
-	return monthCountClick, nil
+	return buckets, nil
 }
 
 // CountClicksByUserAgent - группировка по User-Agent
-func (d *DataBase) CountClicksByUserAgent(ctx context.Context, linkID int) (map[string]int, error) {
+func (d *DataBase) CountClicksByUserAgent(ctx context.Context, linkID int, isBot bool) (map[string]int, error) {
+
+	return d.CountClicksByDimension(ctx, linkID, DimensionUserAgent, isBot)
+}
+
+// dimensionExpressions - выражения группировки для измерений аналитики
+// (записи, сделанные до появления разбора User-Agent, попадают в unknown)
+var dimensionExpressions = map[string]string{
+	DimensionUserAgent:      "LEFT(COALESCE(user_agent, ''), 512)", // 512 - dimensionValueWidth
+	DimensionBrowser:        "COALESCE(browser, 'unknown')",
+	DimensionBrowserVersion: "COALESCE(browser || ' ' || NULLIF(browser_version, ''), browser, 'unknown')",
+	DimensionOS:             "COALESCE(os, 'unknown')",
+	DimensionOSVersion:      "COALESCE(os || ' ' || NULLIF(os_version, ''), os, 'unknown')",
+	DimensionDevice:         "COALESCE(device, 'unknown')",
+	DimensionCountry:        "COALESCE(country, 'unknown')",
+	DimensionRegion:         "COALESCE(region || ', ' || country, 'unknown')",
+	DimensionCity:           "COALESCE(city || ', ' || country, 'unknown')",
+	DimensionASN:            "COALESCE('AS' || asn || COALESCE(' ' || as_org, ''), 'unknown')",
+	DimensionReferer:        "COALESCE(LOWER(NULLIF(SUBSTRING(referer FROM '^[A-Za-z][A-Za-z0-9+.-]*://([^/?#:@]{1,512})'), '')), 'direct')",
+}
+
+// CountClicksByDimension - группировка по одному из измерений (браузер, ОС, устройство и т.д.)
+func (d *DataBase) CountClicksByDimension(ctx context.Context, linkID int, dimension string, isBot bool) (map[string]int, error) {
+
+	expression, ok := dimensionExpressions[dimension]
+	if !ok {
+		return nil, fmt.Errorf("неизвестное измерение %q в CountClicksByDimension", dimension)
+	}
+
+	rolled := `SELECT value AS key,
+	                  SUM(clicks) AS count
+	             FROM link_daily_dimensions
+	            WHERE link_id = $1
+	              AND dimension = $7
+	              AND is_bot = $6
+	              AND ` + rolledDays + `
+	            GROUP BY key`
+
+	raw := `SELECT ` + expression + ` AS key,
+	               COUNT(*) AS count
+	          FROM analytics
+	         WHERE link_id = $1
+	           AND is_bot = $6
+	           AND ` + rawDays + `
+	         GROUP BY key`
+
+	return d.countGrouped(ctx, "CountClicksByDimension", rolled, raw, linkID, minTime, maxTime, isBot, dimension)
+}
 
-	query := `SELECT user_agent,
-	                 COUNT(*) AS count
-                FROM analytics
-               WHERE link_id = $1
-			   GROUP BY user_agent`
+// countGrouped объединяет группировку по сводкам (rolled) и по несвёрнутым переходам (raw)
+// за период [from, to); оба запроса возвращают колонки key и count и используют параметры из rollupSpan.args
+func (d *DataBase) countGrouped(ctx context.Context, caller, rolled, raw string, linkID int, from, to time.Time,
+	isBot bool, extra ...any) (map[string]int, error) {
 
-	rows, err := d.Pool.Query(ctx, query, linkID)
+	span, err := d.rollupSpan(ctx, from, to)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при выполнении запроса в CountClicksByUserAgent: %w", err)
+		return nil, err
+	}
+
+	query := `SELECT key,
+	                 SUM(count)::BIGINT
+	            FROM (` + rolled + `
+	                  UNION ALL
+	                  ` + raw + `) AS parts
+	           GROUP BY key`
+
+	rows, err := d.Pool.Query(ctx, query, append(span.args(linkID, from, to, isBot), extra...)...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса в %s: %w", caller, err)
 	}
 	defer rows.Close()
 
-	userAgentCountClick := make(map[string]int)
+	countClick := make(map[string]int)
 	var key string
 	var val int
 	for rows.Next() {
@@ -162,15 +441,56 @@ func (d *DataBase) CountClicksByUserAgent(ctx context.Context, linkID int) (map[
 			&val,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("ошибка при сканировании строки запроса в CountClicksByUserAgent: %w", err)
+			return nil, fmt.Errorf("ошибка при сканировании строки запроса в %s: %w", caller, err)
 		}
 
-		userAgentCountClick[key] = val
+		countClick[key] = val
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при итерации по списку записей в CountClicksByUserAgent: %w", err)
+		return nil, fmt.Errorf("ошибка при итерации по списку записей в %s: %w", caller, err)
+	}
+
+	return countClick, nil
+}
+
+// CountClicksByCountry - группировка по странам (ISO-код)
+func (d *DataBase) CountClicksByCountry(ctx context.Context, linkID int, isBot bool) (map[string]int, error) {
+
+	return d.CountClicksByDimension(ctx, linkID, DimensionCountry, isBot)
+}
+
+// CountClicksByCity - группировка по городам (город и ISO-код страны, т.к. названия городов повторяются)
+func (d *DataBase) CountClicksByCity(ctx context.Context, linkID int, isBot bool) (map[string]int, error) {
+
+	return d.CountClicksByDimension(ctx, linkID, DimensionCity, isBot)
+}
+
+// likeEscaper экранирует спецсимволы шаблона LIKE, чтобы подстрока искалась буквально (как в SQLite и памяти)
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike экранирует подстроку для шаблона '%' || $n || '%'
+func escapeLike(s string) string {
+
+	return likeEscaper.Replace(s)
+}
+
+// nullString превращает пустую строку в NULL (неизвестное значение)
+func nullString(s string) *string {
+
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
+
+// nullInt превращает ноль в NULL (неизвестное значение)
+func nullInt(n int) *int {
+
+	if n == 0 {
+		return nil
 	}
 
-	return userAgentCountClick, nil
+	return &n
 }
@@ -0,0 +1,478 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// errStopStream - ошибка, которой проверка прерывает выгрузку переходов
+var errStopStream = errors.New("выгрузка прервана проверкой")
+
+// sameClick сравнивает запись о переходе из хранилища с сохранённой (идентификатор не сравнивается)
+func sameClick(caller string, got, want *db.Analytics) error {
+
+	switch {
+	case got.LinkID != want.LinkID:
+		return fmt.Errorf("%s: LinkID %d, ожидался %d", caller, got.LinkID, want.LinkID)
+	case !sameTime(got.AccessedAt, want.AccessedAt):
+		return fmt.Errorf("%s: AccessedAt %v, ожидался %v", caller, got.AccessedAt, want.AccessedAt)
+	case got.UserAgent != want.UserAgent:
+		return fmt.Errorf("%s: UserAgent %q, ожидался %q", caller, got.UserAgent, want.UserAgent)
+	case !got.IPAddress.Equal(want.IPAddress) && (len(got.IPAddress) != 0 || len(want.IPAddress) != 0):
+		return fmt.Errorf("%s: IPAddress %v, ожидался %v", caller, got.IPAddress, want.IPAddress)
+	case got.Referer != want.Referer:
+		return fmt.Errorf("%s: Referer %q, ожидался %q", caller, got.Referer, want.Referer)
+	case got.IsBot != want.IsBot || got.IsRepeat != want.IsRepeat:
+		return fmt.Errorf("%s: IsBot/IsRepeat %v/%v, ожидались %v/%v", caller, got.IsBot, got.IsRepeat, want.IsBot, want.IsRepeat)
+	}
+
+	gotUA := []string{got.Browser, got.BrowserVersion, got.OS, got.OSVersion, got.Device}
+	wantUA := []string{want.Browser, want.BrowserVersion, want.OS, want.OSVersion, want.Device}
+	if !slices.Equal(gotUA, wantUA) {
+		return fmt.Errorf("%s: разбор User-Agent %v, ожидался %v", caller, gotUA, wantUA)
+	}
+
+	gotGeo := fmt.Sprint(got.Country, got.Region, got.City, got.ASN, got.ASOrg)
+	wantGeo := fmt.Sprint(want.Country, want.Region, want.City, want.ASN, want.ASOrg)
+	if gotGeo != wantGeo {
+		return fmt.Errorf("%s: местоположение %q, ожидалось %q", caller, gotGeo, wantGeo)
+	}
+
+	return nil
+}
+
+// userAgents возвращает User-Agent переходов в порядке списка (по ним проверки отличают записи)
+func userAgents(clicks []*db.Analytics) []string {
+
+	agents := make([]string, len(clicks))
+	for i, a := range clicks {
+		agents[i] = a.UserAgent
+	}
+
+	return agents
+}
+
+// sameUserAgents сравнивает список переходов с ожидаемым по User-Agent с учётом порядка
+func sameUserAgents(caller string, got []*db.Analytics, want ...string) error {
+
+	if agents := userAgents(got); !slices.Equal(agents, want) {
+		return fmt.Errorf("%s: ожидались переходы %v, получены %v", caller, want, agents)
+	}
+
+	return nil
+}
+
+// checkClickLog проверяет запись переходов, журнал с фильтрами и выгрузку
+func checkClickLog(ctx context.Context, s *suite) error {
+
+	owner, err := s.owner(ctx)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+	link, err := s.link(ctx, owner)
+	if err != nil {
+		return fmt.Errorf("CreateLink: %w", err)
+	}
+	other, err := s.link(ctx, owner)
+	if err != nil {
+		return fmt.Errorf("CreateLink: %w", err)
+	}
+
+	t0 := time.Now()
+
+	plain := &db.Analytics{
+		LinkID:     link.ID,
+		AccessedAt: t0,
+		UserAgent:  "ua-plain",
+		IPAddress:  net.ParseIP("192.0.2.1"),
+	}
+	err = s.storage.SaveAnalytics(ctx, plain.LinkID, plain.AccessedAt, plain.UserAgent, plain.IPAddress.String(), "", false)
+	if err != nil {
+		return fmt.Errorf("SaveAnalytics: %w", err)
+	}
+
+	enriched := &db.Analytics{
+		LinkID:         link.ID,
+		AccessedAt:     t0.Add(time.Second),
+		UserAgent:      "ua-chrome",
+		IPAddress:      net.ParseIP("2001:db8::1"),
+		Referer:        "https://Search.Example.com/q",
+		IsRepeat:       true,
+		Browser:        "Chrome",
+		BrowserVersion: "120",
+		OS:             "Windows",
+		OSVersion:      "10",
+		Device:         "desktop",
+		Country:        "DE",
+		Region:         "Berlin",
+		City:           "Berlin",
+		ASN:            3320,
+		ASOrg:          "Deutsche Telekom",
+	}
+	bot := &db.Analytics{
+		LinkID:     link.ID,
+		AccessedAt: t0.Add(2 * time.Second),
+		UserAgent:  "ua-bot",
+		IPAddress:  net.ParseIP("192.0.2.3"),
+		IsBot:      true,
+		Browser:    "Googlebot",
+		OS:         "Other",
+		Device:     "bot",
+	}
+	foreign := &db.Analytics{
+		LinkID:     other.ID,
+		AccessedAt: t0.Add(3 * time.Second),
+		UserAgent:  "ua-other",
+		IPAddress:  net.ParseIP("192.0.2.4"),
+	}
+
+	if err = s.storage.SaveAnalyticsBatch(ctx, []*db.Analytics{enriched, bot, foreign}); err != nil {
+		return fmt.Errorf("SaveAnalyticsBatch: %w", err)
+	}
+	if err = s.storage.SaveAnalyticsBatch(ctx, nil); err != nil {
+		return fmt.Errorf("SaveAnalyticsBatch (пусто): %w", err)
+	}
+
+	// журнал идёт от новых к старым и хранит все поля записи
+	clicks, err := s.storage.GetClicks(ctx, link.ID, db.ClickFilter{}, 0, 10)
+	if err != nil {
+		return fmt.Errorf("GetClicks: %w", err)
+	}
+	if err = sameUserAgents("GetClicks", clicks, "ua-bot", "ua-chrome", "ua-plain"); err != nil {
+		return err
+	}
+	for i, want := range []*db.Analytics{bot, enriched, plain} {
+		if err = sameClick("GetClicks", clicks[i], want); err != nil {
+			return err
+		}
+	}
+	if clicks[0].ID <= clicks[1].ID || clicks[1].ID <= clicks[2].ID {
+		return fmt.Errorf("GetClicks: идентификаторы должны убывать, получены %d, %d, %d", clicks[0].ID, clicks[1].ID, clicks[2].ID)
+	}
+
+	page, err := s.storage.GetClicks(ctx, link.ID, db.ClickFilter{}, 0, 2)
+	if err != nil {
+		return fmt.Errorf("GetClicks: %w", err)
+	}
+	if err = sameUserAgents("GetClicks (первая страница)", page, "ua-bot", "ua-chrome"); err != nil {
+		return err
+	}
+	page, err = s.storage.GetClicks(ctx, link.ID, db.ClickFilter{}, page[1].ID, 2)
+	if err != nil {
+		return fmt.Errorf("GetClicks: %w", err)
+	}
+	if err = sameUserAgents("GetClicks (вторая страница)", page, "ua-plain"); err != nil {
+		return err
+	}
+
+	human, isBot := false, true
+	from, to := t0.Add(time.Second), t0.Add(2*time.Second)
+
+	filters := []struct {
+		name   string
+		filter db.ClickFilter
+		want   []string
+	}{
+		{"Referer", db.ClickFilter{Referer: "search.EXAMPLE"}, []string{"ua-chrome"}},
+		{"Referer (% и _ буквально)", db.ClickFilter{Referer: "search_example%"}, nil},
+		{"Device", db.ClickFilter{Device: "bot"}, []string{"ua-bot"}},
+		{"IsBot", db.ClickFilter{IsBot: &human}, []string{"ua-chrome", "ua-plain"}},
+		{"From/To", db.ClickFilter{From: &from, To: &to}, []string{"ua-chrome"}},
+	}
+	for _, f := range filters {
+		clicks, err = s.storage.GetClicks(ctx, link.ID, f.filter, 0, 10)
+		if err != nil {
+			return fmt.Errorf("GetClicks (%s): %w", f.name, err)
+		}
+		if err = sameUserAgents("GetClicks ("+f.name+")", clicks, f.want...); err != nil {
+			return err
+		}
+	}
+
+	// выгрузка идёт от старых к новым и подписывает переходы короткой ссылкой
+	stream := func(caller string, linkID, ownerID *int, filter db.ClickFilter, want ...string) error {
+		var got []string
+		err := s.storage.StreamClicks(ctx, linkID, ownerID, filter, func(shortURL string, a *db.Analytics) error {
+			expected := link.ShortURL
+			if a.LinkID == other.ID {
+				expected = other.ShortURL
+			}
+			if shortURL != expected {
+				return fmt.Errorf("%s: переход по ссылке %d подписан %q", caller, a.LinkID, shortURL)
+			}
+			got = append(got, a.UserAgent)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", caller, err)
+		}
+		if !slices.Equal(got, want) {
+			return fmt.Errorf("%s: ожидались переходы %v, получены %v", caller, want, got)
+		}
+		return nil
+	}
+
+	if err = stream("StreamClicks (ссылка)", &link.ID, nil, db.ClickFilter{}, "ua-plain", "ua-chrome", "ua-bot"); err != nil {
+		return err
+	}
+	if err = stream("StreamClicks (владелец)", nil, owner, db.ClickFilter{}, "ua-plain", "ua-chrome", "ua-bot", "ua-other"); err != nil {
+		return err
+	}
+	if err = stream("StreamClicks (IsBot)", nil, owner, db.ClickFilter{IsBot: &isBot}, "ua-bot"); err != nil {
+		return err
+	}
+
+	// ошибка fn прерывает выгрузку и возвращается как есть
+	calls := 0
+	err = s.storage.StreamClicks(ctx, nil, owner, db.ClickFilter{}, func(string, *db.Analytics) error {
+		calls++
+		return errStopStream
+	})
+	if !errors.Is(err, errStopStream) || calls != 1 {
+		return fmt.Errorf("StreamClicks: ошибка fn не прервала выгрузку (вызовов %d, ошибка %v)", calls, err)
+	}
+
+	return nil
+}
+
+// checkAggregates проверяет подсчёт и группировку переходов
+func checkAggregates(ctx context.Context, s *suite) error {
+
+	link, err := s.link(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("CreateLink: %w", err)
+	}
+
+	// переходы за сегодня и послезавтра, чтобы дни не были свёрнуты в сводки
+	t0 := time.Now()
+
+	humans := []*db.Analytics{
+		{
+			LinkID: link.ID, AccessedAt: t0, UserAgent: "ua-chrome", Referer: "https://www.Example.com/x",
+			Browser: "Chrome", BrowserVersion: "120", OS: "Windows", OSVersion: "10", Device: "desktop",
+			Country: "DE", Region: "Berlin", City: "Berlin", ASN: 3320, ASOrg: "Deutsche Telekom",
+		},
+		{
+			LinkID: link.ID, AccessedAt: t0.Add(time.Second), UserAgent: "ua-firefox",
+			Browser: "Firefox", BrowserVersion: "121", OS: "Linux", Device: "desktop",
+		},
+		{
+			LinkID: link.ID, AccessedAt: t0.Add(48 * time.Hour), UserAgent: "ua-mobile", Referer: "https://t.co/abc",
+			Browser: "Chrome", BrowserVersion: "120", OS: "Android", OSVersion: "14", Device: "mobile",
+			Country: "US", Region: "California", City: "Mountain View", ASN: 15169,
+		},
+	}
+	bot := &db.Analytics{
+		LinkID: link.ID, AccessedAt: t0, UserAgent: "ua-bot", IsBot: true,
+		Browser: "Googlebot", OS: "Other", OSVersion: "Other", Device: "bot",
+	}
+
+	if err = s.storage.SaveAnalyticsBatch(ctx, append(slices.Clone(humans), bot)); err != nil {
+		return fmt.Errorf("SaveAnalyticsBatch: %w", err)
+	}
+
+	count, err := s.storage.CountClicks(ctx, link.ID, false)
+	if err != nil {
+		return fmt.Errorf("CountClicks: %w", err)
+	}
+	if count != len(humans) {
+		return fmt.Errorf("CountClicks: ожидалось %d переходов людей, получено %d", len(humans), count)
+	}
+	count, err = s.storage.CountClicks(ctx, link.ID, true)
+	if err != nil {
+		return fmt.Errorf("CountClicks: %w", err)
+	}
+	if count != 1 {
+		return fmt.Errorf("CountClicks: ожидался 1 переход бота, получено %d", count)
+	}
+
+	dimensions := []struct {
+		dimension string
+		want      map[string]int
+	}{
+		{db.DimensionBrowser, map[string]int{"Chrome": 2, "Firefox": 1}},
+		{db.DimensionBrowserVersion, map[string]int{"Chrome 120": 2, "Firefox 121": 1}},
+		{db.DimensionOS, map[string]int{"Windows": 1, "Linux": 1, "Android": 1}},
+		{db.DimensionOSVersion, map[string]int{"Windows 10": 1, "Linux": 1, "Android 14": 1}},
+		{db.DimensionDevice, map[string]int{"desktop": 2, "mobile": 1}},
+		{db.DimensionCountry, map[string]int{"DE": 1, "unknown": 1, "US": 1}},
+		{db.DimensionRegion, map[string]int{"Berlin, DE": 1, "unknown": 1, "California, US": 1}},
+		{db.DimensionCity, map[string]int{"Berlin, DE": 1, "unknown": 1, "Mountain View, US": 1}},
+		{db.DimensionASN, map[string]int{"AS3320 Deutsche Telekom": 1, "unknown": 1, "AS15169": 1}},
+		{db.DimensionReferer, map[string]int{"www.example.com": 1, "direct": 1, "t.co": 1}},
+		{db.DimensionUserAgent, map[string]int{"ua-chrome": 1, "ua-firefox": 1, "ua-mobile": 1}},
+	}
+	for _, d := range dimensions {
+		counts, err := s.storage.CountClicksByDimension(ctx, link.ID, d.dimension, false)
+		if err != nil {
+			return fmt.Errorf("CountClicksByDimension (%s): %w", d.dimension, err)
+		}
+		if err = sameCounts("CountClicksByDimension ("+d.dimension+")", counts, d.want); err != nil {
+			return err
+		}
+	}
+
+	counts, err := s.storage.CountClicksByDimension(ctx, link.ID, db.DimensionDevice, true)
+	if err != nil {
+		return fmt.Errorf("CountClicksByDimension (боты): %w", err)
+	}
+	if err = sameCounts("CountClicksByDimension (боты)", counts, map[string]int{"bot": 1}); err != nil {
+		return err
+	}
+
+	if _, err = s.storage.CountClicksByDimension(ctx, link.ID, "color", false); err == nil {
+		return fmt.Errorf("CountClicksByDimension: неизвестное измерение не отклонено")
+	}
+
+	shortcuts := []struct {
+		name  string
+		count func(ctx context.Context, linkID int, isBot bool) (map[string]int, error)
+		want  map[string]int
+	}{
+		{"CountClicksByUserAgent", s.storage.CountClicksByUserAgent, map[string]int{"ua-chrome": 1, "ua-firefox": 1, "ua-mobile": 1}},
+		{"CountClicksByCountry", s.storage.CountClicksByCountry, map[string]int{"DE": 1, "unknown": 1, "US": 1}},
+		{"CountClicksByCity", s.storage.CountClicksByCity, map[string]int{"Berlin, DE": 1, "unknown": 1, "Mountain View, US": 1}},
+	}
+	for _, c := range shortcuts {
+		counts, err := c.count(ctx, link.ID, false)
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.name, err)
+		}
+		if err = sameCounts(c.name, counts, c.want); err != nil {
+			return err
+		}
+	}
+
+	// дни и месяцы считаются в UTC
+	from, to := t0.Add(-24*time.Hour), t0.Add(72*time.Hour)
+	for _, layout := range []struct {
+		name  string
+		count func(ctx context.Context, linkID int, from, to time.Time, isBot bool) (map[string]int, error)
+		key   string
+	}{
+		{"CountClicksByDay", s.storage.CountClicksByDay, time.DateOnly},
+		{"CountClicksByMonth", s.storage.CountClicksByMonth, "2006-01"},
+	} {
+		want := make(map[string]int)
+		for _, a := range humans {
+			want[a.AccessedAt.UTC().Format(layout.key)]++
+		}
+
+		counts, err := layout.count(ctx, link.ID, from, to, false)
+		if err != nil {
+			return fmt.Errorf("%s: %w", layout.name, err)
+		}
+		if err = sameCounts(layout.name, counts, want); err != nil {
+			return err
+		}
+
+		counts, err = layout.count(ctx, link.ID, from, to, true)
+		if err != nil {
+			return fmt.Errorf("%s: %w", layout.name, err)
+		}
+		if err = sameCounts(layout.name+" (боты)", counts, map[string]int{t0.UTC().Format(layout.key): 1}); err != nil {
+			return err
+		}
+	}
+
+	timelines := []struct {
+		granularity, tz string
+		from, to        time.Time
+	}{
+		{db.GranularityDay, "UTC", from, to},
+		{db.GranularityWeek, "UTC", from, to},
+		{db.GranularityHour, "Asia/Kolkata", t0.Add(-time.Hour), t0.Add(49 * time.Hour)},
+	}
+	for _, tl := range timelines {
+		if err = checkTimeline(ctx, s, link.ID, humans, tl.from, tl.to, tl.granularity, tl.tz); err != nil {
+			return err
+		}
+	}
+
+	if _, err = s.storage.CountRolledVisitors(ctx, link.ID, from, to); err != nil {
+		return fmt.Errorf("CountRolledVisitors: %w", err)
+	}
+
+	return nil
+}
+
+// checkTimeline проверяет временную шкалу CountClicksByPeriod: шаги выровнены по началу шага
+// в часовом поясе tz, идут подряд, покрывают [from, to) и содержат переходы clicks из своего интервала
+func checkTimeline(ctx context.Context, s *suite, linkID int, clicks []*db.Analytics, from, to time.Time, granularity, tz string) error {
+
+	caller := fmt.Sprintf("CountClicksByPeriod (%s, %s)", granularity, tz)
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return fmt.Errorf("%s: %w", caller, err)
+	}
+
+	buckets, err := s.storage.CountClicksByPeriod(ctx, linkID, from, to, granularity, tz, false)
+	if err != nil {
+		return fmt.Errorf("%s: %w", caller, err)
+	}
+	if len(buckets) == 0 {
+		return fmt.Errorf("%s: пустая шкала", caller)
+	}
+
+	next := func(start time.Time) time.Time {
+		start = start.In(loc)
+		switch granularity {
+		case db.GranularityHour:
+			return start.Add(time.Hour)
+		case db.GranularityWeek:
+			return start.AddDate(0, 0, 7)
+		}
+		return start.AddDate(0, 0, 1)
+	}
+
+	aligned := func(start time.Time) bool {
+		wall := start.In(loc)
+		if wall.Minute() != 0 || wall.Second() != 0 || wall.Nanosecond() != 0 {
+			return false
+		}
+		switch granularity {
+		case db.GranularityDay:
+			return wall.Hour() == 0
+		case db.GranularityWeek:
+			return wall.Hour() == 0 && wall.Weekday() == time.Monday
+		}
+		return true
+	}
+
+	first, last := buckets[0].Start, buckets[len(buckets)-1].Start
+	if first.After(from) || !next(first).After(from) {
+		return fmt.Errorf("%s: первый шаг %v не содержит начало периода %v", caller, first, from)
+	}
+	if !next(last).After(to.Add(-time.Microsecond)) || !last.Before(to) {
+		return fmt.Errorf("%s: последний шаг %v не содержит конец периода %v", caller, last, to)
+	}
+
+	for i, b := range buckets {
+		if !aligned(b.Start) {
+			return fmt.Errorf("%s: шаг %v не выровнен в часовом поясе %s", caller, b.Start, tz)
+		}
+		if i > 0 && !b.Start.Equal(next(buckets[i-1].Start)) {
+			return fmt.Errorf("%s: после шага %v идёт %v", caller, buckets[i-1].Start, b.Start)
+		}
+
+		want := 0
+		for _, a := range clicks {
+			if !a.AccessedAt.Before(b.Start) && a.AccessedAt.Before(next(b.Start)) &&
+				!a.AccessedAt.Before(from) && a.AccessedAt.Before(to) {
+				want++
+			}
+		}
+		if b.Clicks != want {
+			return fmt.Errorf("%s: в шаге %v ожидалось %d переходов, получено %d", caller, b.Start, want, b.Clicks)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,598 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// sameLink сравнивает ссылку из хранилища с ожидаемой
+func sameLink(caller string, got, want *db.Link) error {
+
+	if got == nil {
+		return fmt.Errorf("%s: ожидалась ссылка %q, получен nil", caller, want.ShortURL)
+	}
+
+	switch {
+	case got.ID != want.ID:
+		return fmt.Errorf("%s: ID %d, ожидался %d", caller, got.ID, want.ID)
+	case got.ShortURL != want.ShortURL:
+		return fmt.Errorf("%s: ShortURL %q, ожидался %q", caller, got.ShortURL, want.ShortURL)
+	case got.OriginalURL != want.OriginalURL:
+		return fmt.Errorf("%s: OriginalURL %q, ожидался %q", caller, got.OriginalURL, want.OriginalURL)
+	case !sameTime(got.CreatedAt, want.CreatedAt):
+		return fmt.Errorf("%s: CreatedAt %v, ожидался %v", caller, got.CreatedAt, want.CreatedAt)
+	case got.IsCustom != want.IsCustom:
+		return fmt.Errorf("%s: IsCustom %v, ожидался %v", caller, got.IsCustom, want.IsCustom)
+	case got.ClicksCount != want.ClicksCount || got.DedupClicksCount != want.DedupClicksCount:
+		return fmt.Errorf("%s: счётчики %d/%d, ожидались %d/%d", caller,
+			got.ClicksCount, got.DedupClicksCount, want.ClicksCount, want.DedupClicksCount)
+	case !sameTimePtr(got.ExpiresAt, want.ExpiresAt):
+		return fmt.Errorf("%s: ExpiresAt %v, ожидался %v", caller, got.ExpiresAt, want.ExpiresAt)
+	case !sameIntPtr(got.MaxClicks, want.MaxClicks):
+		return fmt.Errorf("%s: MaxClicks %v, ожидался %v", caller, got.MaxClicks, want.MaxClicks)
+	case !sameTimePtr(got.DeletedAt, want.DeletedAt):
+		return fmt.Errorf("%s: DeletedAt %v, ожидался %v", caller, got.DeletedAt, want.DeletedAt)
+	case !sameIntPtr(got.OwnerID, want.OwnerID):
+		return fmt.Errorf("%s: OwnerID %v, ожидался %v", caller, got.OwnerID, want.OwnerID)
+	case got.RedirectType != want.RedirectType:
+		return fmt.Errorf("%s: RedirectType %q, ожидался %q", caller, got.RedirectType, want.RedirectType)
+	case got.PassQuery != want.PassQuery:
+		return fmt.Errorf("%s: PassQuery %v, ожидался %v", caller, got.PassQuery, want.PassQuery)
+	}
+
+	return nil
+}
+
+// shortURLs возвращает короткие идентификаторы ссылок в порядке списка
+func shortURLs(links []*db.Link) []string {
+
+	codes := make([]string, len(links))
+	for i, link := range links {
+		codes[i] = link.ShortURL
+	}
+
+	return codes
+}
+
+// sameShortURLs сравнивает списки ссылок по коротким идентификаторам (ordered - с учётом порядка)
+func sameShortURLs(caller string, got []*db.Link, want []string, ordered bool) error {
+
+	codes := shortURLs(got)
+	if !ordered {
+		slices.Sort(codes)
+		want = slices.Sorted(slices.Values(want))
+	}
+
+	if !slices.Equal(codes, want) {
+		return fmt.Errorf("%s: ожидались ссылки %v, получены %v", caller, want, codes)
+	}
+
+	return nil
+}
+
+// checkCreateLink проверяет создание ссылок, резервирование идентификаторов и поиск по короткой ссылке
+func checkCreateLink(ctx context.Context, s *suite) error {
+
+	owner, err := s.owner(ctx)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+
+	shortURL := s.name("custom")
+	link, err := s.storage.CreateLink(ctx, "https://example.com/"+shortURL, shortURL, true, db.LinkOptions{OwnerID: owner})
+	if err != nil {
+		return fmt.Errorf("CreateLink: %w", err)
+	}
+
+	// по умолчанию ссылка бессрочная, без бюджета и с временным перенаправлением
+	want := &db.Link{
+		ID:           link.ID,
+		ShortURL:     shortURL,
+		OriginalURL:  "https://example.com/" + shortURL,
+		CreatedAt:    link.CreatedAt,
+		IsCustom:     true,
+		OwnerID:      owner,
+		RedirectType: db.RedirectFound,
+	}
+	if err = sameLink("CreateLink", link, want); err != nil {
+		return err
+	}
+	if link.ID == 0 {
+		return fmt.Errorf("CreateLink: не назначен идентификатор")
+	}
+	if time.Since(link.CreatedAt).Abs() > clockSkew {
+		return fmt.Errorf("CreateLink: неверное время создания %v", link.CreatedAt)
+	}
+
+	found, err := s.storage.GetLinkByShortURL(ctx, shortURL)
+	if err != nil {
+		return fmt.Errorf("GetLinkByShortURL: %w", err)
+	}
+	if err = sameLink("GetLinkByShortURL", found, want); err != nil {
+		return err
+	}
+
+	missing, err := s.storage.GetLinkByShortURL(ctx, s.name("missing"))
+	if err != nil {
+		return fmt.Errorf("GetLinkByShortURL (неизвестная ссылка): %w", err)
+	}
+	if missing != nil {
+		return fmt.Errorf("GetLinkByShortURL (неизвестная ссылка): ожидался nil, получена %q", missing.ShortURL)
+	}
+
+	if _, err = s.storage.CreateLink(ctx, "https://example.com/other", shortURL, true, db.LinkOptions{}); !errors.Is(err, db.ErrShortURLExists) {
+		return fmt.Errorf("CreateLink (занятая короткая ссылка): ожидалась ErrShortURLExists, получено %v", err)
+	}
+
+	// зарезервированный идентификатор используется как есть, следующие не совпадают с ним
+	reservedID, err := s.storage.NextLinkID(ctx)
+	if err != nil {
+		return fmt.Errorf("NextLinkID: %w", err)
+	}
+	nextID, err := s.storage.NextLinkID(ctx)
+	if err != nil {
+		return fmt.Errorf("NextLinkID: %w", err)
+	}
+	if nextID <= reservedID {
+		return fmt.Errorf("NextLinkID: идентификаторы должны возрастать, получены %d и %d", reservedID, nextID)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	maxClicks := 5
+	reservedURL := s.name("reserved")
+	reserved, err := s.storage.CreateLink(ctx, "https://example.com/reserved", reservedURL, false, db.LinkOptions{
+		ID:           reservedID,
+		ExpiresAt:    &expiresAt,
+		MaxClicks:    &maxClicks,
+		RedirectType: db.RedirectPermanent,
+		PassQuery:    true,
+	})
+	if err != nil {
+		return fmt.Errorf("CreateLink (зарезервированный идентификатор): %w", err)
+	}
+
+	want = &db.Link{
+		ID:           reservedID,
+		ShortURL:     reservedURL,
+		OriginalURL:  "https://example.com/reserved",
+		CreatedAt:    reserved.CreatedAt,
+		ExpiresAt:    &expiresAt,
+		MaxClicks:    &maxClicks,
+		RedirectType: db.RedirectPermanent,
+		PassQuery:    true,
+	}
+	if err = sameLink("CreateLink (зарезервированный идентификатор)", reserved, want); err != nil {
+		return err
+	}
+
+	found, err = s.storage.GetLinkByShortURL(ctx, reservedURL)
+	if err != nil {
+		return fmt.Errorf("GetLinkByShortURL: %w", err)
+	}
+	if err = sameLink("GetLinkByShortURL (зарезервированный идентификатор)", found, want); err != nil {
+		return err
+	}
+
+	auto, err := s.link(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("CreateLink: %w", err)
+	}
+	if auto.ID == link.ID || auto.ID == reservedID || auto.ID == nextID {
+		return fmt.Errorf("CreateLink: назначен уже выданный идентификатор %d", auto.ID)
+	}
+
+	return nil
+}
+
+// checkFindLinks проверяет поиск ссылок по оригинальному URL и подстрокам
+func checkFindLinks(ctx context.Context, s *suite) error {
+
+	owner, err := s.owner(ctx)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+	other, err := s.owner(ctx)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+
+	marker := s.name("Find")
+	originalURL := "https://Example.com/" + marker
+
+	create := func(ownerID *int) (*db.Link, error) {
+		shortURL := s.name("find")
+		return s.storage.CreateLink(ctx, originalURL, shortURL, false, db.LinkOptions{OwnerID: ownerID})
+	}
+
+	own, err := create(owner)
+	if err != nil {
+		return fmt.Errorf("CreateLink: %w", err)
+	}
+	foreign, err := create(other)
+	if err != nil {
+		return fmt.Errorf("CreateLink: %w", err)
+	}
+	deleted, err := create(owner)
+	if err != nil {
+		return fmt.Errorf("CreateLink: %w", err)
+	}
+	if _, err = s.storage.DeleteLink(ctx, deleted.ShortURL); err != nil {
+		return fmt.Errorf("DeleteLink: %w", err)
+	}
+
+	links, err := s.storage.GetLinkByOriginalURL(ctx, originalURL, owner)
+	if err != nil {
+		return fmt.Errorf("GetLinkByOriginalURL: %w", err)
+	}
+	if err = sameShortURLs("GetLinkByOriginalURL (владелец)", links, []string{own.ShortURL}, false); err != nil {
+		return err
+	}
+
+	links, err = s.storage.GetLinkByOriginalURL(ctx, originalURL, nil)
+	if err != nil {
+		return fmt.Errorf("GetLinkByOriginalURL: %w", err)
+	}
+	if err = sameShortURLs("GetLinkByOriginalURL (все владельцы)", links, []string{own.ShortURL, foreign.ShortURL}, false); err != nil {
+		return err
+	}
+
+	// поиск подстроки не учитывает регистр и пропускает ссылки из корзины
+	links, err = s.storage.SearchByOriginalURL(ctx, strings.ToUpper(marker), owner)
+	if err != nil {
+		return fmt.Errorf("SearchByOriginalURL: %w", err)
+	}
+	if err = sameShortURLs("SearchByOriginalURL", links, []string{own.ShortURL}, false); err != nil {
+		return err
+	}
+
+	links, err = s.storage.SearchByOriginalURL(ctx, marker, nil)
+	if err != nil {
+		return fmt.Errorf("SearchByOriginalURL: %w", err)
+	}
+	if err = sameShortURLs("SearchByOriginalURL (все владельцы)", links, []string{own.ShortURL, foreign.ShortURL}, false); err != nil {
+		return err
+	}
+
+	links, err = s.storage.SearchByShortURL(ctx, strings.ToUpper(own.ShortURL), nil)
+	if err != nil {
+		return fmt.Errorf("SearchByShortURL: %w", err)
+	}
+	if err = sameShortURLs("SearchByShortURL", links, []string{own.ShortURL}, false); err != nil {
+		return err
+	}
+
+	links, err = s.storage.SearchByShortURL(ctx, s.prefix+"-find-", other)
+	if err != nil {
+		return fmt.Errorf("SearchByShortURL: %w", err)
+	}
+	if err = sameShortURLs("SearchByShortURL (владелец)", links, []string{foreign.ShortURL}, false); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// checkUpdateLink проверяет изменение параметров ссылки
+func checkUpdateLink(ctx context.Context, s *suite) error {
+
+	link, err := s.link(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("CreateLink: %w", err)
+	}
+
+	originalURL := "https://example.org/updated"
+	expiresAt := time.Now().Add(24 * time.Hour)
+	maxClicks := 10
+	redirectType := db.RedirectMovedPermanently
+	passQuery := true
+
+	updated, err := s.storage.UpdateLink(ctx, link.ShortURL, db.LinkUpdate{
+		OriginalURL:  &originalURL,
+		ExpiresAt:    &expiresAt,
+		MaxClicks:    &maxClicks,
+		RedirectType: &redirectType,
+		PassQuery:    &passQuery,
+	})
+	if err != nil {
+		return fmt.Errorf("UpdateLink: %w", err)
+	}
+
+	want := *link
+	want.OriginalURL = originalURL
+	want.ExpiresAt = &expiresAt
+	want.MaxClicks = &maxClicks
+	want.RedirectType = redirectType
+	want.PassQuery = passQuery
+	if err = sameLink("UpdateLink", updated, &want); err != nil {
+		return err
+	}
+
+	found, err := s.storage.GetLinkByShortURL(ctx, link.ShortURL)
+	if err != nil {
+		return fmt.Errorf("GetLinkByShortURL: %w", err)
+	}
+	if err = sameLink("GetLinkByShortURL (после UpdateLink)", found, &want); err != nil {
+		return err
+	}
+
+	// поиск по оригинальному URL следует за изменением адреса
+	byOld, err := s.storage.GetLinkByOriginalURL(ctx, link.OriginalURL, nil)
+	if err != nil {
+		return fmt.Errorf("GetLinkByOriginalURL: %w", err)
+	}
+	if slices.Contains(shortURLs(byOld), link.ShortURL) {
+		return fmt.Errorf("GetLinkByOriginalURL: ссылка %q найдена по прежнему адресу", link.ShortURL)
+	}
+	byNew, err := s.storage.GetLinkByOriginalURL(ctx, originalURL, nil)
+	if err != nil {
+		return fmt.Errorf("GetLinkByOriginalURL: %w", err)
+	}
+	if !slices.Contains(shortURLs(byNew), link.ShortURL) {
+		return fmt.Errorf("GetLinkByOriginalURL: ссылка %q не найдена по новому адресу", link.ShortURL)
+	}
+
+	// сброс ограничений не трогает поля, которые не переданы
+	updated, err = s.storage.UpdateLink(ctx, link.ShortURL, db.LinkUpdate{ResetExpiresAt: true, ResetMaxClicks: true})
+	if err != nil {
+		return fmt.Errorf("UpdateLink (сброс ограничений): %w", err)
+	}
+
+	want.ExpiresAt = nil
+	want.MaxClicks = nil
+	if err = sameLink("UpdateLink (сброс ограничений)", updated, &want); err != nil {
+		return err
+	}
+
+	missing, err := s.storage.UpdateLink(ctx, s.name("missing"), db.LinkUpdate{OriginalURL: &originalURL})
+	if err != nil {
+		return fmt.Errorf("UpdateLink (неизвестная ссылка): %w", err)
+	}
+	if missing != nil {
+		return fmt.Errorf("UpdateLink (неизвестная ссылка): ожидался nil, получена %q", missing.ShortURL)
+	}
+
+	return nil
+}
+
+// checkTrash проверяет корзину: удаление, восстановление и список удалённых ссылок
+func checkTrash(ctx context.Context, s *suite) error {
+
+	owner, err := s.owner(ctx)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+
+	first, err := s.link(ctx, owner)
+	if err != nil {
+		return fmt.Errorf("CreateLink: %w", err)
+	}
+	second, err := s.link(ctx, owner)
+	if err != nil {
+		return fmt.Errorf("CreateLink: %w", err)
+	}
+
+	deleted, err := s.storage.DeleteLink(ctx, first.ShortURL)
+	if err != nil {
+		return fmt.Errorf("DeleteLink: %w", err)
+	}
+	if deleted == nil || deleted.DeletedAt == nil {
+		return fmt.Errorf("DeleteLink: ожидалась ссылка с DeletedAt, получена %+v", deleted)
+	}
+	if time.Since(*deleted.DeletedAt).Abs() > clockSkew {
+		return fmt.Errorf("DeleteLink: неверное время удаления %v", *deleted.DeletedAt)
+	}
+
+	// короткая ссылка в корзине остаётся занятой
+	if _, err = s.storage.CreateLink(ctx, first.OriginalURL, first.ShortURL, true, db.LinkOptions{}); !errors.Is(err, db.ErrShortURLExists) {
+		return fmt.Errorf("CreateLink (ссылка в корзине): ожидалась ErrShortURLExists, получено %v", err)
+	}
+
+	again, err := s.storage.DeleteLink(ctx, first.ShortURL)
+	if err != nil {
+		return fmt.Errorf("DeleteLink (повторно): %w", err)
+	}
+	if again != nil {
+		return fmt.Errorf("DeleteLink (повторно): ожидался nil для ссылки в корзине")
+	}
+
+	// ссылка из корзины находится по короткому идентификатору, но не изменяется
+	found, err := s.storage.GetLinkByShortURL(ctx, first.ShortURL)
+	if err != nil {
+		return fmt.Errorf("GetLinkByShortURL: %w", err)
+	}
+	if err = sameLink("GetLinkByShortURL (ссылка в корзине)", found, deleted); err != nil {
+		return err
+	}
+
+	originalURL := "https://example.org/trash"
+	updated, err := s.storage.UpdateLink(ctx, first.ShortURL, db.LinkUpdate{OriginalURL: &originalURL})
+	if err != nil {
+		return fmt.Errorf("UpdateLink (ссылка в корзине): %w", err)
+	}
+	if updated != nil {
+		return fmt.Errorf("UpdateLink (ссылка в корзине): ожидался nil")
+	}
+
+	// второе удаление позже первого, чтобы порядок корзины был однозначным
+	time.Sleep(5 * time.Millisecond)
+	if _, err = s.storage.DeleteLink(ctx, second.ShortURL); err != nil {
+		return fmt.Errorf("DeleteLink: %w", err)
+	}
+
+	trash, err := s.storage.GetDeletedLinks(ctx, owner)
+	if err != nil {
+		return fmt.Errorf("GetDeletedLinks: %w", err)
+	}
+	if err = sameShortURLs("GetDeletedLinks", trash, []string{second.ShortURL, first.ShortURL}, true); err != nil {
+		return err
+	}
+
+	active, err := s.storage.GetLinks(ctx, owner)
+	if err != nil {
+		return fmt.Errorf("GetLinks: %w", err)
+	}
+	if err = sameShortURLs("GetLinks (все ссылки в корзине)", active, nil, false); err != nil {
+		return err
+	}
+
+	restored, err := s.storage.RestoreLink(ctx, first.ShortURL)
+	if err != nil {
+		return fmt.Errorf("RestoreLink: %w", err)
+	}
+	if err = sameLink("RestoreLink", restored, first); err != nil {
+		return err
+	}
+
+	again, err = s.storage.RestoreLink(ctx, first.ShortURL)
+	if err != nil {
+		return fmt.Errorf("RestoreLink (повторно): %w", err)
+	}
+	if again != nil {
+		return fmt.Errorf("RestoreLink (повторно): ожидался nil для активной ссылки")
+	}
+
+	trash, err = s.storage.GetDeletedLinks(ctx, owner)
+	if err != nil {
+		return fmt.Errorf("GetDeletedLinks: %w", err)
+	}
+
+	return sameShortURLs("GetDeletedLinks (после RestoreLink)", trash, []string{second.ShortURL}, true)
+}
+
+// checkListLinks проверяет список последних ссылок
+func checkListLinks(ctx context.Context, s *suite) error {
+
+	const created = 22 // больше, чем возвращает GetLinks
+
+	owner, err := s.owner(ctx)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+
+	codes := make([]string, 0, created)
+	for range created {
+		link, err := s.link(ctx, owner)
+		if err != nil {
+			return fmt.Errorf("CreateLink: %w", err)
+		}
+		codes = append(codes, link.ShortURL)
+
+		// время создания различается, чтобы порядок списка был однозначным
+		time.Sleep(time.Millisecond)
+	}
+
+	// самая старая ссылка уходит в корзину и не попадает в списки
+	if _, err = s.storage.DeleteLink(ctx, codes[0]); err != nil {
+		return fmt.Errorf("DeleteLink: %w", err)
+	}
+
+	latest, err := s.storage.GetLinks(ctx, owner)
+	if err != nil {
+		return fmt.Errorf("GetLinks: %w", err)
+	}
+
+	want := slices.Clone(codes[2:])
+	slices.Reverse(want)
+	if err = sameShortURLs("GetLinks", latest, want, true); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// checkPopularLinks проверяет выбор популярных ссылок для прогрева кэша:
+// считаются только переходы за период (и переходы ботов), ссылки из корзины не попадают
+func checkPopularLinks(ctx context.Context, s *suite) error {
+
+	// число переходов за период и до него у каждой ссылки
+	clicks := []struct{ recent, old int }{{3, 0}, {1, 5}, {2, 0}, {6, 0}}
+
+	now := time.Now()
+	var codes []string
+	var records []*db.Analytics
+	for _, c := range clicks {
+		link, err := s.link(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("CreateLink: %w", err)
+		}
+		codes = append(codes, link.ShortURL)
+
+		for i := range c.recent {
+			records = append(records, &db.Analytics{LinkID: link.ID, AccessedAt: now, IsBot: i == 0})
+		}
+		for range c.old {
+			records = append(records, &db.Analytics{LinkID: link.ID, AccessedAt: now.Add(-2 * time.Hour)})
+		}
+	}
+
+	if err := s.storage.SaveAnalyticsBatch(ctx, records); err != nil {
+		return fmt.Errorf("SaveAnalyticsBatch: %w", err)
+	}
+
+	// самая популярная ссылка уходит в корзину
+	if _, err := s.storage.DeleteLink(ctx, codes[3]); err != nil {
+		return fmt.Errorf("DeleteLink: %w", err)
+	}
+
+	// в общей БД могут быть и другие ссылки, поэтому проверяется только взаимный порядок своих
+	popular, err := s.storage.GetPopularLinks(ctx, time.Hour, 100000)
+	if err != nil {
+		return fmt.Errorf("GetPopularLinks: %w", err)
+	}
+
+	var got []string
+	for _, code := range shortURLs(popular) {
+		if slices.Contains(codes, code) {
+			got = append(got, code)
+		}
+	}
+	if want := []string{codes[0], codes[2], codes[1]}; !slices.Equal(got, want) {
+		return fmt.Errorf("GetPopularLinks: ожидался порядок %v, получен %v", want, got)
+	}
+
+	limited, err := s.storage.GetPopularLinks(ctx, time.Hour, 1)
+	if err != nil {
+		return fmt.Errorf("GetPopularLinks: %w", err)
+	}
+	if len(limited) != 1 {
+		return fmt.Errorf("GetPopularLinks: ожидалась 1 ссылка при limit 1, получено %d", len(limited))
+	}
+
+	return nil
+}
+
+// checkCounters проверяет счётчики переходов ссылки
+func checkCounters(ctx context.Context, s *suite) error {
+
+	link, err := s.link(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("CreateLink: %w", err)
+	}
+
+	if err = s.storage.IncrementClicks(ctx, int64(link.ID)); err != nil {
+		return fmt.Errorf("IncrementClicks: %w", err)
+	}
+	if err = s.storage.AddClicks(ctx, map[int]db.ClickDelta{link.ID: {Raw: 3, Dedup: 2}}); err != nil {
+		return fmt.Errorf("AddClicks: %w", err)
+	}
+	if err = s.storage.AddClicks(ctx, nil); err != nil {
+		return fmt.Errorf("AddClicks (пусто): %w", err)
+	}
+
+	found, err := s.storage.GetLinkByShortURL(ctx, link.ShortURL)
+	if err != nil {
+		return fmt.Errorf("GetLinkByShortURL: %w", err)
+	}
+
+	want := *link
+	want.ClicksCount = 4
+	want.DedupClicksCount = 3
+
+	return sameLink("GetLinkByShortURL (после AddClicks)", found, &want)
+}
@@ -0,0 +1,161 @@
+package conformance
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/wb-go/wbf/logger"
+)
+
+// clockSkew - допустимое расхождение часов сервиса и сервера БД (время создания ставит сервер)
+const clockSkew = 5 * time.Minute
+
+// check - проверка одной группы методов db.Storage
+type check struct {
+	name string
+	run  func(ctx context.Context, s *suite) error
+}
+
+// checks - все проверки контракта в порядке выполнения
+var checks = []check{
+	{"users", checkUsers},
+	{"links/create", checkCreateLink},
+	{"links/find", checkFindLinks},
+	{"links/update", checkUpdateLink},
+	{"links/trash", checkTrash},
+	{"links/list", checkListLinks},
+	{"links/popular", checkPopularLinks},
+	{"links/counters", checkCounters},
+	{"analytics/log", checkClickLog},
+	{"analytics/aggregates", checkAggregates},
+	{"visitors", checkVisitors},
+	{"visitors/salt", checkVisitorSalt},
+}
+
+// suite - состояние прогона одной проверки
+type suite struct {
+	storage db.Storage
+	prefix  string // уникальная приставка имён, чтобы проверки не пересекались с данными хранилища
+	seq     int    // счётчик имён внутри проверки
+}
+
+// Run прогоняет проверки контракта db.Storage, которым должно соответствовать любое хранилище сервиса:
+// каждая проверка - отдельный подтест на хранилище из newStorage, которое Run закрывает после проверки;
+// проверки создают только свои ссылки и пользователей с уникальными именами, поэтому newStorage
+// может возвращать подключения к одной и той же (в том числе непустой) базе
+func Run(t *testing.T, newStorage func() db.Storage) {
+
+	t.Helper()
+
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			storage := newStorage()
+			if storage == nil {
+				t.Fatal("хранилище не создано")
+			}
+			defer storage.Close()
+
+			s := &suite{
+				storage: storage,
+				prefix:  "cf" + strings.ToLower(rand.Text()[:8]),
+			}
+
+			if err := c.run(t.Context(), s); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// Logger возвращает логгер для хранилищ в тестах (только ошибки, чтобы не засорять вывод go test)
+func Logger(t *testing.T) logger.Logger {
+
+	t.Helper()
+
+	log, err := logger.InitLogger(logger.SlogEngine, "UrlShortener", "test", logger.WithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("ошибка создания логгера: %v", err)
+	}
+
+	return log
+}
+
+// name возвращает новое уникальное имя для короткой ссылки или пользователя
+func (s *suite) name(label string) string {
+
+	s.seq++
+	return fmt.Sprintf("%s-%s-%d", s.prefix, label, s.seq)
+}
+
+// keyHash возвращает уникальный хэш API-ключа (64 шестнадцатеричных символа, как SHA-256)
+func (s *suite) keyHash(label string) string {
+
+	sum := sha256.Sum256([]byte(s.name(label)))
+	return hex.EncodeToString(sum[:])
+}
+
+// owner создаёт нового пользователя и возвращает его идентификатор для ограничения выборок
+func (s *suite) owner(ctx context.Context) (*int, error) {
+
+	user, err := s.storage.CreateUser(ctx, s.name("owner"), false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.ID, nil
+}
+
+// link создаёт бессрочную ссылку владельца ownerID с уникальным коротким идентификатором
+func (s *suite) link(ctx context.Context, ownerID *int) (*db.Link, error) {
+
+	shortURL := s.name("link")
+	return s.storage.CreateLink(ctx, "https://example.com/"+shortURL, shortURL, false, db.LinkOptions{OwnerID: ownerID})
+}
+
+// sameTime сравнивает моменты времени с точностью хранения PostgreSQL (микросекунды)
+func sameTime(a, b time.Time) bool {
+
+	return a.Truncate(time.Microsecond).Equal(b.Truncate(time.Microsecond))
+}
+
+// sameTimePtr сравнивает необязательные моменты времени
+func sameTimePtr(a, b *time.Time) bool {
+
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return sameTime(*a, *b)
+}
+
+// sameIntPtr сравнивает необязательные числа
+func sameIntPtr(a, b *int) bool {
+
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return *a == *b
+}
+
+// sameCounts сравнивает результаты группировки
+func sameCounts(caller string, got, want map[string]int) error {
+
+	if len(got) != len(want) {
+		return fmt.Errorf("%s: ожидалось %v, получено %v", caller, want, got)
+	}
+	for key, count := range want {
+		if got[key] != count {
+			return fmt.Errorf("%s: ожидалось %v, получено %v", caller, want, got)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// checkUsers проверяет пользователей и API-ключи
+func checkUsers(ctx context.Context, s *suite) error {
+
+	name := s.name("user")
+	user, err := s.storage.CreateUser(ctx, name, true)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+	if user.ID == 0 || user.Name != name || !user.IsAdmin {
+		return fmt.Errorf("CreateUser: неверный пользователь %+v", *user)
+	}
+	if time.Since(user.CreatedAt).Abs() > clockSkew {
+		return fmt.Errorf("CreateUser: неверное время создания %v", user.CreatedAt)
+	}
+
+	// имя занято: пользователь не создаётся заново и не меняет права
+	if _, err = s.storage.CreateUser(ctx, name, false); !errors.Is(err, db.ErrUserExists) {
+		return fmt.Errorf("CreateUser (повторно): ожидалась ErrUserExists, получено %v", err)
+	}
+
+	byName, err := s.storage.GetUserByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("GetUserByName: %w", err)
+	}
+	if byName == nil || byName.ID != user.ID || !byName.IsAdmin {
+		return fmt.Errorf("GetUserByName: ожидался пользователь %d, получен %+v", user.ID, byName)
+	}
+
+	missing, err := s.storage.GetUserByName(ctx, s.name("missing"))
+	if err != nil {
+		return fmt.Errorf("GetUserByName (нет пользователя): %w", err)
+	}
+	if missing != nil {
+		return fmt.Errorf("GetUserByName (нет пользователя): ожидался nil, получен %+v", *missing)
+	}
+
+	hash := s.keyHash("key")
+	if err = s.storage.AddAPIKey(ctx, user.ID, hash); err != nil {
+		return fmt.Errorf("AddAPIKey: %w", err)
+	}
+	if err = s.storage.AddAPIKey(ctx, user.ID, hash); err != nil {
+		return fmt.Errorf("AddAPIKey (тот же хэш): %w", err)
+	}
+
+	found, err := s.storage.GetUserByKeyHash(ctx, hash)
+	if err != nil {
+		return fmt.Errorf("GetUserByKeyHash: %w", err)
+	}
+	if found == nil || found.ID != user.ID || found.Name != name || !found.IsAdmin {
+		return fmt.Errorf("GetUserByKeyHash: ожидался пользователь %d, получен %+v", user.ID, found)
+	}
+
+	// замена ключа отзывает остальные ключи пользователя, повторная замена ничего не отзывает
+	replaced := s.keyHash("replaced")
+	revoked, err := s.storage.ReplaceAPIKeys(ctx, user.ID, replaced)
+	if err != nil {
+		return fmt.Errorf("ReplaceAPIKeys: %w", err)
+	}
+	if revoked != 1 {
+		return fmt.Errorf("ReplaceAPIKeys: отозвано %d ключей, ожидался 1", revoked)
+	}
+	if revoked, err = s.storage.ReplaceAPIKeys(ctx, user.ID, replaced); err != nil || revoked != 0 {
+		return fmt.Errorf("ReplaceAPIKeys (повторно): отозвано %d ключей, ошибка %v", revoked, err)
+	}
+	if old, err := s.storage.GetUserByKeyHash(ctx, hash); err != nil || old != nil {
+		return fmt.Errorf("GetUserByKeyHash (отозванный ключ): ожидался nil, получен %+v, ошибка %v", old, err)
+	}
+	if found, err = s.storage.GetUserByKeyHash(ctx, replaced); err != nil || found == nil || found.ID != user.ID {
+		return fmt.Errorf("GetUserByKeyHash (новый ключ): ожидался пользователь %d, получен %+v, ошибка %v", user.ID, found, err)
+	}
+
+	unknown, err := s.storage.GetUserByKeyHash(ctx, s.keyHash("unknown"))
+	if err != nil {
+		return fmt.Errorf("GetUserByKeyHash (неизвестный ключ): %w", err)
+	}
+	if unknown != nil {
+		return fmt.Errorf("GetUserByKeyHash (неизвестный ключ): ожидался nil, получен %+v", *unknown)
+	}
+
+	return nil
+}
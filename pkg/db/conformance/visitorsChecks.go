@@ -0,0 +1,82 @@
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// checkVisitors проверяет учёт уникальных посетителей по дням
+func checkVisitors(ctx context.Context, s *suite) error {
+
+	link, err := s.link(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("CreateLink: %w", err)
+	}
+
+	day0 := time.Now().UTC().Truncate(24 * time.Hour)
+	day1 := day0.AddDate(0, 0, 1)
+
+	// повторы внутри пачки и повторная запись пачки не увеличивают число посетителей
+	visits := []db.Visit{
+		{LinkID: link.ID, Day: day0, Visitor: 1},
+		{LinkID: link.ID, Day: day0, Visitor: 2},
+		{LinkID: link.ID, Day: day0, Visitor: 1},
+		{LinkID: link.ID, Day: day1, Visitor: 2},
+		{LinkID: link.ID, Day: day1, Visitor: 3},
+	}
+	for range 2 {
+		if err = s.storage.AddVisitors(ctx, visits); err != nil {
+			return fmt.Errorf("AddVisitors: %w", err)
+		}
+	}
+	if err = s.storage.AddVisitors(ctx, nil); err != nil {
+		return fmt.Errorf("AddVisitors (пусто): %w", err)
+	}
+
+	total, byDay, err := s.storage.CountVisitors(ctx, link.ID, day0, day1)
+	if err != nil {
+		return fmt.Errorf("CountVisitors: %w", err)
+	}
+	if total != 3 {
+		return fmt.Errorf("CountVisitors: ожидалось 3 посетителя за период, получено %d", total)
+	}
+	want := map[string]int{day0.Format(time.DateOnly): 2, day1.Format(time.DateOnly): 2}
+	if err = sameCounts("CountVisitors", byDay, want); err != nil {
+		return err
+	}
+
+	total, byDay, err = s.storage.CountVisitors(ctx, link.ID, day1, day1)
+	if err != nil {
+		return fmt.Errorf("CountVisitors: %w", err)
+	}
+	if total != 2 {
+		return fmt.Errorf("CountVisitors (один день): ожидалось 2 посетителя, получено %d", total)
+	}
+
+	return sameCounts("CountVisitors (один день)", byDay, map[string]int{day1.Format(time.DateOnly): 2})
+}
+
+// checkVisitorSalt проверяет, что соль посетителей сохраняется первым вызовом и дальше не меняется
+func checkVisitorSalt(ctx context.Context, s *suite) error {
+
+	first, err := s.storage.VisitorSalt(ctx, s.name("salt"))
+	if err != nil {
+		return fmt.Errorf("VisitorSalt: %w", err)
+	}
+	if first == "" {
+		return fmt.Errorf("VisitorSalt: возвращена пустая соль")
+	}
+
+	second, err := s.storage.VisitorSalt(ctx, s.name("salt"))
+	if err != nil {
+		return fmt.Errorf("VisitorSalt (повторно): %w", err)
+	}
+	if second != first {
+		return fmt.Errorf("VisitorSalt: соль сменилась с %q на %q", first, second)
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ошибки хранилища, одинаковые для всех реализаций Storage
+var (
+	// ErrUserExists - пользователь с таким именем уже есть
+	ErrUserExists = errors.New("пользователь с таким именем уже существует")
+
+	// ErrShortURLExists - короткая ссылка уже занята (в том числе ссылкой в корзине)
+	ErrShortURLExists = errors.New("короткая ссылка уже существует")
+
+	// ErrRollupDaySkipped - сводку дня построить не удалось, день отложен, а следующие дни сворачиваются дальше
+	ErrRollupDaySkipped = errors.New("сводка дня не построена, день отложен")
+)
+
+// uniqueViolation - код ошибки PostgreSQL при нарушении уникальности
+const uniqueViolation = "23505"
+
+// isUniqueViolation проверяет, что запрос нарушил ограничение уникальности constraint
+func isUniqueViolation(err error, constraint string) bool {
+
+	var pgErr *pgconn.PgError
+
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == constraint
+}
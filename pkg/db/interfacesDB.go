@@ -5,47 +5,164 @@ import (
 	"time"
 )
 
+// Storage - хранилище сервиса: ссылки, переходы, пользователи и уникальные посетители
+// (PostgreSQL - *DataBase, а также реализации в пакетах memory и sqlite)
+type Storage interface {
+	LinkMethods
+	AnalyticsMethods
+	UserMethods
+	VisitorMethods
+
+	// Close освобождает соединения хранилища
+	Close()
+}
+
 // методы по таблице Link
 type LinkMethods interface {
-	// CreateLink создаёт новую запись в таблице links
-	CreateLink(ctx context.Context, originalURL, shortURL string, isCustom bool) (*Link, error)
+	// CreateLink создаёт новую запись в таблице links (opts задают срок жизни и бюджет переходов;
+	// ErrShortURLExists, если короткая ссылка занята)
+	CreateLink(ctx context.Context, originalURL, shortURL string, isCustom bool, opts LinkOptions) (*Link, error)
 
-	// GetLinkByShortURL возвращает ссылку по её короткому идентификатору
+	// NextLinkID резервирует идентификатор для следующей ссылки (передаётся в CreateLink через LinkOptions.ID)
+	NextLinkID(ctx context.Context) (int, error)
+
+	// GetLinkByShortURL возвращает ссылку по её короткому идентификатору (в том числе удалённую в корзину)
 	GetLinkByShortURL(ctx context.Context, shortURL string) (*Link, error)
 
-	// GetLinkByOriginalURL возвращает все ссылки, соответствующие заданному оригинальному URL
-	GetLinkByOriginalURL(ctx context.Context, originalURL string) ([]*Link, error)
+	// GetLinkByOriginalURL возвращает все активные ссылки, соответствующие заданному оригинальному URL
+	// (здесь и далее ownerID ограничивает выборку ссылками владельца, nil - без ограничения)
+	GetLinkByOriginalURL(ctx context.Context, originalURL string, ownerID *int) ([]*Link, error)
 
 	// IncrementClicks увеличивает счётчик переходов по ссылке на единицу
 	IncrementClicks(ctx context.Context, linkID int64) error
 
+	// AddClicks увеличивает счётчики переходов (все и без повторов) нескольких ссылок на заданные величины
+	AddClicks(ctx context.Context, counts map[int]ClickDelta) error
+
+	// UpdateLink изменяет активную ссылку и возвращает её новую версию (nil, если ссылка не найдена)
+	UpdateLink(ctx context.Context, shortURL string, upd LinkUpdate) (*Link, error)
+
+	// DeleteLink перемещает активную ссылку в корзину (nil, если ссылка не найдена)
+	DeleteLink(ctx context.Context, shortURL string) (*Link, error)
+
+	// RestoreLink возвращает ссылку из корзины (nil, если в корзине её нет)
+	RestoreLink(ctx context.Context, shortURL string) (*Link, error)
+
+	// GetDeletedLinks возвращает содержимое корзины
+	GetDeletedLinks(ctx context.Context, ownerID *int) ([]*Link, error)
+
 	// GetLinks возвращает последние 20 созданных ссылок
-	GetLinks(ctx context.Context) ([]*Link, error)
+	GetLinks(ctx context.Context, ownerID *int) ([]*Link, error)
 
-	// GetLinksOfPeriod возвращает ссылки, созданные за указанный период времени
-	GetLinksOfPeriod(ctx context.Context, period time.Duration) ([]*Link, error)
+	// GetPopularLinks возвращает не более limit активных ссылок с наибольшим числом переходов за указанный период
+	GetPopularLinks(ctx context.Context, period time.Duration, limit int) ([]*Link, error)
 
 	// SearchByOriginalURL ищет ссылки, OriginalURL которых содержит подстроку query
-	SearchByOriginalURL(ctx context.Context, search string) ([]*Link, error)
+	SearchByOriginalURL(ctx context.Context, search string, ownerID *int) ([]*Link, error)
 
 	// SearchByShortURL ищет ссылки, ShortURL которых содержит подстроку query
-	SearchByShortURL(ctx context.Context, search string) ([]*Link, error)
+	SearchByShortURL(ctx context.Context, search string, ownerID *int) ([]*Link, error)
 }
 
 // методы по таблице Analytics
 type AnalyticsMethods interface {
 	// SaveAnalytics сохраняет информацию о переходе по ссылке
-	SaveAnalytics(ctx context.Context, linkID int, accessedAt time.Time, userAgent, ipAddress, referer string) error
+	SaveAnalytics(ctx context.Context, linkID int, accessedAt time.Time, userAgent, ipAddress, referer string, isBot bool) error
+
+	// SaveAnalyticsBatch сохраняет пачку переходов за одно обращение к БД
+	SaveAnalyticsBatch(ctx context.Context, records []*Analytics) error
+
+	// GetClicks возвращает страницу журнала переходов по ссылке (от новых к старым, начиная после записи afterID)
+	GetClicks(ctx context.Context, linkID int, filter ClickFilter, afterID int64, limit int) ([]*Analytics, error)
+
+	// StreamClicks передаёт в fn переходы по ссылке linkID или по всем ссылкам владельца ownerID
+	// (nil в обоих - по всем ссылкам), не загружая выборку в память целиком
+	StreamClicks(ctx context.Context, linkID, ownerID *int, filter ClickFilter, fn func(shortURL string, a *Analytics) error) error
+
+	// агрегаты ниже читают свёрнутые дни из дневных сводок и только остальные переходы (обычно за сегодня) - из analytics
+
+	// CountClicks возвращает количество переходов людей (isBot = false) или ботов (isBot = true) по ссылке
+	CountClicks(ctx context.Context, linkID int, isBot bool) (int, error)
+
+	// CountClicksByDay возвращает количество переходов людей (isBot = false) или ботов (isBot = true)
+	// по ссылке, сгруппированных по дням (UTC) в заданном диапазоне
+	CountClicksByDay(ctx context.Context, linkID int, from, to time.Time, isBot bool) (map[string]int, error)
+
+	// CountClicksByMonth возвращает количество переходов людей или ботов по ссылке,
+	// сгруппированных по месяцам (UTC) в заданном диапазоне
+	CountClicksByMonth(ctx context.Context, linkID int, from, to time.Time, isBot bool) (map[string]int, error)
+
+	// CountClicksByPeriod возвращает количество переходов людей или ботов по ссылке за [from, to),
+	// разбитое на шаги granularity (Granularity* из modelsDB.go) в часовом поясе tz, включая шаги без переходов
+	CountClicksByPeriod(ctx context.Context, linkID int, from, to time.Time, granularity, tz string, isBot bool) ([]TimeBucket, error)
+
+	// CountClicksByUserAgent возвращает количество переходов людей или ботов по ссылке, сгруппированных по User-Agent
+	CountClicksByUserAgent(ctx context.Context, linkID int, isBot bool) (map[string]int, error)
+
+	// CountClicksByDimension возвращает количество переходов людей или ботов по ссылке,
+	// сгруппированных по измерению (Dimension* из modelsDB.go)
+	CountClicksByDimension(ctx context.Context, linkID int, dimension string, isBot bool) (map[string]int, error)
+
+	// CountClicksByCountry возвращает количество переходов людей или ботов по ссылке, сгруппированных по странам
+	CountClicksByCountry(ctx context.Context, linkID int, isBot bool) (map[string]int, error)
+
+	// CountClicksByCity возвращает количество переходов людей или ботов по ссылке, сгруппированных по городам
+	CountClicksByCity(ctx context.Context, linkID int, isBot bool) (map[string]int, error)
+
+	// CountRolledVisitors возвращает точное число уникальных посетителей ссылки по дням [from, to],
+	// уже свёрнутым в дневные сводки
+	CountRolledVisitors(ctx context.Context, linkID int, from, to time.Time) (map[string]int, error)
+}
+
+// методы по дневным сводкам аналитики (link_daily_stats, link_daily_dimensions)
+type RollupMethods interface {
+	// RolledUntil возвращает первый день (UTC), ещё не свёрнутый в сводки
+	RolledUntil(ctx context.Context) (time.Time, error)
+
+	// RollupNextDay пересчитывает сводку дня, в который поздно записались переходы, или сворачивает
+	// следующий закончившийся раньше closedBefore день (false - сворачивать нечего)
+	RollupNextDay(ctx context.Context, closedBefore time.Time) (time.Time, bool, error)
+}
+
+// методы обслуживания секций таблицы analytics
+type PartitionMethods interface {
+	// EnsurePartitions создаёт месячные секции analytics с текущего месяца по месяц to включительно
+	EnsurePartitions(ctx context.Context, to time.Time) error
+
+	// AnalyticsPartitions возвращает месячные секции analytics
+	AnalyticsPartitions(ctx context.Context) ([]Partition, error)
+
+	// RemovePartition удаляет или архивирует секцию, все переходы которой уже свёрнуты в сводки (false - не свёрнуты)
+	RemovePartition(ctx context.Context, p Partition, archive bool) (bool, error)
+}
+
+// методы по таблице link_visitors
+type VisitorMethods interface {
+	// AddVisitors сохраняет посетителей ссылок по дням без повторов
+	AddVisitors(ctx context.Context, visits []Visit) error
+
+	// CountVisitors возвращает число уникальных посетителей ссылки за дни [from, to] по дням и за весь период
+	CountVisitors(ctx context.Context, linkID int, from, to time.Time) (int, map[string]int, error)
+
+	// VisitorSalt возвращает соль хэширования посетителей, общую для всех экземпляров сервиса и перезапусков
+	// (первый вызов сохраняет candidate, следующие возвращают сохранённую соль)
+	VisitorSalt(ctx context.Context, candidate string) (string, error)
+}
+
+// методы по таблицам users и api_keys
+type UserMethods interface {
+	// CreateUser создаёт пользователя (ErrUserExists, если имя занято)
+	CreateUser(ctx context.Context, name string, isAdmin bool) (*User, error)
 
-	// GetAnalyticsByLinkID возвращает все записи о переходах для конкретной ссылки
-	GetAnalyticsByLinkID(ctx context.Context, linkID int) ([]*Analytics, error)
+	// GetUserByName возвращает пользователя по имени (nil, если его нет)
+	GetUserByName(ctx context.Context, name string) (*User, error)
 
-	// CountClicksByDay возвращает количество переходов по ссылке, сгруппированных по дням в заданном диапазоне
-	CountClicksByDay(ctx context.Context, linkID int, from, to time.Time) (map[string]int, error)
+	// AddAPIKey сохраняет хэш API-ключа пользователя
+	AddAPIKey(ctx context.Context, userID int, keyHash string) error
 
-	// CountClicksByMonth возвращает количество переходов по ссылке, сгруппированных по месяцам в заданном диапазоне
-	CountClicksByMonth(ctx context.Context, linkID int, from, to time.Time) (map[string]int, error)
+	// ReplaceAPIKeys сохраняет хэш API-ключа и отзывает остальные ключи пользователя (возвращает число отозванных)
+	ReplaceAPIKeys(ctx context.Context, userID int, keyHash string) (int, error)
 
-	// CountClicksByUserAgent возвращает количество переходов по ссылке, сгруппированных по User-Agent
-	CountClicksByUserAgent(ctx context.Context, linkID int) (map[string]int, error)
+	// GetUserByKeyHash возвращает владельца действующего API-ключа (nil, если ключ неизвестен или отозван)
+	GetUserByKeyHash(ctx context.Context, keyHash string) (*User, error)
 }
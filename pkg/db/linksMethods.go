@@ -9,45 +9,90 @@ import (
 	"github.com/jackc/pgx/v5"
 )
 
-// SaveLink добавляет новую запись в таблицу links БД
-func (d *DataBase) CreateLink(ctx context.Context, originalURL, shortURL string, isCustom bool) (*Link, error) {
+// linkColumns - перечень полей таблицы links в порядке сканирования в scanLink
+const linkColumns = `id, short_url, original_url, created_at, is_custom, clicks_count, expires_at, max_clicks, deleted_at, owner_id, redirect_type, pass_query, dedup_clicks_count`
+
+// scanLink считывает строку выборки из links в структуру Link
+func scanLink(row pgx.Row, link *Link) error {
+
+	return row.Scan(
+		&link.ID,
+		&link.ShortURL,
+		&link.OriginalURL,
+		&link.CreatedAt,
+		&link.IsCustom,
+		&link.ClicksCount,
+		&link.ExpiresAt,
+		&link.MaxClicks,
+		&link.DeletedAt,
+		&link.OwnerID,
+		&link.RedirectType,
+		&link.PassQuery,
+		&link.DedupClicksCount,
+	)
+}
+
+// CreateLink добавляет новую запись в таблицу links БД
+func (d *DataBase) CreateLink(ctx context.Context, originalURL, shortURL string, isCustom bool, opts LinkOptions) (*Link, error) {
 
-	query := `   INSERT INTO links (short_url, original_url, created_at, is_custom, clicks_count)
-                 VALUES ($1, $2, NOW(), $3, $4)
+	query := `   INSERT INTO links (id, short_url, original_url, created_at, is_custom, clicks_count, expires_at, max_clicks,
+	                               owner_id, redirect_type, pass_query)
+                 VALUES (COALESCE(NULLIF($7, 0), NEXTVAL(PG_GET_SERIAL_SEQUENCE('links', 'id'))), $1, $2, NOW(), $3, $4, $5, $6,
+				         $8, $9, $10)
 			  RETURNING id, created_at`
 
 	link := &Link{
-		ShortURL:    shortURL,
-		OriginalURL: originalURL,
-		IsCustom:    isCustom,
-		ClicksCount: 0,
+		ShortURL:     shortURL,
+		OriginalURL:  originalURL,
+		IsCustom:     isCustom,
+		ClicksCount:  0,
+		ExpiresAt:    opts.ExpiresAt,
+		MaxClicks:    opts.MaxClicks,
+		OwnerID:      opts.OwnerID,
+		RedirectType: opts.RedirectType,
+		PassQuery:    opts.PassQuery,
+	}
+	if link.RedirectType == "" {
+		link.RedirectType = RedirectFound
 	}
 
-	err := d.Pool.QueryRow(ctx, query, shortURL, originalURL, isCustom, 0).
+	err := d.Pool.QueryRow(ctx, query, shortURL, originalURL, isCustom, 0, opts.ExpiresAt, opts.MaxClicks, opts.ID,
+		opts.OwnerID, link.RedirectType, link.PassQuery).
 		Scan(&link.ID, &link.CreatedAt)
 	if err != nil {
+		if isUniqueViolation(err, "links_short_url_key") {
+			return nil, ErrShortURLExists
+		}
 		return nil, fmt.Errorf("ошибка добавления записи о ссылке в CreateLink: %w", err)
 	}
 
 	return link, nil
 }
 
+// NextLinkID резервирует очередное значение последовательности links.id
+func (d *DataBase) NextLinkID(ctx context.Context) (int, error) {
+
+	query := `SELECT NEXTVAL(PG_GET_SERIAL_SEQUENCE('links', 'id'))`
+
+	var id int
+	err := d.Pool.QueryRow(ctx, query).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка резервирования идентификатора ссылки в NextLinkID: %w", err)
+	}
+
+	return id, nil
+}
+
 // GetLinkByShortURL получает из таблицы links БД запись по короткой ссылке
 func (d *DataBase) GetLinkByShortURL(ctx context.Context, shortURL string) (*Link, error) {
 
-	query := `SELECT * 
+	query := `SELECT ` + linkColumns + `
 	            FROM links 
 			   WHERE short_url = $1`
 
 	link := &Link{}
 
-	err := d.Pool.QueryRow(ctx, query, shortURL).
-		Scan(&link.ID,
-			&link.ShortURL,
-			&link.OriginalURL,
-			&link.CreatedAt,
-			&link.IsCustom,
-			&link.ClicksCount)
+	err := scanLink(d.Pool.QueryRow(ctx, query, shortURL), link)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
@@ -59,13 +104,16 @@ func (d *DataBase) GetLinkByShortURL(ctx context.Context, shortURL string) (*Lin
 }
 
 // GetLinkByOriginalURL получает из таблицы links БД записи по длинной ссылке
-func (d *DataBase) GetLinkByOriginalURL(ctx context.Context, originalURL string) ([]*Link, error) {
+// (поиск идёт по хэш-индексу idx_links_original_url_hash; ownerID ограничивает выборку ссылками владельца, nil - без ограничения)
+func (d *DataBase) GetLinkByOriginalURL(ctx context.Context, originalURL string, ownerID *int) ([]*Link, error) {
 
-	query := `SELECT * 
+	query := `SELECT ` + linkColumns + `
 	            FROM links 
-			   WHERE original_url = $1`
+			   WHERE original_url = $1
+			     AND deleted_at IS NULL
+			     AND ($2::INT IS NULL OR owner_id = $2)`
 
-	rows, err := d.Pool.Query(ctx, query, originalURL)
+	rows, err := d.Pool.Query(ctx, query, originalURL, ownerID)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении списка ссылок в GetLinkByOriginalURL: %w", err)
 	}
@@ -74,14 +122,7 @@ func (d *DataBase) GetLinkByOriginalURL(ctx context.Context, originalURL string)
 	links := make([]*Link, 0)
 	for rows.Next() {
 		var link Link
-		err := rows.Scan(
-			&link.ID,
-			&link.ShortURL,
-			&link.OriginalURL,
-			&link.CreatedAt,
-			&link.IsCustom,
-			&link.ClicksCount,
-		)
+		err := scanLink(rows, &link)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка при сканировании строки списка ссылок в GetLinkByOriginalURL: %w", err)
 		}
@@ -99,8 +140,10 @@ func (d *DataBase) GetLinkByOriginalURL(ctx context.Context, originalURL string)
 // IncrementClicks увеличивает счётчик переходов по ссылке
 func (d *DataBase) IncrementClicks(ctx context.Context, linkID int64) error {
 
+	// одиночный переход без сведений о повторах учитывается в обоих счётчиках
 	query := `UPDATE links
-	             SET clicks_count = clicks_count + 1
+	             SET clicks_count = clicks_count + 1,
+			         dedup_clicks_count = dedup_clicks_count + 1
 			   WHERE id = $1`
 
 	_, err := d.Pool.Exec(ctx, query, linkID)
@@ -111,17 +154,157 @@ func (d *DataBase) IncrementClicks(ctx context.Context, linkID int64) error {
 	return nil
 }
 
+// AddClicks увеличивает счётчики переходов сразу по нескольким ссылкам одним запросом
+// (counts - прирост счётчиков по идентификатору ссылки)
+func (d *DataBase) AddClicks(ctx context.Context, counts map[int]ClickDelta) error {
+
+	if len(counts) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(counts))
+	raw := make([]int, 0, len(counts))
+	dedup := make([]int, 0, len(counts))
+	for id, delta := range counts {
+		ids = append(ids, id)
+		raw = append(raw, delta.Raw)
+		dedup = append(dedup, delta.Dedup)
+	}
+
+	query := `UPDATE links AS l
+	             SET clicks_count = l.clicks_count + v.raw,
+			         dedup_clicks_count = l.dedup_clicks_count + v.dedup
+			    FROM UNNEST($1::INT[], $2::INT[], $3::INT[]) AS v(id, raw, dedup)
+			   WHERE l.id = v.id`
+
+	_, err := d.Pool.Exec(ctx, query, ids, raw, dedup)
+	if err != nil {
+		return fmt.Errorf("ошибка увеличения счётчиков переходов в AddClicks: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateLink изменяет поля активной ссылки, переданные в upd
+func (d *DataBase) UpdateLink(ctx context.Context, shortURL string, upd LinkUpdate) (*Link, error) {
+
+	query := `UPDATE links
+	             SET original_url = COALESCE($2, original_url),
+			         expires_at = CASE WHEN $3 THEN NULL ELSE COALESCE($4, expires_at) END,
+			         max_clicks = CASE WHEN $5 THEN NULL ELSE COALESCE($6, max_clicks) END,
+			         redirect_type = COALESCE($7, redirect_type),
+			         pass_query = COALESCE($8, pass_query)
+			   WHERE short_url = $1
+			     AND deleted_at IS NULL
+		   RETURNING ` + linkColumns
+
+	link := &Link{}
+
+	err := scanLink(d.Pool.QueryRow(ctx, query, shortURL,
+		upd.OriginalURL,
+		upd.ResetExpiresAt, upd.ExpiresAt,
+		upd.ResetMaxClicks, upd.MaxClicks,
+		upd.RedirectType, upd.PassQuery), link)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка изменения записи о ссылке в UpdateLink: %w", err)
+	}
+
+	return link, nil
+}
+
+// DeleteLink помечает ссылку удалённой (мягкое удаление, запись остаётся в корзине)
+func (d *DataBase) DeleteLink(ctx context.Context, shortURL string) (*Link, error) {
+
+	query := `UPDATE links
+	             SET deleted_at = NOW()
+			   WHERE short_url = $1
+			     AND deleted_at IS NULL
+		   RETURNING ` + linkColumns
+
+	link := &Link{}
+
+	err := scanLink(d.Pool.QueryRow(ctx, query, shortURL), link)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка удаления записи о ссылке в DeleteLink: %w", err)
+	}
+
+	return link, nil
+}
+
+// RestoreLink снимает с ссылки пометку об удалении
+func (d *DataBase) RestoreLink(ctx context.Context, shortURL string) (*Link, error) {
+
+	query := `UPDATE links
+	             SET deleted_at = NULL
+			   WHERE short_url = $1
+			     AND deleted_at IS NOT NULL
+		   RETURNING ` + linkColumns
+
+	link := &Link{}
+
+	err := scanLink(d.Pool.QueryRow(ctx, query, shortURL), link)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка восстановления записи о ссылке в RestoreLink: %w", err)
+	}
+
+	return link, nil
+}
+
+// GetDeletedLinks получает ссылки из корзины, начиная с удалённых последними
+func (d *DataBase) GetDeletedLinks(ctx context.Context, ownerID *int) ([]*Link, error) {
+
+	query := `SELECT ` + linkColumns + `
+	            FROM links
+			   WHERE deleted_at IS NOT NULL
+			     AND ($1::INT IS NULL OR owner_id = $1)
+			   ORDER BY deleted_at DESC`
+
+	rows, err := d.Pool.Query(ctx, query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении списка ссылок в GetDeletedLinks: %w", err)
+	}
+	defer rows.Close()
+
+	var links []*Link
+	for rows.Next() {
+		var link Link
+		err := scanLink(rows, &link)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании строки списка ссылок в GetDeletedLinks: %w", err)
+		}
+
+		links = append(links, &link)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по списку ссылок в GetDeletedLinks: %w", err)
+	}
+
+	return links, nil
+}
+
 // GetLinks получает крайние по времени 20 записей по сокращению ссылок
-func (d *DataBase) GetLinks(ctx context.Context) ([]*Link, error) {
+func (d *DataBase) GetLinks(ctx context.Context, ownerID *int) ([]*Link, error) {
 
 	const limitGetLinks = 20
 
-	query := `SELECT *
+	query := `SELECT ` + linkColumns + `
 	            FROM links
+			   WHERE deleted_at IS NULL
+			     AND ($2::INT IS NULL OR owner_id = $2)
 			   ORDER BY created_at DESC
 			   LIMIT $1`
 
-	rows, err := d.Pool.Query(ctx, query, limitGetLinks)
+	rows, err := d.Pool.Query(ctx, query, limitGetLinks, ownerID)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении списка ссылок в GetLinks: %w", err)
 	}
@@ -130,14 +313,7 @@ func (d *DataBase) GetLinks(ctx context.Context) ([]*Link, error) {
 	var links []*Link
 	for rows.Next() {
 		var link Link
-		err := rows.Scan(
-			&link.ID,
-			&link.ShortURL,
-			&link.OriginalURL,
-			&link.CreatedAt,
-			&link.IsCustom,
-			&link.ClicksCount,
-		)
+		err := scanLink(rows, &link)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка при сканировании строки списка ссылок в GetLinks: %w", err)
 		}
@@ -152,55 +328,57 @@ func (d *DataBase) GetLinks(ctx context.Context) ([]*Link, error) {
 	return links, nil
 }
 
-// GetLinksOfPeriod возвращает записи за крайний period времени
-func (d *DataBase) GetLinksOfPeriod(ctx context.Context, period time.Duration) ([]*Link, error) {
+// GetPopularLinks возвращает не более limit активных ссылок с наибольшим числом переходов
+// (вместе с переходами ботов - они тоже обращаются к кэшу) за крайний period времени
+func (d *DataBase) GetPopularLinks(ctx context.Context, period time.Duration, limit int) ([]*Link, error) {
 
 	threshold := time.Now().Add(-period)
 
-	query := `SELECT *
-	            FROM links
-			   WHERE created_at >= $1`
-
-	rows, err := d.Pool.Query(ctx, query, threshold)
+	query := `SELECT ` + linkColumns + `
+	            FROM (SELECT link_id, COUNT(*) AS clicks
+	                    FROM analytics
+	                   WHERE accessed_at >= $1
+	                   GROUP BY link_id) AS popular
+	            JOIN links ON links.id = popular.link_id
+			   WHERE deleted_at IS NULL
+			   ORDER BY popular.clicks DESC, links.id DESC
+			   LIMIT $2`
+
+	rows, err := d.Pool.Query(ctx, query, threshold, limit)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при получении списка ссылок в GetLinksOfPeriod: %w", err)
+		return nil, fmt.Errorf("ошибка при получении списка ссылок в GetPopularLinks: %w", err)
 	}
 	defer rows.Close()
 
 	var links []*Link
 	for rows.Next() {
 		var link Link
-		err := rows.Scan(
-			&link.ID,
-			&link.ShortURL,
-			&link.OriginalURL,
-			&link.CreatedAt,
-			&link.IsCustom,
-			&link.ClicksCount,
-		)
+		err := scanLink(rows, &link)
 		if err != nil {
-			return nil, fmt.Errorf("ошибка при сканировании строки списка ссылок в GetLinksOfPeriod: %w", err)
+			return nil, fmt.Errorf("ошибка при сканировании строки списка ссылок в GetPopularLinks: %w", err)
 		}
 
 		links = append(links, &link)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при итерации по списку ссылок в GetLinksOfPeriod: %w", err)
+		return nil, fmt.Errorf("ошибка при итерации по списку ссылок в GetPopularLinks: %w", err)
 	}
 
 	return links, nil
 }
 
 // SearchByOriginalURL ищет ссылки, OriginalURL которых содержит подстроку query (регистронезависимо)
-func (d *DataBase) SearchByOriginalURL(ctx context.Context, search string) ([]*Link, error) {
+func (d *DataBase) SearchByOriginalURL(ctx context.Context, search string, ownerID *int) ([]*Link, error) {
 
-	query := `SELECT *
+	query := `SELECT ` + linkColumns + `
 	            FROM links
 			   WHERE original_url ILIKE '%' || $1 || '%'
+			     AND deleted_at IS NULL
+			     AND ($2::INT IS NULL OR owner_id = $2)
 			   ORDER BY created_at DESC`
 
-	rows, err := d.Pool.Query(ctx, query, search)
+	rows, err := d.Pool.Query(ctx, query, escapeLike(search), ownerID)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении списка ссылок в SearchByOriginalURL: %w", err)
 	}
@@ -209,14 +387,7 @@ func (d *DataBase) SearchByOriginalURL(ctx context.Context, search string) ([]*L
 	var links []*Link
 	for rows.Next() {
 		var link Link
-		err := rows.Scan(
-			&link.ID,
-			&link.ShortURL,
-			&link.OriginalURL,
-			&link.CreatedAt,
-			&link.IsCustom,
-			&link.ClicksCount,
-		)
+		err := scanLink(rows, &link)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка при сканировании строки списка ссылок в SearchByOriginalURL: %w", err)
 		}
@@ -232,14 +403,16 @@ func (d *DataBase) SearchByOriginalURL(ctx context.Context, search string) ([]*L
 }
 
 // SearchByShortURL ищет ссылки, ShortURL которых содержит подстроку query (регистронезависимо)
-func (d *DataBase) SearchByShortURL(ctx context.Context, search string) ([]*Link, error) {
+func (d *DataBase) SearchByShortURL(ctx context.Context, search string, ownerID *int) ([]*Link, error) {
 
-	query := `SELECT *
+	query := `SELECT ` + linkColumns + `
 	          FROM links
 			 WHERE short_url ILIKE '%' || $1 || '%'
+			   AND deleted_at IS NULL
+			   AND ($2::INT IS NULL OR owner_id = $2)
 			 ORDER BY created_at DESC`
 
-	rows, err := d.Pool.Query(ctx, query, search)
+	rows, err := d.Pool.Query(ctx, query, escapeLike(search), ownerID)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении списка ссылок в SearchByShortURL: %w", err)
 	}
@@ -248,14 +421,7 @@ func (d *DataBase) SearchByShortURL(ctx context.Context, search string) ([]*Link
 	var links []*Link
 	for rows.Next() {
 		var link Link
-		err := rows.Scan(
-			&link.ID,
-			&link.ShortURL,
-			&link.OriginalURL,
-			&link.CreatedAt,
-			&link.IsCustom,
-			&link.ClicksCount,
-		)
+		err := scanLink(rows, &link)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка при сканировании строки списка ссылок в SearchByShortURL: %w", err)
 		}
@@ -0,0 +1,268 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// SaveAnalytics записывает переход без разобранного User-Agent и местоположения
+func (s *Storage) SaveAnalytics(ctx context.Context, linkID int, accessedAt time.Time, userAgent, ipAddress, referer string, isBot bool) error {
+
+	return s.SaveAnalyticsBatch(ctx, []*db.Analytics{{
+		LinkID:     linkID,
+		AccessedAt: accessedAt,
+		UserAgent:  userAgent,
+		IPAddress:  net.ParseIP(ipAddress), // если пусто, вернёт nil
+		Referer:    referer,
+		IsBot:      isBot,
+	}})
+}
+
+// SaveAnalyticsBatch записывает пачку переходов, назначая им идентификаторы по порядку
+func (s *Storage) SaveAnalyticsBatch(ctx context.Context, records []*db.Analytics) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// пачка записывается целиком или не записывается совсем, как COPY
+	for _, a := range records {
+		if _, ok := s.links[a.LinkID]; !ok {
+			return fmt.Errorf("ошибка добавления пачки записей о переходах в SaveAnalyticsBatch: нет ссылки %d", a.LinkID)
+		}
+	}
+
+	for _, a := range records {
+		s.lastClick++
+
+		stored := *a
+		stored.ID = s.lastClick
+		stored.AccessedAt = a.AccessedAt.Truncate(time.Microsecond)
+		stored.IPAddress = append(net.IP(nil), a.IPAddress...)
+
+		s.clicks = append(s.clicks, &stored)
+		s.byLink[a.LinkID] = append(s.byLink[a.LinkID], &stored)
+	}
+
+	return nil
+}
+
+// clickMatches проверяет переход по фильтрам журнала
+// (границы периода, как и время переходов, хранятся с точностью PostgreSQL - до микросекунд)
+func clickMatches(a *db.Analytics, filter db.ClickFilter) bool {
+
+	switch {
+	case filter.From != nil && a.AccessedAt.Before(filter.From.Truncate(time.Microsecond)):
+		return false
+	case filter.To != nil && !a.AccessedAt.Before(filter.To.Truncate(time.Microsecond)):
+		return false
+	case filter.Referer != "" && !strings.Contains(strings.ToLower(a.Referer), strings.ToLower(filter.Referer)):
+		return false
+	case filter.Device != "" && a.Device != filter.Device:
+		return false
+	case filter.IsBot != nil && a.IsBot != *filter.IsBot:
+		return false
+	}
+
+	return true
+}
+
+// cloneClick возвращает копию перехода, чтобы вызывающий код не менял хранимую запись
+func cloneClick(a *db.Analytics) *db.Analytics {
+
+	c := *a
+	c.IPAddress = append(net.IP(nil), a.IPAddress...)
+
+	return &c
+}
+
+// GetClicks возвращает страницу журнала переходов по ссылке (от новых к старым):
+// не более limit записей с id меньше afterID (0 - с самой новой), подходящих под filter
+func (s *Storage) GetClicks(ctx context.Context, linkID int, filter db.ClickFilter, afterID int64, limit int) ([]*db.Analytics, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var analytics []*db.Analytics
+	clicks := s.byLink[linkID]
+	for i := len(clicks) - 1; i >= 0 && len(analytics) < limit; i-- {
+		a := clicks[i]
+		if afterID != 0 && a.ID >= afterID {
+			continue
+		}
+		if clickMatches(a, filter) {
+			analytics = append(analytics, cloneClick(a))
+		}
+	}
+
+	return analytics, nil
+}
+
+// StreamClicks передаёт в fn переходы по ссылке linkID (или по всем ссылкам владельца ownerID,
+// nil в обоих - по всем ссылкам) от старых к новым; fn вызывается без блокировки хранилища,
+// поэтому переходы, записанные во время выгрузки, в неё не попадают
+func (s *Storage) StreamClicks(ctx context.Context, linkID, ownerID *int, filter db.ClickFilter,
+	fn func(shortURL string, a *db.Analytics) error) error {
+
+	type streamed struct {
+		shortURL string
+		click    *db.Analytics
+	}
+
+	s.mu.RLock()
+	clicks := s.clicks
+	if linkID != nil {
+		clicks = s.byLink[*linkID]
+	}
+
+	var selected []streamed
+	for _, a := range clicks {
+		link := s.links[a.LinkID]
+		if ownerID != nil && !ownedBy(link, ownerID) {
+			continue
+		}
+		if clickMatches(a, filter) {
+			selected = append(selected, streamed{shortURL: link.ShortURL, click: cloneClick(a)})
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, c := range selected {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(c.shortURL, c.click); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// countClicks вызывает count для каждого перехода людей или ботов по ссылке за [from, to)
+func (s *Storage) countClicks(linkID int, from, to time.Time, isBot bool, count func(a *db.Analytics) error) error {
+
+	from, to = from.Truncate(time.Microsecond), to.Truncate(time.Microsecond)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, a := range s.byLink[linkID] {
+		if a.IsBot != isBot || a.AccessedAt.Before(from) || !a.AccessedAt.Before(to) {
+			continue
+		}
+		if err := count(a); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// границы "за всё время" для агрегатов без периода
+var (
+	minTime = time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC)
+	maxTime = time.Date(9999, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// CountClicks - количество переходов людей или ботов по ссылке
+func (s *Storage) CountClicks(ctx context.Context, linkID int, isBot bool) (int, error) {
+
+	count := 0
+	err := s.countClicks(linkID, minTime, maxTime, isBot, func(a *db.Analytics) error {
+		count++
+		return nil
+	})
+
+	return count, err
+}
+
+// CountClicksByDay - группировка по дням (UTC)
+func (s *Storage) CountClicksByDay(ctx context.Context, linkID int, from, to time.Time, isBot bool) (map[string]int, error) {
+
+	countClick := make(map[string]int)
+	err := s.countClicks(linkID, from, to, isBot, func(a *db.Analytics) error {
+		countClick[a.AccessedAt.UTC().Format(time.DateOnly)]++
+		return nil
+	})
+
+	return countClick, err
+}
+
+// CountClicksByMonth - группировка по месяцам (UTC)
+func (s *Storage) CountClicksByMonth(ctx context.Context, linkID int, from, to time.Time, isBot bool) (map[string]int, error) {
+
+	countClick := make(map[string]int)
+	err := s.countClicks(linkID, from, to, isBot, func(a *db.Analytics) error {
+		countClick[a.AccessedAt.UTC().Format("2006-01")]++
+		return nil
+	})
+
+	return countClick, err
+}
+
+// CountClicksByPeriod - группировка по шагам временной шкалы в часовом поясе tz (см. db.Timeline)
+func (s *Storage) CountClicksByPeriod(ctx context.Context, linkID int, from, to time.Time, granularity, tz string, isBot bool) ([]db.TimeBucket, error) {
+
+	var clicks []db.TimeBucket
+	err := s.countClicks(linkID, from, to, isBot, func(a *db.Analytics) error {
+		clicks = append(clicks, db.TimeBucket{Start: a.AccessedAt, Clicks: 1})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buckets, err := db.Timeline(from, to, granularity, tz, clicks)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка в CountClicksByPeriod: %w", err)
+	}
+
+	return buckets, nil
+}
+
+// CountClicksByUserAgent - группировка по User-Agent
+func (s *Storage) CountClicksByUserAgent(ctx context.Context, linkID int, isBot bool) (map[string]int, error) {
+
+	return s.CountClicksByDimension(ctx, linkID, db.DimensionUserAgent, isBot)
+}
+
+// CountClicksByDimension - группировка по одному из измерений (браузер, ОС, устройство и т.д.)
+func (s *Storage) CountClicksByDimension(ctx context.Context, linkID int, dimension string, isBot bool) (map[string]int, error) {
+
+	// неизвестное измерение - ошибка и для ссылки без переходов
+	if _, err := db.DimensionValue(&db.Analytics{}, dimension); err != nil {
+		return nil, fmt.Errorf("ошибка в CountClicksByDimension: %w", err)
+	}
+
+	countClick := make(map[string]int)
+	err := s.countClicks(linkID, minTime, maxTime, isBot, func(a *db.Analytics) error {
+		value, err := db.DimensionValue(a, dimension)
+		countClick[value]++
+		return err
+	})
+
+	return countClick, err
+}
+
+// CountClicksByCountry - группировка по странам (ISO-код)
+func (s *Storage) CountClicksByCountry(ctx context.Context, linkID int, isBot bool) (map[string]int, error) {
+
+	return s.CountClicksByDimension(ctx, linkID, db.DimensionCountry, isBot)
+}
+
+// CountClicksByCity - группировка по городам (город и ISO-код страны)
+func (s *Storage) CountClicksByCity(ctx context.Context, linkID int, isBot bool) (map[string]int, error) {
+
+	return s.CountClicksByDimension(ctx, linkID, db.DimensionCity, isBot)
+}
+
+// CountRolledVisitors - в памяти нет дневных сводок, все агрегаты считаются по переходам
+func (s *Storage) CountRolledVisitors(ctx context.Context, linkID int, from, to time.Time) (map[string]int, error) {
+
+	return map[string]int{}, nil
+}
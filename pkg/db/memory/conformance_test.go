@@ -0,0 +1,18 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/IPampurin/UrlShortener/pkg/db/conformance"
+	"github.com/IPampurin/UrlShortener/pkg/db/memory"
+)
+
+func TestConformance(t *testing.T) {
+
+	log := conformance.Logger(t)
+
+	conformance.Run(t, func() db.Storage {
+		return memory.InitMemory(log)
+	})
+}
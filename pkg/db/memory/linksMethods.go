@@ -0,0 +1,356 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// cloneLink возвращает копию ссылки, чтобы вызывающий код не менял хранимую запись
+func cloneLink(link *db.Link) *db.Link {
+
+	c := *link
+	if link.ExpiresAt != nil {
+		expiresAt := *link.ExpiresAt
+		c.ExpiresAt = &expiresAt
+	}
+	if link.MaxClicks != nil {
+		maxClicks := *link.MaxClicks
+		c.MaxClicks = &maxClicks
+	}
+	if link.DeletedAt != nil {
+		deletedAt := *link.DeletedAt
+		c.DeletedAt = &deletedAt
+	}
+	if link.OwnerID != nil {
+		ownerID := *link.OwnerID
+		c.OwnerID = &ownerID
+	}
+
+	return &c
+}
+
+// ownedBy проверяет, что ссылка принадлежит владельцу ownerID (nil - любому)
+func ownedBy(link *db.Link, ownerID *int) bool {
+
+	return ownerID == nil || (link.OwnerID != nil && *link.OwnerID == *ownerID)
+}
+
+// selectLinks возвращает копии ссылок, подходящих под match, в порядке cmp
+func (s *Storage) selectLinks(match func(link *db.Link) bool, cmp func(a, b *db.Link) int) []*db.Link {
+
+	links := make([]*db.Link, 0)
+	for _, link := range s.links {
+		if match(link) {
+			links = append(links, cloneLink(link))
+		}
+	}
+
+	if cmp != nil {
+		slices.SortFunc(links, cmp)
+	}
+
+	return links
+}
+
+// newestFirst упорядочивает ссылки от созданных последними
+func newestFirst(a, b *db.Link) int {
+
+	return b.CreatedAt.Compare(a.CreatedAt)
+}
+
+// CreateLink добавляет новую ссылку (короткий идентификатор и идентификатор ссылки уникальны)
+func (s *Storage) CreateLink(ctx context.Context, originalURL, shortURL string, isCustom bool, opts db.LinkOptions) (*db.Link, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.shortURLs[shortURL]; ok {
+		return nil, db.ErrShortURLExists
+	}
+
+	id := opts.ID
+	if id == 0 {
+		s.lastLink++
+		id = s.lastLink
+	}
+	if _, ok := s.links[id]; ok {
+		return nil, fmt.Errorf("ошибка добавления записи о ссылке в CreateLink: идентификатор %d уже занят", id)
+	}
+
+	link := &db.Link{
+		ID:           id,
+		ShortURL:     shortURL,
+		OriginalURL:  originalURL,
+		CreatedAt:    now(),
+		IsCustom:     isCustom,
+		ExpiresAt:    opts.ExpiresAt,
+		MaxClicks:    opts.MaxClicks,
+		OwnerID:      opts.OwnerID,
+		RedirectType: opts.RedirectType,
+		PassQuery:    opts.PassQuery,
+	}
+	if link.RedirectType == "" {
+		link.RedirectType = db.RedirectFound
+	}
+
+	link = cloneLink(link)
+	s.links[id] = link
+	s.shortURLs[shortURL] = id
+	s.indexOriginal(link.OriginalURL, id)
+
+	return cloneLink(link), nil
+}
+
+// indexOriginal добавляет ссылку в индекс по оригинальному URL
+func (s *Storage) indexOriginal(originalURL string, id int) {
+
+	ids, ok := s.originals[originalURL]
+	if !ok {
+		ids = make(map[int]struct{})
+		s.originals[originalURL] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+// unindexOriginal убирает ссылку из индекса по оригинальному URL
+func (s *Storage) unindexOriginal(originalURL string, id int) {
+
+	delete(s.originals[originalURL], id)
+	if len(s.originals[originalURL]) == 0 {
+		delete(s.originals, originalURL)
+	}
+}
+
+// NextLinkID резервирует очередной идентификатор ссылки
+func (s *Storage) NextLinkID(ctx context.Context) (int, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastLink++
+
+	return s.lastLink, nil
+}
+
+// GetLinkByShortURL возвращает ссылку по короткому идентификатору (в том числе из корзины) или nil, nil
+func (s *Storage) GetLinkByShortURL(ctx context.Context, shortURL string) (*db.Link, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.shortURLs[shortURL]
+	if !ok {
+		return nil, nil
+	}
+
+	return cloneLink(s.links[id]), nil
+}
+
+// GetLinkByOriginalURL возвращает активные ссылки с заданным оригинальным URL
+func (s *Storage) GetLinkByOriginalURL(ctx context.Context, originalURL string, ownerID *int) ([]*db.Link, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	links := make([]*db.Link, 0)
+	for id := range s.originals[originalURL] {
+		if link := s.links[id]; link.DeletedAt == nil && ownedBy(link, ownerID) {
+			links = append(links, cloneLink(link))
+		}
+	}
+
+	return links, nil
+}
+
+// IncrementClicks увеличивает оба счётчика переходов ссылки на единицу
+func (s *Storage) IncrementClicks(ctx context.Context, linkID int64) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if link, ok := s.links[int(linkID)]; ok {
+		link.ClicksCount++
+		link.DedupClicksCount++
+	}
+
+	return nil
+}
+
+// AddClicks увеличивает счётчики переходов нескольких ссылок
+func (s *Storage) AddClicks(ctx context.Context, counts map[int]db.ClickDelta) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, delta := range counts {
+		if link, ok := s.links[id]; ok {
+			link.ClicksCount += delta.Raw
+			link.DedupClicksCount += delta.Dedup
+		}
+	}
+
+	return nil
+}
+
+// UpdateLink изменяет поля активной ссылки, переданные в upd (nil, если ссылка не найдена)
+func (s *Storage) UpdateLink(ctx context.Context, shortURL string, upd db.LinkUpdate) (*db.Link, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.shortURLs[shortURL]
+	if !ok || s.links[id].DeletedAt != nil {
+		return nil, nil
+	}
+
+	link := cloneLink(s.links[id])
+
+	if upd.OriginalURL != nil {
+		s.unindexOriginal(link.OriginalURL, id)
+		link.OriginalURL = *upd.OriginalURL
+		s.indexOriginal(link.OriginalURL, id)
+	}
+	if upd.ResetExpiresAt {
+		link.ExpiresAt = nil
+	} else if upd.ExpiresAt != nil {
+		expiresAt := *upd.ExpiresAt
+		link.ExpiresAt = &expiresAt
+	}
+	if upd.ResetMaxClicks {
+		link.MaxClicks = nil
+	} else if upd.MaxClicks != nil {
+		maxClicks := *upd.MaxClicks
+		link.MaxClicks = &maxClicks
+	}
+	if upd.RedirectType != nil {
+		link.RedirectType = *upd.RedirectType
+	}
+	if upd.PassQuery != nil {
+		link.PassQuery = *upd.PassQuery
+	}
+
+	s.links[id] = link
+
+	return cloneLink(link), nil
+}
+
+// DeleteLink перемещает активную ссылку в корзину (nil, если ссылка не найдена)
+func (s *Storage) DeleteLink(ctx context.Context, shortURL string) (*db.Link, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.shortURLs[shortURL]
+	if !ok || s.links[id].DeletedAt != nil {
+		return nil, nil
+	}
+
+	deletedAt := now()
+	s.links[id].DeletedAt = &deletedAt
+
+	return cloneLink(s.links[id]), nil
+}
+
+// RestoreLink возвращает ссылку из корзины (nil, если в корзине её нет)
+func (s *Storage) RestoreLink(ctx context.Context, shortURL string) (*db.Link, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.shortURLs[shortURL]
+	if !ok || s.links[id].DeletedAt == nil {
+		return nil, nil
+	}
+
+	s.links[id].DeletedAt = nil
+
+	return cloneLink(s.links[id]), nil
+}
+
+// GetDeletedLinks возвращает ссылки из корзины, начиная с удалённых последними
+func (s *Storage) GetDeletedLinks(ctx context.Context, ownerID *int) ([]*db.Link, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.selectLinks(func(link *db.Link) bool {
+		return link.DeletedAt != nil && ownedBy(link, ownerID)
+	}, func(a, b *db.Link) int {
+		return b.DeletedAt.Compare(*a.DeletedAt)
+	}), nil
+}
+
+// GetLinks возвращает 20 последних созданных активных ссылок
+func (s *Storage) GetLinks(ctx context.Context, ownerID *int) ([]*db.Link, error) {
+
+	const limitGetLinks = 20
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	links := s.selectLinks(func(link *db.Link) bool {
+		return link.DeletedAt == nil && ownedBy(link, ownerID)
+	}, newestFirst)
+
+	return links[:min(len(links), limitGetLinks)], nil
+}
+
+// GetPopularLinks возвращает не более limit активных ссылок с наибольшим числом переходов за крайний period времени
+// (при равенстве - более новые ссылки)
+func (s *Storage) GetPopularLinks(ctx context.Context, period time.Duration, limit int) ([]*db.Link, error) {
+
+	threshold := time.Now().Add(-period).Truncate(time.Microsecond)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clicks := make(map[int]int)
+	for _, a := range s.clicks {
+		if !a.AccessedAt.Before(threshold) {
+			clicks[a.LinkID]++
+		}
+	}
+
+	links := s.selectLinks(func(link *db.Link) bool {
+		return clicks[link.ID] > 0 && link.DeletedAt == nil
+	}, func(a, b *db.Link) int {
+		if c := cmp.Compare(clicks[b.ID], clicks[a.ID]); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+
+	return links[:min(len(links), limit)], nil
+}
+
+// SearchByOriginalURL ищет активные ссылки, OriginalURL которых содержит подстроку search (регистронезависимо)
+func (s *Storage) SearchByOriginalURL(ctx context.Context, search string, ownerID *int) ([]*db.Link, error) {
+
+	search = strings.ToLower(search)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.selectLinks(func(link *db.Link) bool {
+		return strings.Contains(strings.ToLower(link.OriginalURL), search) && link.DeletedAt == nil && ownedBy(link, ownerID)
+	}, newestFirst), nil
+}
+
+// SearchByShortURL ищет активные ссылки, ShortURL которых содержит подстроку search (регистронезависимо)
+func (s *Storage) SearchByShortURL(ctx context.Context, search string, ownerID *int) ([]*db.Link, error) {
+
+	search = strings.ToLower(search)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.selectLinks(func(link *db.Link) bool {
+		return strings.Contains(strings.ToLower(link.ShortURL), search) && link.DeletedAt == nil && ownedBy(link, ownerID)
+	}, newestFirst), nil
+}
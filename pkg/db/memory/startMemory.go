@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/wb-go/wbf/logger"
+)
+
+// Storage хранит ссылки, переходы и пользователей в памяти процесса
+// (для разработки и тестов: данные пропадают при остановке сервиса)
+type Storage struct {
+	mu sync.RWMutex
+
+	links     map[int]*db.Link            // ссылки по идентификатору
+	shortURLs map[string]int              // идентификаторы ссылок по короткому идентификатору
+	originals map[string]map[int]struct{} // идентификаторы ссылок по оригинальному URL (аналог индекса original_url)
+	lastLink  int                         // последний выданный идентификатор ссылки (аналог последовательности links.id)
+	clicks    []*db.Analytics             // все переходы в порядке записи
+	byLink    map[int][]*db.Analytics     // переходы по идентификатору ссылки в порядке записи
+	lastClick int64                       // последний выданный идентификатор перехода
+
+	users     map[int]*db.User // пользователи по идентификатору
+	userNames map[string]int   // идентификаторы пользователей по имени
+	lastUser  int              // последний выданный идентификатор пользователя
+	apiKeys   map[string]int   // владельцы API-ключей по хэшу ключа
+
+	visitors    map[visit]struct{} // посетители ссылок по дням без повторов
+	visitorSalt string             // соль хэширования посетителей
+}
+
+// visit - посетитель ссылки за день (ключ link_visitors)
+type visit struct {
+	linkID  int
+	day     string
+	visitor int64
+}
+
+// InitMemory создаёт пустое хранилище в памяти
+func InitMemory(log logger.Logger) *Storage {
+
+	log.Warn("данные хранятся в памяти и будут потеряны при остановке сервиса")
+
+	return &Storage{
+		links:     make(map[int]*db.Link),
+		shortURLs: make(map[string]int),
+		originals: make(map[string]map[int]struct{}),
+		byLink:    make(map[int][]*db.Analytics),
+		users:     make(map[int]*db.User),
+		userNames: make(map[string]int),
+		apiKeys:   make(map[string]int),
+		visitors:  make(map[visit]struct{}),
+	}
+}
+
+// Close ничего не освобождает: у хранилища в памяти нет соединений
+func (s *Storage) Close() {}
+
+// now возвращает текущее время с точностью PostgreSQL (микросекунды)
+func now() time.Time {
+
+	return time.Now().Truncate(time.Microsecond)
+}
@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// CreateUser добавляет нового пользователя (db.ErrUserExists, если имя занято)
+func (s *Storage) CreateUser(ctx context.Context, name string, isAdmin bool) (*db.User, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.userNames[name]; ok {
+		return nil, db.ErrUserExists
+	}
+
+	s.lastUser++
+	user := &db.User{
+		ID:        s.lastUser,
+		Name:      name,
+		IsAdmin:   isAdmin,
+		CreatedAt: now(),
+	}
+
+	s.users[user.ID] = user
+	s.userNames[name] = user.ID
+
+	created := *user
+	return &created, nil
+}
+
+// GetUserByName возвращает пользователя по имени (или nil, nil)
+func (s *Storage) GetUserByName(ctx context.Context, name string) (*db.User, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.userNames[name]
+	if !ok {
+		return nil, nil
+	}
+
+	user := *s.users[id]
+	return &user, nil
+}
+
+// AddAPIKey сохраняет хэш нового API-ключа пользователя (повторное добавление того же хэша игнорируется)
+func (s *Storage) AddAPIKey(ctx context.Context, userID int, keyHash string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("ошибка добавления API-ключа в AddAPIKey: нет пользователя %d", userID)
+	}
+
+	if _, ok := s.apiKeys[keyHash]; !ok {
+		s.apiKeys[keyHash] = userID
+	}
+
+	return nil
+}
+
+// ReplaceAPIKeys делает ключ единственным действующим ключом пользователя
+// (отозванные ключи в памяти не хранятся); возвращает число отозванных
+func (s *Storage) ReplaceAPIKeys(ctx context.Context, userID int, keyHash string) (int, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return 0, fmt.Errorf("ошибка добавления API-ключа в ReplaceAPIKeys: нет пользователя %d", userID)
+	}
+
+	if _, ok := s.apiKeys[keyHash]; !ok {
+		s.apiKeys[keyHash] = userID
+	}
+
+	revoked := 0
+	for hash, owner := range s.apiKeys {
+		if owner == userID && hash != keyHash {
+			delete(s.apiKeys, hash)
+			revoked++
+		}
+	}
+
+	return revoked, nil
+}
+
+// GetUserByKeyHash возвращает владельца API-ключа по его хэшу (или nil, nil)
+func (s *Storage) GetUserByKeyHash(ctx context.Context, keyHash string) (*db.User, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.apiKeys[keyHash]
+	if !ok {
+		return nil, nil
+	}
+
+	user := *s.users[id]
+	return &user, nil
+}
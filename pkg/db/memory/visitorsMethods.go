@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// AddVisitors сохраняет посетителей ссылок по дням (повторный посетитель за день не дублируется)
+func (s *Storage) AddVisitors(ctx context.Context, visits []db.Visit) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, v := range visits {
+		s.visitors[visit{linkID: v.LinkID, day: v.Day.Format(time.DateOnly), visitor: v.Visitor}] = struct{}{}
+	}
+
+	return nil
+}
+
+// CountVisitors - число уникальных посетителей ссылки за дни [from, to] по дням и за весь период
+func (s *Storage) CountVisitors(ctx context.Context, linkID int, from, to time.Time) (int, map[string]int, error) {
+
+	dayFrom, dayTo := from.Format(time.DateOnly), to.Format(time.DateOnly)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	byDay := make(map[string]int)
+	distinct := make(map[int64]struct{})
+	for v := range s.visitors {
+		if v.linkID != linkID || v.day < dayFrom || v.day > dayTo {
+			continue
+		}
+		byDay[v.day]++
+		distinct[v.visitor] = struct{}{}
+	}
+
+	return len(distinct), byDay, nil
+}
+
+// VisitorSalt возвращает соль хэширования посетителей, заданную первым вызовом
+// (хранилище в памяти живёт в одном процессе, поэтому соль общая только для него)
+func (s *Storage) VisitorSalt(ctx context.Context, candidate string) (string, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.visitorSalt == "" {
+		s.visitorSalt = candidate
+	}
+
+	return s.visitorSalt, nil
+}
@@ -2,48 +2,299 @@ package db
 
 import (
 	"context"
+	"embed"
 	"fmt"
-)
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
-const (
-	linksSchema = `CREATE TABLE IF NOT EXISTS links (
-			           id SERIAL PRIMARY KEY,
-		        short_url VARCHAR(50) UNIQUE NOT NULL,
-		     original_url TEXT NOT NULL,
-		       created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-		        is_custom BOOLEAN NOT NULL DEFAULT FALSE,
-		     clicks_count INT NOT NULL DEFAULT 0);
-			 
-			 CREATE INDEX IF NOT EXISTS idx_links_short_url ON links(short_url);
-		     CREATE INDEX IF NOT EXISTS idx_links_created_at ON links(created_at);`
-
-	analyticsSchema = `CREATE TABLE IF NOT EXISTS analytics (
-			               id SERIAL PRIMARY KEY,
-			          link_id INT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
-			      accessed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-			       user_agent TEXT,
-			       ip_address INET,
-			          referer TEXT);
-			
-				 CREATE INDEX IF NOT EXISTS idx_analytics_link_id_accessed_at ON analytics(link_id, accessed_at);
-		         CREATE INDEX IF NOT EXISTS idx_analytics_accessed_at ON analytics(accessed_at);`
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// Migration создаёт таблицы links и analytics, если они ещё не существуют, добавляет индексы
-func (d *DataBase) Migration(ctx context.Context) error {
+// migrationsLockID - ключ advisory-блокировки, под которой применяются миграции
+// (экземпляры сервиса, запущенные одновременно, выполняют их по очереди)
+const migrationsLockID = 0x6d696772
+
+// migrationFiles - нумерованные миграции: NNNN_название.up.sql и NNNN_название.down.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// schemaMigrationsTable - учёт применённых миграций
+const schemaMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+			          version INT PRIMARY KEY,
+			             name VARCHAR(255) NOT NULL,
+			       applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW())`
+
+// migration - одна нумерованная миграция схемы
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// loadMigrations читает встроенные миграции, упорядоченные по номеру;
+// у каждой миграции должны быть оба скрипта, номера не повторяются
+func loadMigrations() ([]migration, error) {
+
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения встроенных миграций: %w", err)
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		file := entry.Name()
+
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("неверное имя файла миграции %s", file)
+		}
+
+		number, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("неверный номер миграции в имени файла %s", file)
+		}
+
+		script, err := migrationFiles.ReadFile(path.Join("migrations", file))
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения миграции %s: %w", file, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		}
+		if m.name != name {
+			return nil, fmt.Errorf("миграция %d названа по-разному: %s и %s", version, m.name, name)
+		}
+
+		if direction == "up" {
+			m.up = string(script)
+		} else {
+			m.down = string(script)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("у миграции %04d_%s нет скрипта up или down", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	slices.SortFunc(migrations, func(a, b migration) int { return a.version - b.version })
+
+	return migrations, nil
+}
+
+// Migration применяет недостающие миграции и создаёт секции analytics на текущий и следующий месяц
+// (секции на дальнейшие месяцы создаёт обслуживание секций), возвращает номера применённых миграций
+func (d *DataBase) Migration(ctx context.Context) ([]int, error) {
+
+	applied, err := d.MigrateUp(ctx)
+	if err != nil {
+		return applied, err
+	}
+
+	if err = ensurePartitions(ctx, d.Pool, time.Now(), time.Now().AddDate(0, 1, 0)); err != nil {
+		return applied, err
+	}
+
+	return applied, nil
+}
+
+// MigrateUp применяет все ещё не применённые миграции по возрастанию номера, каждую в своей транзакции
+func (d *DataBase) MigrateUp(ctx context.Context) ([]int, error) {
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []int
+	err = d.withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := done[m.version]; ok {
+				continue
+			}
+
+			err := applyMigration(ctx, conn, m.up, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.version, m.name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("ошибка применения миграции %04d_%s: %w", m.version, m.name, err)
+			}
+
+			applied = append(applied, m.version)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// MigrateDown откатывает steps последних применённых миграций (от новых к старым), возвращает их номера
+func (d *DataBase) MigrateDown(ctx context.Context, steps int) ([]int, error) {
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []int
+	err = d.withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			m := migrations[i]
+			if _, ok := done[m.version]; !ok {
+				continue
+			}
+
+			err := applyMigration(ctx, conn, m.down, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("ошибка отката миграции %04d_%s: %w", m.version, m.name, err)
+			}
+
+			reverted = append(reverted, m.version)
+		}
+
+		return nil
+	})
 
-	// создаём таблицу links с индексами
-	query := linksSchema
-	_, err := d.Pool.Exec(ctx, query)
+	return reverted, err
+}
+
+// MigrationStatus возвращает все известные миграции с отметкой о применении
+// (и применённые миграции, которых нет в этой версии сервиса)
+func (d *DataBase) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+
+	migrations, err := loadMigrations()
 	if err != nil {
-		return fmt.Errorf("ошибка создания таблицы links: %w", err)
+		return nil, err
 	}
 
-	// создаём таблицу analytics с индексами
-	query = analyticsSchema
-	_, err = d.Pool.Exec(ctx, query)
+	var statuses []MigrationStatus
+	err = d.withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			status := MigrationStatus{Version: m.version, Name: m.name}
+			if applied, ok := done[m.version]; ok {
+				status.AppliedAt = applied.AppliedAt
+				delete(done, m.version)
+			}
+			statuses = append(statuses, status)
+		}
+
+		for _, unknown := range done {
+			statuses = append(statuses, unknown)
+		}
+
+		return nil
+	})
+
+	slices.SortFunc(statuses, func(a, b MigrationStatus) int { return a.Version - b.Version })
+
+	return statuses, err
+}
+
+// withMigrationLock выполняет fn на отдельном соединении под сессионной advisory-блокировкой
+func (d *DataBase) withMigrationLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+
+	conn, err := d.Pool.Acquire(ctx)
 	if err != nil {
-		return fmt.Errorf("ошибка создания таблицы analytics: %w", err)
+		return fmt.Errorf("ошибка получения соединения для миграций: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationsLockID); err != nil {
+		return fmt.Errorf("ошибка блокировки миграций: %w", err)
+	}
+	defer func() {
+		// блокировка снимается и при закрытии соединения, поэтому ошибку здесь можно не возвращать
+		_, _ = conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationsLockID)
+	}()
+
+	if _, err = conn.Exec(ctx, schemaMigrationsTable); err != nil {
+		return fmt.Errorf("ошибка создания таблицы schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// appliedMigrations возвращает применённые миграции по номерам
+func appliedMigrations(ctx context.Context, conn *pgxpool.Conn) (map[int]MigrationStatus, error) {
+
+	rows, err := conn.Query(ctx, `SELECT version, name, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	done := make(map[int]MigrationStatus)
+	for rows.Next() {
+		var s MigrationStatus
+		var appliedAt time.Time
+		if err := rows.Scan(&s.Version, &s.Name, &appliedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании schema_migrations: %w", err)
+		}
+		s.AppliedAt = &appliedAt
+		done[s.Version] = s
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по schema_migrations: %w", err)
+	}
+
+	return done, nil
+}
+
+// applyMigration выполняет скрипт и отметку в schema_migrations в одной транзакции
+func applyMigration(ctx context.Context, conn *pgxpool.Conn, script string, record func(tx pgx.Tx) error) error {
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// без параметров скрипт уходит простым протоколом и может состоять из нескольких команд
+	if _, err = tx.Exec(ctx, script); err != nil {
+		return err
+	}
+
+	if err = record(tx); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка завершения транзакции: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS rollup_state;
+DROP TABLE IF EXISTS link_daily_dimensions;
+DROP TABLE IF EXISTS link_daily_stats;
+DROP TABLE IF EXISTS link_visitors;
+DROP TABLE IF EXISTS analytics;
+DROP TABLE IF EXISTS links;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS users;
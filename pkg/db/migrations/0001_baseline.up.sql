@@ -0,0 +1,93 @@
+-- исходная схема: повторяет таблицы, которые создавали прежние версии сервиса при старте,
+-- поэтому на существующей базе лишь добавляет недостающие колонки и индексы
+
+CREATE TABLE IF NOT EXISTS users (
+           id SERIAL PRIMARY KEY,
+         name VARCHAR(100) UNIQUE NOT NULL,
+     is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+   created_at TIMESTAMPTZ NOT NULL DEFAULT NOW());
+
+CREATE TABLE IF NOT EXISTS api_keys (
+           id SERIAL PRIMARY KEY,
+      user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+     key_hash CHAR(64) UNIQUE NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+   revoked_at TIMESTAMPTZ);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+
+CREATE TABLE IF NOT EXISTS links (
+           id SERIAL PRIMARY KEY,
+    short_url VARCHAR(50) UNIQUE NOT NULL,
+ original_url TEXT NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    is_custom BOOLEAN NOT NULL DEFAULT FALSE,
+ clicks_count INT NOT NULL DEFAULT 0);
+
+ALTER TABLE links ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+ALTER TABLE links ADD COLUMN IF NOT EXISTS max_clicks INT;
+ALTER TABLE links ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE links ADD COLUMN IF NOT EXISTS owner_id INT REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE links ADD COLUMN IF NOT EXISTS redirect_type VARCHAR(16) NOT NULL DEFAULT '302';
+ALTER TABLE links ADD COLUMN IF NOT EXISTS pass_query BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE links ADD COLUMN IF NOT EXISTS dedup_clicks_count INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_links_short_url ON links(short_url);
+CREATE INDEX IF NOT EXISTS idx_links_created_at ON links(created_at);
+CREATE INDEX IF NOT EXISTS idx_links_deleted_at ON links(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_links_owner_id ON links(owner_id);
+
+CREATE TABLE IF NOT EXISTS analytics (
+           id SERIAL PRIMARY KEY,
+      link_id INT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+  accessed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+   user_agent TEXT,
+   ip_address INET,
+      referer TEXT);
+
+ALTER TABLE analytics ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE analytics ADD COLUMN IF NOT EXISTS is_repeat BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE analytics ADD COLUMN IF NOT EXISTS browser VARCHAR(32);
+ALTER TABLE analytics ADD COLUMN IF NOT EXISTS browser_version VARCHAR(16);
+ALTER TABLE analytics ADD COLUMN IF NOT EXISTS os VARCHAR(32);
+ALTER TABLE analytics ADD COLUMN IF NOT EXISTS os_version VARCHAR(16);
+ALTER TABLE analytics ADD COLUMN IF NOT EXISTS device VARCHAR(16);
+ALTER TABLE analytics ADD COLUMN IF NOT EXISTS country VARCHAR(2);
+ALTER TABLE analytics ADD COLUMN IF NOT EXISTS region VARCHAR(128);
+ALTER TABLE analytics ADD COLUMN IF NOT EXISTS city VARCHAR(128);
+ALTER TABLE analytics ADD COLUMN IF NOT EXISTS asn INT;
+ALTER TABLE analytics ADD COLUMN IF NOT EXISTS as_org VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_analytics_link_id_accessed_at ON analytics(link_id, accessed_at);
+CREATE INDEX IF NOT EXISTS idx_analytics_link_id_id ON analytics(link_id, id);
+CREATE INDEX IF NOT EXISTS idx_analytics_accessed_at ON analytics(accessed_at);
+
+CREATE TABLE IF NOT EXISTS link_visitors (
+      link_id INT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+          day DATE NOT NULL,
+      visitor BIGINT NOT NULL,
+  PRIMARY KEY (link_id, day, visitor));
+
+CREATE TABLE IF NOT EXISTS link_daily_stats (
+      link_id INT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+          day DATE NOT NULL,
+       is_bot BOOLEAN NOT NULL,
+       clicks INT NOT NULL,
+     visitors INT NOT NULL,
+  PRIMARY KEY (link_id, day, is_bot));
+
+CREATE TABLE IF NOT EXISTS link_daily_dimensions (
+      link_id INT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+          day DATE NOT NULL,
+       is_bot BOOLEAN NOT NULL,
+    dimension VARCHAR(32) NOT NULL,
+        value TEXT NOT NULL,
+       clicks INT NOT NULL,
+  PRIMARY KEY (link_id, dimension, is_bot, day, value));
+
+CREATE TABLE IF NOT EXISTS rollup_state (
+           id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+ rolled_until DATE NOT NULL);
+
+CREATE INDEX IF NOT EXISTS idx_link_daily_stats_day ON link_daily_stats(day);
+CREATE INDEX IF NOT EXISTS idx_link_daily_dimensions_day ON link_daily_dimensions(day);
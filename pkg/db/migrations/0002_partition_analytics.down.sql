@@ -0,0 +1,43 @@
+-- analytics возвращается в одну несекционированную таблицу (id остаётся BIGINT, чтобы не потерять значения);
+-- архивные секции в схеме analytics_archive не затрагиваются
+
+ALTER TABLE analytics RENAME TO analytics_partitioned;
+ALTER TABLE analytics_partitioned RENAME CONSTRAINT analytics_pkey TO analytics_partitioned_pkey;
+ALTER SEQUENCE analytics_id_seq RENAME TO analytics_partitioned_id_seq;
+DROP INDEX IF EXISTS idx_analytics_link_id_accessed_at;
+DROP INDEX IF EXISTS idx_analytics_link_id_id;
+DROP INDEX IF EXISTS idx_analytics_accessed_at;
+
+CREATE TABLE analytics (
+               id BIGSERIAL PRIMARY KEY,
+          link_id INT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+      accessed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+       user_agent TEXT,
+       ip_address INET,
+          referer TEXT,
+           is_bot BOOLEAN NOT NULL DEFAULT FALSE,
+        is_repeat BOOLEAN NOT NULL DEFAULT FALSE,
+          browser VARCHAR(32),
+  browser_version VARCHAR(16),
+               os VARCHAR(32),
+       os_version VARCHAR(16),
+           device VARCHAR(16),
+          country VARCHAR(2),
+           region VARCHAR(128),
+             city VARCHAR(128),
+              asn INT,
+           as_org VARCHAR(255));
+
+INSERT INTO analytics (id, link_id, accessed_at, user_agent, ip_address, referer, is_bot, is_repeat,
+                       browser, browser_version, os, os_version, device, country, region, city, asn, as_org)
+SELECT id, link_id, accessed_at, user_agent, ip_address, referer, is_bot, is_repeat,
+       browser, browser_version, os, os_version, device, country, region, city, asn, as_org
+  FROM analytics_partitioned;
+
+SELECT SETVAL('analytics_id_seq', COALESCE((SELECT MAX(id) FROM analytics), 0) + 1, FALSE);
+
+DROP TABLE analytics_partitioned;
+
+CREATE INDEX idx_analytics_link_id_accessed_at ON analytics(link_id, accessed_at);
+CREATE INDEX idx_analytics_link_id_id ON analytics(link_id, id);
+CREATE INDEX idx_analytics_accessed_at ON analytics(accessed_at);
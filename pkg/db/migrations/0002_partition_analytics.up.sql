@@ -0,0 +1,70 @@
+-- analytics секционируется по месяцам accessed_at с идентификатором BIGINT;
+-- переходы переносятся с сохранением id, в секцию по умолчанию попадают переходы вне созданных секций
+
+DO $$
+DECLARE
+    first_month TIMESTAMP;
+    m TIMESTAMP;
+BEGIN
+    -- таблица уже секционирована (создана версией сервиса до нумерованных миграций)
+    IF (SELECT relkind FROM pg_class WHERE oid = TO_REGCLASS('analytics')) = 'p' THEN
+        RETURN;
+    END IF;
+
+    SELECT DATE_TRUNC('month', MIN(accessed_at) AT TIME ZONE 'UTC') INTO first_month FROM analytics;
+
+    ALTER TABLE analytics RENAME TO analytics_legacy;
+    ALTER TABLE analytics_legacy RENAME CONSTRAINT analytics_pkey TO analytics_legacy_pkey;
+    ALTER SEQUENCE IF EXISTS analytics_id_seq RENAME TO analytics_legacy_id_seq;
+    DROP INDEX IF EXISTS idx_analytics_link_id_accessed_at;
+    DROP INDEX IF EXISTS idx_analytics_link_id_id;
+    DROP INDEX IF EXISTS idx_analytics_accessed_at;
+
+    CREATE TABLE analytics (
+               id BIGSERIAL,
+          link_id INT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+      accessed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+       user_agent TEXT,
+       ip_address INET,
+          referer TEXT,
+           is_bot BOOLEAN NOT NULL DEFAULT FALSE,
+        is_repeat BOOLEAN NOT NULL DEFAULT FALSE,
+          browser VARCHAR(32),
+  browser_version VARCHAR(16),
+               os VARCHAR(32),
+       os_version VARCHAR(16),
+           device VARCHAR(16),
+          country VARCHAR(2),
+           region VARCHAR(128),
+             city VARCHAR(128),
+              asn INT,
+           as_org VARCHAR(255),
+      PRIMARY KEY (id, accessed_at))
+    PARTITION BY RANGE (accessed_at);
+
+    CREATE TABLE analytics_default PARTITION OF analytics DEFAULT;
+
+    CREATE INDEX idx_analytics_link_id_accessed_at ON analytics(link_id, accessed_at);
+    CREATE INDEX idx_analytics_link_id_id ON analytics(link_id, id);
+    CREATE INDEX idx_analytics_accessed_at ON analytics(accessed_at);
+
+    -- секции с месяца первого перехода по следующий месяц (дальше их создаёт сервис)
+    FOR m IN SELECT GENERATE_SERIES(COALESCE(first_month, DATE_TRUNC('month', NOW() AT TIME ZONE 'UTC')),
+                                    DATE_TRUNC('month', NOW() AT TIME ZONE 'UTC') + INTERVAL '1 month',
+                                    INTERVAL '1 month')
+    LOOP
+        EXECUTE FORMAT('CREATE TABLE %I PARTITION OF analytics FOR VALUES FROM (%L) TO (%L)',
+                       'analytics_y' || TO_CHAR(m, 'YYYY') || 'm' || TO_CHAR(m, 'MM'),
+                       m AT TIME ZONE 'UTC', (m + INTERVAL '1 month') AT TIME ZONE 'UTC');
+    END LOOP;
+
+    INSERT INTO analytics (id, link_id, accessed_at, user_agent, ip_address, referer, is_bot, is_repeat,
+                           browser, browser_version, os, os_version, device, country, region, city, asn, as_org)
+    SELECT id, link_id, accessed_at, user_agent, ip_address, referer, is_bot, is_repeat,
+           browser, browser_version, os, os_version, device, country, region, city, asn, as_org
+      FROM analytics_legacy;
+
+    PERFORM SETVAL('analytics_id_seq', COALESCE((SELECT MAX(id) FROM analytics), 0) + 1, FALSE);
+
+    DROP TABLE analytics_legacy;
+END $$;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_links_original_url_hash;
@@ -0,0 +1,3 @@
+-- поиск ссылок по оригинальному URL (переиспользование ссылок при создании) идёт по хэш-индексу:
+-- длинные URL не помещаются в строку B-дерева, а поиск нужен только на равенство
+CREATE INDEX IF NOT EXISTS idx_links_original_url_hash ON links USING HASH (original_url);
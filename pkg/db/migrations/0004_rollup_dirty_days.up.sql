@@ -0,0 +1,6 @@
+-- дни, уже свёрнутые в сводки, в которые позже записались переходы (очередь записи переходов не успела
+-- до сворачивания), и дни, сводку которых построить не удалось: сводки таких дней пересчитываются заново
+-- (failures - число неудачных попыток, после rollupMaxFailures день больше не пересчитывается)
+CREATE TABLE IF NOT EXISTS rollup_dirty_days (
+          day DATE PRIMARY KEY,
+     failures INT NOT NULL DEFAULT 0);
@@ -0,0 +1,5 @@
+-- настройки, общие для всех экземпляров сервиса (например, соль хэширования посетителей:
+-- с разной солью экземпляры по-разному считали бы уникальных посетителей и повторные переходы)
+CREATE TABLE IF NOT EXISTS service_settings (
+         name VARCHAR(64) PRIMARY KEY,
+        value TEXT NOT NULL);
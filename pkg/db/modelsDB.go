@@ -7,20 +7,155 @@ import (
 
 // Link представляет запись в таблице links
 type Link struct {
-	ID          int       // внутренний идентификатор ссылки (автоинкремент)
-	ShortURL    string    // короткий идентификатор (например, "abc123"), уникален в пределах таблицы
-	OriginalURL string    // исходный длинный URL
-	CreatedAt   time.Time // дата и время создания записи
-	IsCustom    bool      // флаг, указывающий, что short_url задан пользователем
-	ClicksCount int       // количество переходов по ссылке (чтобы всё время COUNT не делать)
+	ID           int        // внутренний идентификатор ссылки (автоинкремент)
+	ShortURL     string     // короткий идентификатор (например, "abc123"), уникален в пределах таблицы
+	OriginalURL  string     // исходный длинный URL
+	CreatedAt    time.Time  // дата и время создания записи
+	IsCustom     bool       // флаг, указывающий, что short_url задан пользователем
+	ClicksCount  int        // количество переходов по ссылке (чтобы всё время COUNT не делать)
+	ExpiresAt    *time.Time // момент, после которого ссылка перестаёт работать (nil - бессрочно)
+	MaxClicks    *int       // допустимое количество переходов (nil - без ограничений)
+	DeletedAt    *time.Time // момент перемещения ссылки в корзину (nil - ссылка активна)
+	OwnerID      *int       // владелец ссылки (nil - ссылка создана без аутентификации)
+	RedirectType string     // способ перенаправления: "301", "302", "307", "308" или "interstitial"
+	PassQuery    bool       // добавлять ли параметры запроса посетителя к OriginalURL
+
+	DedupClicksCount int // количество переходов без повторов одного посетителя в окне дедупликации
+}
+
+// способы перенаправления по короткой ссылке (links.redirect_type)
+const (
+	RedirectMovedPermanently = "301"          // постоянное перенаправление, кэшируется браузером
+	RedirectFound            = "302"          // временное перенаправление (по умолчанию)
+	RedirectTemporary        = "307"          // временное с сохранением метода и тела запроса
+	RedirectPermanent        = "308"          // постоянное с сохранением метода и тела запроса
+	RedirectInterstitial     = "interstitial" // промежуточная страница с meta refresh и JS
+)
+
+// LinkOptions - необязательные параметры создаваемой ссылки
+type LinkOptions struct {
+	ID           int        // заранее зарезервированный через NextLinkID идентификатор (0 - назначит БД)
+	ExpiresAt    *time.Time // момент истечения срока действия ссылки
+	MaxClicks    *int       // бюджет переходов по ссылке
+	OwnerID      *int       // владелец ссылки
+	RedirectType string     // способ перенаправления (пусто - RedirectFound)
+	PassQuery    bool       // передавать параметры запроса посетителя
+}
+
+// LinkUpdate - изменяемые поля ссылки (nil - поле не меняется)
+type LinkUpdate struct {
+	OriginalURL    *string    // новый адрес перенаправления
+	ExpiresAt      *time.Time // новый срок действия
+	MaxClicks      *int       // новый бюджет переходов
+	ResetExpiresAt bool       // снять ограничение по сроку действия
+	ResetMaxClicks bool       // снять ограничение по количеству переходов
+	RedirectType   *string    // новый способ перенаправления
+	PassQuery      *bool      // передавать ли параметры запроса посетителя
 }
 
 // Analytics представляет запись о переходе по короткой ссылке
 type Analytics struct {
-	ID         int       // уникальный идентификатор записи о переходе (автоинкремент)
+	ID         int64     // уникальный идентификатор записи о переходе (автоинкремент)
 	LinkID     int       // идентификатор ссылки, по которой совершён переход
 	AccessedAt time.Time // момент времени, когда произошёл переход
 	UserAgent  string    // строка User-Agent браузера или клиента
 	IPAddress  net.IP    // IP-адрес посетителя
 	Referer    string    // URL источника перехода
+	IsBot      bool      // переход совершён ботом или краулером (превью в мессенджерах, поисковые роботы)
+	IsRepeat   bool      // повтор перехода того же посетителя в окне дедупликации
+
+	// измерения, полученные разбором User-Agent при записи
+	Browser        string // семейство браузера
+	BrowserVersion string // мажорная версия браузера
+	OS             string // семейство ОС
+	OSVersion      string // версия ОС
+	Device         string // класс устройства: desktop, mobile, tablet или bot
+
+	// местоположение, определённое по IP-адресу при записи (GeoIP)
+	Country string // ISO-код страны
+	Region  string // регион
+	City    string // город
+	ASN     int    // номер автономной системы (0 - не определён)
+	ASOrg   string // организация автономной системы
+}
+
+// ClickDelta - прирост счётчиков переходов ссылки
+type ClickDelta struct {
+	Raw   int // все переходы людей
+	Dedup int // переходы без повторов в окне дедупликации
+}
+
+// Visit - посетитель ссылки за день (для подсчёта уникальных посетителей без Redis)
+type Visit struct {
+	LinkID  int       // идентификатор ссылки
+	Day     time.Time // день перехода (UTC)
+	Visitor int64     // хэш посетителя (необратимый, см. ingest)
+}
+
+// MigrationStatus - состояние нумерованной миграции схемы
+type MigrationStatus struct {
+	Version   int        // номер миграции
+	Name      string     // название миграции (из имени файла)
+	AppliedAt *time.Time // когда применена (nil - не применена)
+}
+
+// Partition - месячная секция таблицы analytics
+type Partition struct {
+	Name  string    // имя таблицы секции (analytics_yYYYYmMM)
+	Month time.Time // первый день месяца секции (UTC)
+}
+
+// ClickFilter - фильтры журнала переходов (пустые значения не ограничивают выборку)
+type ClickFilter struct {
+	From    *time.Time // переходы не раньше
+	To      *time.Time // переходы раньше
+	Referer string     // подстрока Referer (регистронезависимо)
+	Device  string     // класс устройства: desktop, mobile, tablet или bot
+	IsBot   *bool      // только боты или только люди
+}
+
+// шаги временной шкалы аналитики (значения совпадают с единицами date_trunc в PostgreSQL)
+const (
+	GranularityMinute = "minute"
+	GranularityHour   = "hour"
+	GranularityDay    = "day"
+	GranularityWeek   = "week"
+	GranularityMonth  = "month"
+)
+
+// TimeBucket - количество переходов за один шаг временной шкалы
+type TimeBucket struct {
+	Start  time.Time // начало шага
+	Clicks int       // количество переходов
+}
+
+// измерения аналитики, по которым можно группировать переходы
+const (
+	DimensionUserAgent      = "user_agent"
+	DimensionBrowser        = "browser"
+	DimensionBrowserVersion = "browser_version"
+	DimensionOS             = "os"
+	DimensionOSVersion      = "os_version"
+	DimensionDevice         = "device"
+	DimensionCountry        = "country"
+	DimensionRegion         = "region"
+	DimensionCity           = "city"
+	DimensionASN            = "asn"
+	DimensionReferer        = "referer" // домен источника перехода (direct - без Referer)
+)
+
+// VisitorSaltSetting - имя настройки с солью хэширования посетителей (service_settings)
+const VisitorSaltSetting = "visitor_salt"
+
+// dimensionValueWidth - предельная длина (в символах) значений измерений, которые задаёт посетитель
+// (User-Agent и домен Referer): значение входит в первичный ключ link_daily_dimensions, а строка
+// индекса B-дерева ограничена ~2.7 КБ, поэтому длинный заголовок не должен ломать сворачивание дня
+const dimensionValueWidth = 512
+
+// User представляет пользователя API (запись в таблице users)
+type User struct {
+	ID        int       // идентификатор пользователя
+	Name      string    // уникальное имя пользователя
+	IsAdmin   bool      // администратору доступны все ссылки и раздел /admin
+	CreatedAt time.Time // дата и время создания пользователя
 }
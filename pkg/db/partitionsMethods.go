@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// archiveSchema - схема, в которую переносятся секции analytics при архивировании
+const archiveSchema = "analytics_archive"
+
+// execer - пул соединений или транзакция
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// partitionName возвращает имя секции analytics за месяц month
+func partitionName(month time.Time) string {
+
+	return fmt.Sprintf("analytics_y%04dm%02d", month.Year(), int(month.Month()))
+}
+
+// monthStart возвращает начало месяца t по UTC
+func monthStart(t time.Time) time.Time {
+
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// ensurePartitions создаёт недостающие месячные секции analytics от месяца from до месяца to включительно
+func ensurePartitions(ctx context.Context, db execer, from, to time.Time) error {
+
+	for month := monthStart(from); !month.After(to); month = month.AddDate(0, 1, 0) {
+		query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF analytics FOR VALUES FROM ('%s') TO ('%s')`,
+			pgx.Identifier{partitionName(month)}.Sanitize(),
+			month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339))
+
+		if _, err := db.Exec(ctx, query); err != nil {
+			return fmt.Errorf("ошибка создания секции %s: %w", partitionName(month), err)
+		}
+	}
+
+	return nil
+}
+
+// EnsurePartitions создаёт секции analytics с текущего месяца по месяц to включительно
+func (d *DataBase) EnsurePartitions(ctx context.Context, to time.Time) error {
+
+	return ensurePartitions(ctx, d.Pool, time.Now(), to)
+}
+
+// AnalyticsPartitions возвращает месячные секции analytics (без секции по умолчанию)
+func (d *DataBase) AnalyticsPartitions(ctx context.Context) ([]Partition, error) {
+
+	query := `SELECT c.relname
+	            FROM pg_inherits i
+	            JOIN pg_class c ON c.oid = i.inhrelid
+	           WHERE i.inhparent = 'analytics'::REGCLASS
+	           ORDER BY c.relname`
+
+	rows, err := d.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса в AnalyticsPartitions: %w", err)
+	}
+	defer rows.Close()
+
+	var partitions []Partition
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании строки запроса в AnalyticsPartitions: %w", err)
+		}
+
+		var year, month int
+		if _, err := fmt.Sscanf(name, "analytics_y%4dm%2d", &year, &month); err != nil {
+			continue // секция по умолчанию и чужие таблицы
+		}
+
+		partitions = append(partitions, Partition{
+			Name:  name,
+			Month: time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по списку записей в AnalyticsPartitions: %w", err)
+	}
+
+	return partitions, nil
+}
+
+// RemovePartition отсоединяет секцию analytics и удаляет её (archive = false) или переносит в схему
+// analytics_archive; секция, в которой есть ещё не свёрнутые в сводки переходы или дни с пересчитываемыми
+// сводками, не трогается (false)
+func (d *DataBase) RemovePartition(ctx context.Context, p Partition, archive bool) (bool, error) {
+
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("ошибка открытия транзакции в RemovePartition: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	table := pgx.Identifier{p.Name}.Sanitize()
+
+	// сводки строятся по analytics, поэтому без них удалённые переходы пропали бы из агрегатов
+	query := `SELECT EXISTS (SELECT 1
+	                           FROM ` + table + `
+	                          WHERE accessed_at >= COALESCE((SELECT rolled_until FROM rollup_state)::TIMESTAMP AT TIME ZONE 'UTC',
+	                                                        '-infinity'))
+	             OR EXISTS (SELECT 1
+	                          FROM rollup_dirty_days
+	                         WHERE day >= $1::DATE AND day < ($1::DATE + INTERVAL '1 month'))`
+
+	var pending bool
+	if err = tx.QueryRow(ctx, query, p.Month).Scan(&pending); err != nil {
+		return false, fmt.Errorf("ошибка проверки сводок секции в RemovePartition: %w", err)
+	}
+	if pending {
+		return false, nil
+	}
+
+	if _, err = tx.Exec(ctx, `ALTER TABLE analytics DETACH PARTITION `+table); err != nil {
+		return false, fmt.Errorf("ошибка отсоединения секции в RemovePartition: %w", err)
+	}
+
+	if archive {
+		query = `CREATE SCHEMA IF NOT EXISTS ` + archiveSchema + `;
+		         ALTER TABLE ` + table + ` SET SCHEMA ` + archiveSchema
+	} else {
+		query = `DROP TABLE ` + table
+	}
+
+	if _, err = tx.Exec(ctx, query); err != nil {
+		return false, fmt.Errorf("ошибка удаления секции в RemovePartition: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("ошибка завершения транзакции в RemovePartition: %w", err)
+	}
+
+	return true, nil
+}
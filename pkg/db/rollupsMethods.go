@@ -0,0 +1,355 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// rollupLockID - ключ advisory-блокировки, чтобы дни сворачивал только один экземпляр сервиса
+const rollupLockID = 0x726f6c6c
+
+// clicksLockID - ключ advisory-блокировки между записью переходов (разделяемая) и сворачиванием дня
+// (исключительная): запись видит состояние сводок, в котором её переходы ещё не свёрнуты или уже свёрнуты целиком
+const clicksLockID = 0x636c6b73
+
+// rollupMaxFailures - сколько раз пытаться построить сводку дня, прежде чем оставить его несвёрнутым
+// (день остаётся в rollup_dirty_days, и его секция analytics не удаляется)
+const rollupMaxFailures = 3
+
+// границы "за всё время" для агрегатов без периода
+var (
+	minTime = time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC)
+	maxTime = time.Date(9999, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// условия запросов агрегации со сводками; параметры во всех таких запросах одинаковы (см. rollupSpan.args):
+// $1 - link_id, $2 и $3 - период [from, to), $4 и $5 - свёрнутые дни [dayFrom, dayTo), $6 - is_bot
+const (
+	// rolledDays выбирает из сводки дни [dayFrom, dayTo)
+	rolledDays = `day >= ($4::TIMESTAMPTZ AT TIME ZONE 'UTC')::DATE AND day < ($5::TIMESTAMPTZ AT TIME ZONE 'UTC')::DATE`
+
+	// rawDays выбирает из analytics переходы периода вне свёрнутых дней
+	// (два диапазона, чтобы каждый читался по индексу link_id, accessed_at)
+	rawDays = `((accessed_at >= $2 AND accessed_at < $4) OR (accessed_at >= $5 AND accessed_at < $3))`
+)
+
+// rollupSpan - целые дни UTC [dayFrom, dayTo) периода, которые уже свёрнуты в сводки;
+// остаток периода (неполные дни на краях и ещё не свёрнутые дни, обычно сегодняшний) читается из analytics
+type rollupSpan struct {
+	dayFrom time.Time
+	dayTo   time.Time
+}
+
+// emptySpan - период целиком читается из analytics
+func emptySpan(from time.Time) rollupSpan {
+
+	return rollupSpan{dayFrom: from, dayTo: from}
+}
+
+// newRollupSpan выделяет в [from, to) целые дни до until (первого несвёрнутого дня)
+func newRollupSpan(from, to, until time.Time) rollupSpan {
+
+	dayFrom := utcDay(from)
+	if dayFrom.Before(from) {
+		dayFrom = dayFrom.AddDate(0, 0, 1)
+	}
+
+	dayTo := utcDay(to)
+	if until.Before(dayTo) {
+		dayTo = until
+	}
+
+	if !dayFrom.Before(dayTo) {
+		return emptySpan(from)
+	}
+
+	return rollupSpan{dayFrom: dayFrom, dayTo: dayTo}
+}
+
+// args возвращает параметры $1..$6 запроса агрегации
+func (s rollupSpan) args(linkID int, from, to time.Time, isBot bool) []any {
+
+	return []any{linkID, from, to, s.dayFrom, s.dayTo, isBot}
+}
+
+// rollupSpan читает состояние сводок и делит период [from, to)
+func (d *DataBase) rollupSpan(ctx context.Context, from, to time.Time) (rollupSpan, error) {
+
+	until, err := d.RolledUntil(ctx)
+	if err != nil {
+		return rollupSpan{}, err
+	}
+
+	return newRollupSpan(from, to, until), nil
+}
+
+// rollupGranularity - шаги временной шкалы, которые складываются из целых дней
+func rollupGranularity(granularity string) bool {
+
+	return granularity == GranularityDay || granularity == GranularityWeek || granularity == GranularityMonth
+}
+
+// utcDay возвращает начало дня t по UTC
+func utcDay(t time.Time) time.Time {
+
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// RolledUntil возвращает первый день (UTC), ещё не свёрнутый в сводки (нулевое время, если сводок нет)
+func (d *DataBase) RolledUntil(ctx context.Context) (time.Time, error) {
+
+	query := `SELECT rolled_until FROM rollup_state`
+
+	var until time.Time
+	err := d.Pool.QueryRow(ctx, query).Scan(&until)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ошибка чтения состояния сводок в RolledUntil: %w", err)
+	}
+
+	return until, nil
+}
+
+// saveClicks записывает переходы в одной транзакции с insert и помечает уже свёрнутые дни из accessed
+// как грязные (их сводки пересчитает RollupNextDay), чтобы поздно записанные переходы не пропали из агрегатов
+func (d *DataBase) saveClicks(ctx context.Context, accessed []time.Time, insert func(tx pgx.Tx) error) error {
+
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка открытия транзакции: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock_shared($1)`, clicksLockID); err != nil {
+		return fmt.Errorf("ошибка блокировки сводок: %w", err)
+	}
+
+	if err = insert(tx); err != nil {
+		return err
+	}
+
+	days := make([]time.Time, 0, 1)
+	for _, t := range accessed {
+		if day := utcDay(t); !slices.Contains(days, day) {
+			days = append(days, day)
+		}
+	}
+
+	query := `INSERT INTO rollup_dirty_days (day)
+	          SELECT day
+	            FROM UNNEST($1::DATE[]) AS days(day)
+	           WHERE day < (SELECT rolled_until FROM rollup_state)
+	          ON CONFLICT (day) DO NOTHING`
+
+	if _, err = tx.Exec(ctx, query, days); err != nil {
+		return fmt.Errorf("ошибка отметки пересчитываемых дней сводок: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка завершения транзакции: %w", err)
+	}
+
+	return nil
+}
+
+// RollupNextDay пересчитывает сводку свёрнутого дня, в который поздно записались переходы, а если таких нет -
+// сворачивает в сводки первый день с переходами после уже свёрнутых, если он закончился раньше closedBefore;
+// возвращает обработанный день и false, если сворачивать нечего
+// (или дни прямо сейчас сворачивает другой экземпляр сервиса); день, сводку которого построить не удалось,
+// откладывается, а ошибка оборачивает ErrRollupDaySkipped
+func (d *DataBase) RollupNextDay(ctx context.Context, closedBefore time.Time) (time.Time, bool, error) {
+
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("ошибка открытия транзакции в RollupNextDay: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var locked bool
+	if err = tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, rollupLockID).Scan(&locked); err != nil {
+		return time.Time{}, false, fmt.Errorf("ошибка блокировки сводок в RollupNextDay: %w", err)
+	}
+	if !locked {
+		return time.Time{}, false, nil
+	}
+
+	// ждём завершения начатых записей переходов; новые дождутся конца сворачивания
+	if _, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, clicksLockID); err != nil {
+		return time.Time{}, false, fmt.Errorf("ошибка блокировки записи переходов в RollupNextDay: %w", err)
+	}
+
+	var dirty *time.Time
+	query := `SELECT MIN(day) FROM rollup_dirty_days WHERE failures < $1`
+	if err = tx.QueryRow(ctx, query, rollupMaxFailures).Scan(&dirty); err != nil {
+		return time.Time{}, false, fmt.Errorf("ошибка поиска пересчитываемого дня в RollupNextDay: %w", err)
+	}
+
+	var day time.Time
+	if dirty != nil {
+		day = utcDay(*dirty)
+	} else {
+		// дни без переходов пропускаются: следующий день берётся по первому несвёрнутому переходу
+		query = `SELECT (MIN(accessed_at) AT TIME ZONE 'UTC')::DATE
+		           FROM analytics
+		          WHERE accessed_at >= COALESCE((SELECT rolled_until FROM rollup_state)::TIMESTAMP AT TIME ZONE 'UTC',
+		                                        '-infinity')`
+
+		var next *time.Time
+		if err = tx.QueryRow(ctx, query).Scan(&next); err != nil {
+			return time.Time{}, false, fmt.Errorf("ошибка поиска несвёрнутого дня в RollupNextDay: %w", err)
+		}
+		if next == nil {
+			return time.Time{}, false, nil
+		}
+
+		day = utcDay(*next)
+		if day.AddDate(0, 0, 1).After(closedBefore) {
+			return time.Time{}, false, nil
+		}
+	}
+
+	// день, сводку которого построить не удалось, не задерживает следующие дни: он откладывается
+	// в rollup_dirty_days и пересчитывается позже (не более rollupMaxFailures раз)
+	rollupErr := rollupDay(ctx, tx, day)
+	if rollupErr != nil && ctx.Err() != nil {
+		return time.Time{}, false, fmt.Errorf("ошибка сворачивания дня в RollupNextDay: %w", rollupErr)
+	}
+
+	var steps []string
+	switch {
+	case rollupErr != nil:
+		steps = append(steps, `INSERT INTO rollup_dirty_days (day, failures)
+		                       VALUES ($1::DATE, 1)
+		                       ON CONFLICT (day) DO UPDATE SET failures = rollup_dirty_days.failures + 1`)
+	case dirty != nil:
+		steps = append(steps, `DELETE FROM rollup_dirty_days WHERE day = $1::DATE`)
+	}
+	if dirty == nil {
+		steps = append(steps, `INSERT INTO rollup_state (rolled_until)
+		                       VALUES ($1::DATE + 1)
+		                       ON CONFLICT (id) DO UPDATE SET rolled_until = EXCLUDED.rolled_until`)
+	}
+
+	for _, step := range steps {
+		if _, err = tx.Exec(ctx, step, day); err != nil {
+			return time.Time{}, false, fmt.Errorf("ошибка сохранения состояния сводок в RollupNextDay: %w", err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return time.Time{}, false, fmt.Errorf("ошибка завершения транзакции в RollupNextDay: %w", err)
+	}
+
+	if rollupErr != nil {
+		return day, true, fmt.Errorf("%w (%s): %w", ErrRollupDaySkipped, day.Format(time.DateOnly), rollupErr)
+	}
+
+	return day, true, nil
+}
+
+// rollupDay пересчитывает сводки дня day в точке сохранения транзакции tx
+// (при ошибке изменения дня откатываются, а транзакция остаётся рабочей)
+func rollupDay(ctx context.Context, tx pgx.Tx, day time.Time) error {
+
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка создания точки сохранения: %w", err)
+	}
+	defer func() { _ = sp.Rollback(ctx) }()
+
+	dayEnd := day.AddDate(0, 0, 1)
+
+	// сводка дня пересчитывается целиком, поэтому повторный запуск не удваивает значения
+	steps := []struct {
+		name  string
+		query string
+		args  []any
+	}{
+		{"очистки сводки дня", `DELETE FROM link_daily_stats WHERE day = $1::DATE`, []any{day}},
+		{"очистки измерений дня", `DELETE FROM link_daily_dimensions WHERE day = $1::DATE`, []any{day}},
+		{"сворачивания переходов", `INSERT INTO link_daily_stats (link_id, day, is_bot, clicks, visitors)
+		                            SELECT link_id, $1::DATE, is_bot, COUNT(*),
+		                                   COUNT(DISTINCT (ip_address, user_agent)) FILTER (WHERE NOT is_bot)
+		                              FROM analytics
+		                             WHERE accessed_at >= $2 AND accessed_at < $3
+		                             GROUP BY link_id, is_bot`, []any{day, day, dayEnd}},
+		{"сворачивания измерений", `INSERT INTO link_daily_dimensions (link_id, day, is_bot, dimension, value, clicks)
+		                            SELECT link_id, $1::DATE, is_bot, dims.dimension, dims.value, COUNT(*)
+		                              FROM analytics
+		                             CROSS JOIN LATERAL (VALUES ` + dimensionValues() + `) AS dims(dimension, value)
+		                             WHERE accessed_at >= $2 AND accessed_at < $3
+		                             GROUP BY link_id, is_bot, dims.dimension, dims.value`, []any{day, day, dayEnd}},
+	}
+
+	for _, step := range steps {
+		if _, err = sp.Exec(ctx, step.query, step.args...); err != nil {
+			return fmt.Errorf("ошибка %s: %w", step.name, err)
+		}
+	}
+
+	if err = sp.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка освобождения точки сохранения: %w", err)
+	}
+
+	return nil
+}
+
+// dimensionValues - строки VALUES (измерение, выражение) по всем измерениям для сворачивания одним проходом
+func dimensionValues() string {
+
+	dimensions := make([]string, 0, len(dimensionExpressions))
+	for dimension := range dimensionExpressions {
+		dimensions = append(dimensions, dimension)
+	}
+	slices.Sort(dimensions)
+
+	values := make([]string, len(dimensions))
+	for i, dimension := range dimensions {
+		values[i] = fmt.Sprintf("('%s', %s)", dimension, dimensionExpressions[dimension])
+	}
+
+	return strings.Join(values, ", ")
+}
+
+// CountRolledVisitors - число уникальных посетителей (людей) ссылки по свёрнутым дням из [from, to]
+// (точный подсчёт по IP и User-Agent, сделанный при сворачивании)
+func (d *DataBase) CountRolledVisitors(ctx context.Context, linkID int, from, to time.Time) (map[string]int, error) {
+
+	query := `SELECT TO_CHAR(day, 'YYYY-MM-DD'),
+	                 visitors
+	            FROM link_daily_stats
+	           WHERE link_id = $1
+	             AND NOT is_bot
+	             AND day BETWEEN $2::DATE AND $3::DATE`
+
+	rows, err := d.Pool.Query(ctx, query, linkID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса в CountRolledVisitors: %w", err)
+	}
+	defer rows.Close()
+
+	byDay := make(map[string]int)
+	var key string
+	var val int
+	for rows.Next() {
+		if err := rows.Scan(&key, &val); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании строки запроса в CountRolledVisitors: %w", err)
+		}
+		byDay[key] = val
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по списку записей в CountRolledVisitors: %w", err)
+	}
+
+	return byDay, nil
+}
@@ -0,0 +1,476 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// analyticsColumns - перечень полей таблицы analytics в порядке сканирования в scanAnalytics
+const analyticsColumns = `id, link_id, accessed_at, COALESCE(user_agent, ''), ip_address, COALESCE(referer, ''), is_bot, is_repeat,
+	COALESCE(browser, ''), COALESCE(browser_version, ''), COALESCE(os, ''), COALESCE(os_version, ''), COALESCE(device, ''),
+	COALESCE(country, ''), COALESCE(region, ''), COALESCE(city, ''), COALESCE(asn, 0), COALESCE(as_org, '')`
+
+// scanAnalytics считывает строку выборки из analytics (и дополнительные колонки extra) в структуру Analytics
+func scanAnalytics(row scanner, a *db.Analytics, extra ...any) error {
+
+	var accessedAt int64
+	var ip sql.NullString
+
+	dest := []any{
+		&a.ID,
+		&a.LinkID,
+		&accessedAt,
+		&a.UserAgent,
+		&ip,
+		&a.Referer,
+		&a.IsBot,
+		&a.IsRepeat,
+		&a.Browser,
+		&a.BrowserVersion,
+		&a.OS,
+		&a.OSVersion,
+		&a.Device,
+		&a.Country,
+		&a.Region,
+		&a.City,
+		&a.ASN,
+		&a.ASOrg,
+	}
+
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+
+	a.AccessedAt = fromMicro(accessedAt)
+	if ip.Valid {
+		a.IPAddress = net.ParseIP(ip.String)
+	}
+
+	return nil
+}
+
+// ipText - IP-адрес в текстовом виде (nil - NULL)
+func ipText(ip net.IP) *string {
+
+	if ip == nil {
+		return nil
+	}
+
+	return nullString(ip.String())
+}
+
+// SaveAnalytics записывает каждый переход
+func (d *DataBase) SaveAnalytics(ctx context.Context, linkID int, accessedAt time.Time, userAgent, ipAddress, referer string, isBot bool) error {
+
+	query := `INSERT INTO analytics (link_id, accessed_at, user_agent, ip_address, referer, is_bot)
+	          VALUES (?, ?, ?, ?, ?, ?)`
+
+	ip := net.ParseIP(ipAddress) // если пусто, вернёт nil
+	_, err := d.conn.ExecContext(ctx, query, linkID, toMicro(accessedAt), userAgent, ipText(ip), referer, isBot)
+	if err != nil {
+		return fmt.Errorf("ошибка добавления записи о переходе в SaveAnalytics: %w", err)
+	}
+
+	return nil
+}
+
+// SaveAnalyticsBatch записывает пачку переходов в одной транзакции
+func (d *DataBase) SaveAnalyticsBatch(ctx context.Context, records []*db.Analytics) error {
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO analytics (link_id, accessed_at, user_agent, ip_address, referer, is_bot, is_repeat,
+	                                 browser, browser_version, os, os_version, device,
+	                                 country, region, city, asn, as_org)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = stmt.Close() }()
+
+		for _, a := range records {
+			_, err := stmt.ExecContext(ctx, a.LinkID, toMicro(a.AccessedAt), a.UserAgent, ipText(a.IPAddress), a.Referer,
+				a.IsBot, a.IsRepeat, a.Browser, a.BrowserVersion, a.OS, a.OSVersion, a.Device,
+				nullString(a.Country), nullString(a.Region), nullString(a.City), nullInt(a.ASN), nullString(a.ASOrg))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка добавления пачки записей о переходах в SaveAnalyticsBatch: %w", err)
+	}
+
+	return nil
+}
+
+// clickFilter - условия фильтров журнала переходов с именованными параметрами из filterArgs
+const clickFilter = `(:from IS NULL OR accessed_at >= :from)
+	             AND (:to IS NULL OR accessed_at < :to)
+	             AND (:referer = '' OR icontains(referer, :referer))
+	             AND (:device = '' OR device = :device)
+	             AND (:is_bot IS NULL OR is_bot = :is_bot)`
+
+// filterArgs возвращает параметры условий clickFilter и дополнительные параметры args
+func filterArgs(filter db.ClickFilter, args ...any) []any {
+
+	return append(args,
+		sql.Named("from", nullMicro(filter.From)),
+		sql.Named("to", nullMicro(filter.To)),
+		sql.Named("referer", filter.Referer),
+		sql.Named("device", filter.Device),
+		sql.Named("is_bot", filter.IsBot),
+	)
+}
+
+// GetClicks возвращает страницу журнала переходов по ссылке (от новых к старым):
+// не более limit записей с id меньше afterID (0 - с самой новой), подходящих под filter
+func (d *DataBase) GetClicks(ctx context.Context, linkID int, filter db.ClickFilter, afterID int64, limit int) ([]*db.Analytics, error) {
+
+	query := `SELECT ` + analyticsColumns + `
+	            FROM analytics
+	           WHERE link_id = :link_id
+	             AND (:after_id = 0 OR id < :after_id)
+	             AND ` + clickFilter + `
+	           ORDER BY id DESC
+	           LIMIT :limit`
+
+	rows, err := d.conn.QueryContext(ctx, query, filterArgs(filter,
+		sql.Named("link_id", linkID), sql.Named("after_id", afterID), sql.Named("limit", limit))...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении журнала переходов в GetClicks: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var analytics []*db.Analytics
+	for rows.Next() {
+		var a db.Analytics
+		err := scanAnalytics(rows, &a)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании строки журнала переходов в GetClicks: %w", err)
+		}
+
+		analytics = append(analytics, &a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по журналу переходов в GetClicks: %w", err)
+	}
+
+	return analytics, nil
+}
+
+// exportFetchSize - сколько строк выгрузки читается за один запрос
+const exportFetchSize = 1000
+
+// streamedClick - переход выгрузки вместе с короткой ссылкой
+type streamedClick struct {
+	shortURL string
+	click    db.Analytics
+}
+
+// StreamClicks передаёт в fn все переходы по ссылке linkID (или по всем ссылкам владельца ownerID,
+// nil в обоих - по всем ссылкам) от старых к новым; строки читаются порциями по id, и fn вызывается
+// между запросами, поэтому выгрузка не держит единственное соединение с базой
+func (d *DataBase) StreamClicks(ctx context.Context, linkID, ownerID *int, filter db.ClickFilter,
+	fn func(shortURL string, a *db.Analytics) error) error {
+
+	// переходы, записанные во время выгрузки, в неё не попадают (как в курсоре PostgreSQL)
+	var lastID int64
+	if err := d.conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM analytics`).Scan(&lastID); err != nil {
+		return fmt.Errorf("ошибка чтения последнего перехода в StreamClicks: %w", err)
+	}
+
+	query := `SELECT ` + analyticsColumns + `,
+	                 (SELECT short_url FROM links WHERE links.id = analytics.link_id)
+	            FROM analytics
+	           WHERE id > :after_id
+	             AND id <= :last_id
+	             AND (:link_id IS NULL OR link_id = :link_id)
+	             AND (:owner_id IS NULL OR link_id IN (SELECT id FROM links WHERE owner_id = :owner_id))
+	             AND ` + clickFilter + `
+	           ORDER BY id
+	           LIMIT :limit`
+
+	var afterID int64
+	for {
+		chunk, err := d.fetchClicks(ctx, query, filterArgs(filter,
+			sql.Named("after_id", afterID), sql.Named("last_id", lastID),
+			sql.Named("link_id", linkID), sql.Named("owner_id", ownerID),
+			sql.Named("limit", exportFetchSize))...)
+		if err != nil {
+			return err
+		}
+
+		for i := range chunk {
+			if err := fn(chunk[i].shortURL, &chunk[i].click); err != nil {
+				return err
+			}
+		}
+
+		if len(chunk) < exportFetchSize {
+			break
+		}
+		afterID = chunk[len(chunk)-1].click.ID
+	}
+
+	return nil
+}
+
+// fetchClicks читает одну порцию выгрузки StreamClicks
+func (d *DataBase) fetchClicks(ctx context.Context, query string, args ...any) ([]streamedClick, error) {
+
+	rows, err := d.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения выгрузки в StreamClicks: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	chunk := make([]streamedClick, 0, exportFetchSize)
+	for rows.Next() {
+		var c streamedClick
+		var shortURL sql.NullString
+		if err := scanAnalytics(rows, &c.click, &shortURL); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании строки выгрузки в StreamClicks: %w", err)
+		}
+		c.shortURL = shortURL.String
+
+		chunk = append(chunk, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по выгрузке в StreamClicks: %w", err)
+	}
+
+	return chunk, nil
+}
+
+// CountClicks - количество переходов людей или ботов по ссылке
+func (d *DataBase) CountClicks(ctx context.Context, linkID int, isBot bool) (int, error) {
+
+	query := `SELECT COUNT(*)
+	            FROM analytics
+	           WHERE link_id = ?
+	             AND is_bot = ?`
+
+	var count int
+	err := d.conn.QueryRowContext(ctx, query, linkID, isBot).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при подсчёте переходов в CountClicks: %w", err)
+	}
+
+	return count, nil
+}
+
+// агрегация
+
+// clicksInPeriod - условие выборки переходов людей или ботов по ссылке за [from, to)
+// с параметрами ?1 - link_id, ?2 и ?3 - период, ?4 - is_bot
+const clicksInPeriod = `link_id = ?1 AND accessed_at >= ?2 AND accessed_at < ?3 AND is_bot = ?4`
+
+// CountClicksByDay - группировка по дням (UTC)
+func (d *DataBase) CountClicksByDay(ctx context.Context, linkID int, from, to time.Time, isBot bool) (map[string]int, error) {
+
+	query := `SELECT STRFTIME('%Y-%m-%d', accessed_at / 1000000, 'unixepoch') AS key,
+	                 COUNT(*)
+	            FROM analytics
+	           WHERE ` + clicksInPeriod + `
+	           GROUP BY key`
+
+	return d.countGrouped(ctx, "CountClicksByDay", query, linkID, toMicro(from), toMicro(to), isBot)
+}
+
+// CountClicksByMonth - группировка по месяцам (UTC)
+func (d *DataBase) CountClicksByMonth(ctx context.Context, linkID int, from, to time.Time, isBot bool) (map[string]int, error) {
+
+	query := `SELECT STRFTIME('%Y-%m', accessed_at / 1000000, 'unixepoch') AS key,
+	                 COUNT(*)
+	            FROM analytics
+	           WHERE ` + clicksInPeriod + `
+	           GROUP BY key`
+
+	return d.countGrouped(ctx, "CountClicksByMonth", query, linkID, toMicro(from), toMicro(to), isBot)
+}
+
+// CountClicksByPeriod - группировка по шагам временной шкалы в часовом поясе tz: переходы
+// группируются по минутам в SQLite, а минуты раскладываются по шагам в db.Timeline
+// (у часовых поясов сдвиг кратен минуте)
+func (d *DataBase) CountClicksByPeriod(ctx context.Context, linkID int, from, to time.Time, granularity, tz string, isBot bool) ([]db.TimeBucket, error) {
+
+	query := `SELECT accessed_at / 60000000 * 60000000 AS minute,
+	                 COUNT(*)
+	            FROM analytics
+	           WHERE ` + clicksInPeriod + `
+	           GROUP BY minute`
+
+	rows, err := d.conn.QueryContext(ctx, query, linkID, toMicro(from), toMicro(to), isBot)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса в CountClicksByPeriod: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var minutes []db.TimeBucket
+	for rows.Next() {
+		var minute int64
+		var count int
+		if err := rows.Scan(&minute, &count); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании строки запроса в CountClicksByPeriod: %w", err)
+		}
+
+		minutes = append(minutes, db.TimeBucket{Start: fromMicro(minute), Clicks: count})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по списку записей в CountClicksByPeriod: %w", err)
+	}
+
+	buckets, err := db.Timeline(from, to, granularity, tz, minutes)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка в CountClicksByPeriod: %w", err)
+	}
+
+	return buckets, nil
+}
+
+// CountClicksByUserAgent - группировка по User-Agent
+func (d *DataBase) CountClicksByUserAgent(ctx context.Context, linkID int, isBot bool) (map[string]int, error) {
+
+	return d.CountClicksByDimension(ctx, linkID, db.DimensionUserAgent, isBot)
+}
+
+// dimensionColumn - колонки analytics, от которых зависит значение измерения, и поля Analytics для них
+type dimensionColumn struct {
+	columns string
+	dest    func(a *db.Analytics) []any
+}
+
+// dimensionColumns - колонки измерений аналитики: SQLite группирует переходы по колонкам,
+// а значение измерения из них получает db.DimensionValue
+var dimensionColumns = map[string]dimensionColumn{
+	db.DimensionUserAgent: {"COALESCE(user_agent, '')",
+		func(a *db.Analytics) []any { return []any{&a.UserAgent} }},
+	db.DimensionBrowser: {"COALESCE(browser, '')",
+		func(a *db.Analytics) []any { return []any{&a.Browser} }},
+	db.DimensionBrowserVersion: {"COALESCE(browser, ''), COALESCE(browser_version, '')",
+		func(a *db.Analytics) []any { return []any{&a.Browser, &a.BrowserVersion} }},
+	db.DimensionOS: {"COALESCE(os, '')",
+		func(a *db.Analytics) []any { return []any{&a.OS} }},
+	db.DimensionOSVersion: {"COALESCE(os, ''), COALESCE(os_version, '')",
+		func(a *db.Analytics) []any { return []any{&a.OS, &a.OSVersion} }},
+	db.DimensionDevice: {"COALESCE(device, '')",
+		func(a *db.Analytics) []any { return []any{&a.Device} }},
+	db.DimensionCountry: {"COALESCE(country, '')",
+		func(a *db.Analytics) []any { return []any{&a.Country} }},
+	db.DimensionRegion: {"COALESCE(region, ''), COALESCE(country, '')",
+		func(a *db.Analytics) []any { return []any{&a.Region, &a.Country} }},
+	db.DimensionCity: {"COALESCE(city, ''), COALESCE(country, '')",
+		func(a *db.Analytics) []any { return []any{&a.City, &a.Country} }},
+	db.DimensionASN: {"COALESCE(asn, 0), COALESCE(as_org, '')",
+		func(a *db.Analytics) []any { return []any{&a.ASN, &a.ASOrg} }},
+	db.DimensionReferer: {"COALESCE(referer, '')",
+		func(a *db.Analytics) []any { return []any{&a.Referer} }},
+}
+
+// CountClicksByDimension - группировка по одному из измерений (браузер, ОС, устройство и т.д.)
+func (d *DataBase) CountClicksByDimension(ctx context.Context, linkID int, dimension string, isBot bool) (map[string]int, error) {
+
+	column, ok := dimensionColumns[dimension]
+	if !ok {
+		return nil, fmt.Errorf("неизвестное измерение %q в CountClicksByDimension", dimension)
+	}
+
+	query := `SELECT ` + column.columns + `,
+	                 COUNT(*)
+	            FROM analytics
+	           WHERE link_id = ?
+	             AND is_bot = ?
+	           GROUP BY ` + column.columns
+
+	rows, err := d.conn.QueryContext(ctx, query, linkID, isBot)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса в CountClicksByDimension: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	countClick := make(map[string]int)
+	for rows.Next() {
+		var a db.Analytics
+		var count int
+		if err := rows.Scan(append(column.dest(&a), &count)...); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании строки запроса в CountClicksByDimension: %w", err)
+		}
+
+		// разные колонки могут дать одно значение (например, домен из разных Referer)
+		value, err := db.DimensionValue(&a, dimension)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка в CountClicksByDimension: %w", err)
+		}
+		countClick[value] += count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по списку записей в CountClicksByDimension: %w", err)
+	}
+
+	return countClick, nil
+}
+
+// countGrouped выполняет запрос группировки, возвращающий колонки key и count
+func (d *DataBase) countGrouped(ctx context.Context, caller, query string, args ...any) (map[string]int, error) {
+
+	rows, err := d.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса в %s: %w", caller, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	countClick := make(map[string]int)
+	var key string
+	var val int
+	for rows.Next() {
+		err := rows.Scan(
+			&key,
+			&val,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании строки запроса в %s: %w", caller, err)
+		}
+
+		countClick[key] = val
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по списку записей в %s: %w", caller, err)
+	}
+
+	return countClick, nil
+}
+
+// CountClicksByCountry - группировка по странам (ISO-код)
+func (d *DataBase) CountClicksByCountry(ctx context.Context, linkID int, isBot bool) (map[string]int, error) {
+
+	return d.CountClicksByDimension(ctx, linkID, db.DimensionCountry, isBot)
+}
+
+// CountClicksByCity - группировка по городам (город и ISO-код страны, т.к. названия городов повторяются)
+func (d *DataBase) CountClicksByCity(ctx context.Context, linkID int, isBot bool) (map[string]int, error) {
+
+	return d.CountClicksByDimension(ctx, linkID, db.DimensionCity, isBot)
+}
+
+// CountRolledVisitors - у SQLite нет дневных сводок, все агрегаты считаются по переходам
+func (d *DataBase) CountRolledVisitors(ctx context.Context, linkID int, from, to time.Time) (map[string]int, error) {
+
+	return map[string]int{}, nil
+}
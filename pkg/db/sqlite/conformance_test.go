@@ -0,0 +1,33 @@
+package sqlite_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/IPampurin/UrlShortener/pkg/configuration"
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/IPampurin/UrlShortener/pkg/db/conformance"
+	"github.com/IPampurin/UrlShortener/pkg/db/sqlite"
+)
+
+func TestConformance(t *testing.T) {
+
+	log := conformance.Logger(t)
+	dir := t.TempDir()
+	files := 0
+
+	// каждая проверка получает свой файл базы
+	conformance.Run(t, func() db.Storage {
+		files++
+		cfgDb := &configuration.ConfDB{SQLitePath: filepath.Join(dir, fmt.Sprintf("conformance-%d.db", files))}
+
+		storage, err := sqlite.InitSQLite(t.Context(), cfgDb, log)
+		if err != nil {
+			t.Errorf("ошибка открытия базы SQLite: %v", err)
+			return nil
+		}
+
+		return storage
+	})
+}
@@ -0,0 +1,348 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// linkColumns - перечень полей таблицы links в порядке сканирования в scanLink
+const linkColumns = `id, short_url, original_url, created_at, is_custom, clicks_count, expires_at, max_clicks, deleted_at, owner_id, redirect_type, pass_query, dedup_clicks_count`
+
+// scanLink считывает строку выборки из links в структуру Link
+func scanLink(row scanner, link *db.Link) error {
+
+	var createdAt int64
+	var expiresAt, maxClicks, deletedAt, ownerID sql.NullInt64
+
+	err := row.Scan(
+		&link.ID,
+		&link.ShortURL,
+		&link.OriginalURL,
+		&createdAt,
+		&link.IsCustom,
+		&link.ClicksCount,
+		&expiresAt,
+		&maxClicks,
+		&deletedAt,
+		&ownerID,
+		&link.RedirectType,
+		&link.PassQuery,
+		&link.DedupClicksCount,
+	)
+	if err != nil {
+		return err
+	}
+
+	link.CreatedAt = fromMicro(createdAt)
+	link.ExpiresAt = timeOrNil(expiresAt)
+	link.MaxClicks = intOrNil(maxClicks)
+	link.DeletedAt = timeOrNil(deletedAt)
+	link.OwnerID = intOrNil(ownerID)
+
+	return nil
+}
+
+// queryLink выполняет запрос, возвращающий одну ссылку (nil, nil - строк нет)
+func (d *DataBase) queryLink(ctx context.Context, caller, action, query string, args ...any) (*db.Link, error) {
+
+	link := &db.Link{}
+
+	err := scanLink(d.conn.QueryRowContext(ctx, query, args...), link)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка %s записи о ссылке в %s: %w", action, caller, err)
+	}
+
+	return link, nil
+}
+
+// queryLinks выполняет запрос, возвращающий список ссылок
+func (d *DataBase) queryLinks(ctx context.Context, caller, query string, args ...any) ([]*db.Link, error) {
+
+	rows, err := d.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении списка ссылок в %s: %w", caller, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	links := make([]*db.Link, 0)
+	for rows.Next() {
+		var link db.Link
+		err := scanLink(rows, &link)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании строки списка ссылок в %s: %w", caller, err)
+		}
+
+		links = append(links, &link)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по списку ссылок в %s: %w", caller, err)
+	}
+
+	return links, nil
+}
+
+// CreateLink добавляет новую запись в таблицу links
+func (d *DataBase) CreateLink(ctx context.Context, originalURL, shortURL string, isCustom bool, opts db.LinkOptions) (*db.Link, error) {
+
+	link := &db.Link{
+		ID:           opts.ID,
+		ShortURL:     shortURL,
+		OriginalURL:  originalURL,
+		CreatedAt:    fromMicro(toMicro(time.Now())),
+		IsCustom:     isCustom,
+		ClicksCount:  0,
+		ExpiresAt:    opts.ExpiresAt,
+		MaxClicks:    opts.MaxClicks,
+		OwnerID:      opts.OwnerID,
+		RedirectType: opts.RedirectType,
+		PassQuery:    opts.PassQuery,
+	}
+	if link.RedirectType == "" {
+		link.RedirectType = db.RedirectFound
+	}
+
+	// идентификаторы, назначенные хранилищем и зарезервированные через NextLinkID, берутся из одной последовательности
+	if link.ID == 0 {
+		id, err := d.NextLinkID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		link.ID = id
+	}
+
+	query := `INSERT INTO links (id, short_url, original_url, created_at, is_custom, clicks_count, expires_at, max_clicks,
+	                             owner_id, redirect_type, pass_query)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := d.conn.ExecContext(ctx, query, link.ID, shortURL, originalURL, toMicro(link.CreatedAt), isCustom, 0,
+		nullMicro(opts.ExpiresAt), opts.MaxClicks, opts.OwnerID, link.RedirectType, link.PassQuery)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, db.ErrShortURLExists
+		}
+		return nil, fmt.Errorf("ошибка добавления записи о ссылке в CreateLink: %w", err)
+	}
+
+	return link, nil
+}
+
+// NextLinkID резервирует очередное значение последовательности идентификаторов ссылок
+func (d *DataBase) NextLinkID(ctx context.Context) (int, error) {
+
+	query := `UPDATE sequences SET value = value + 1 WHERE name = 'links' RETURNING value`
+
+	var id int
+	err := d.conn.QueryRowContext(ctx, query).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка резервирования идентификатора ссылки в NextLinkID: %w", err)
+	}
+
+	return id, nil
+}
+
+// GetLinkByShortURL получает из таблицы links запись по короткой ссылке
+func (d *DataBase) GetLinkByShortURL(ctx context.Context, shortURL string) (*db.Link, error) {
+
+	query := `SELECT ` + linkColumns + `
+	            FROM links
+	           WHERE short_url = ?`
+
+	return d.queryLink(ctx, "GetLinkByShortURL", "получения", query, shortURL)
+}
+
+// GetLinkByOriginalURL получает из таблицы links активные записи по длинной ссылке
+// (ownerID ограничивает выборку ссылками владельца, nil - без ограничения)
+func (d *DataBase) GetLinkByOriginalURL(ctx context.Context, originalURL string, ownerID *int) ([]*db.Link, error) {
+
+	query := `SELECT ` + linkColumns + `
+	            FROM links
+	           WHERE original_url = ?1
+	             AND deleted_at IS NULL
+	             AND (?2 IS NULL OR owner_id = ?2)`
+
+	return d.queryLinks(ctx, "GetLinkByOriginalURL", query, originalURL, ownerID)
+}
+
+// IncrementClicks увеличивает счётчик переходов по ссылке
+func (d *DataBase) IncrementClicks(ctx context.Context, linkID int64) error {
+
+	// одиночный переход без сведений о повторах учитывается в обоих счётчиках
+	query := `UPDATE links
+	             SET clicks_count = clicks_count + 1,
+	                 dedup_clicks_count = dedup_clicks_count + 1
+	           WHERE id = ?`
+
+	_, err := d.conn.ExecContext(ctx, query, linkID)
+	if err != nil {
+		return fmt.Errorf("ошибка увеличения счётчика переходов в IncrementClicks: %w", err)
+	}
+
+	return nil
+}
+
+// AddClicks увеличивает счётчики переходов сразу по нескольким ссылкам в одной транзакции
+func (d *DataBase) AddClicks(ctx context.Context, counts map[int]db.ClickDelta) error {
+
+	if len(counts) == 0 {
+		return nil
+	}
+
+	query := `UPDATE links
+	             SET clicks_count = clicks_count + ?2,
+	                 dedup_clicks_count = dedup_clicks_count + ?3
+	           WHERE id = ?1`
+
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		for id, delta := range counts {
+			if _, err := tx.ExecContext(ctx, query, id, delta.Raw, delta.Dedup); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка увеличения счётчиков переходов в AddClicks: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateLink изменяет поля активной ссылки, переданные в upd
+func (d *DataBase) UpdateLink(ctx context.Context, shortURL string, upd db.LinkUpdate) (*db.Link, error) {
+
+	query := `UPDATE links
+	             SET original_url = COALESCE(?2, original_url),
+	                 expires_at = CASE WHEN ?3 THEN NULL ELSE COALESCE(?4, expires_at) END,
+	                 max_clicks = CASE WHEN ?5 THEN NULL ELSE COALESCE(?6, max_clicks) END,
+	                 redirect_type = COALESCE(?7, redirect_type),
+	                 pass_query = COALESCE(?8, pass_query)
+	           WHERE short_url = ?1
+	             AND deleted_at IS NULL
+	       RETURNING ` + linkColumns
+
+	return d.queryLink(ctx, "UpdateLink", "изменения", query, shortURL,
+		upd.OriginalURL,
+		upd.ResetExpiresAt, nullMicro(upd.ExpiresAt),
+		upd.ResetMaxClicks, upd.MaxClicks,
+		upd.RedirectType, upd.PassQuery)
+}
+
+// DeleteLink помечает ссылку удалённой (мягкое удаление, запись остаётся в корзине)
+func (d *DataBase) DeleteLink(ctx context.Context, shortURL string) (*db.Link, error) {
+
+	query := `UPDATE links
+	             SET deleted_at = ?2
+	           WHERE short_url = ?1
+	             AND deleted_at IS NULL
+	       RETURNING ` + linkColumns
+
+	return d.queryLink(ctx, "DeleteLink", "удаления", query, shortURL, toMicro(time.Now()))
+}
+
+// RestoreLink снимает с ссылки пометку об удалении
+func (d *DataBase) RestoreLink(ctx context.Context, shortURL string) (*db.Link, error) {
+
+	query := `UPDATE links
+	             SET deleted_at = NULL
+	           WHERE short_url = ?
+	             AND deleted_at IS NOT NULL
+	       RETURNING ` + linkColumns
+
+	return d.queryLink(ctx, "RestoreLink", "восстановления", query, shortURL)
+}
+
+// GetDeletedLinks получает ссылки из корзины, начиная с удалённых последними
+func (d *DataBase) GetDeletedLinks(ctx context.Context, ownerID *int) ([]*db.Link, error) {
+
+	query := `SELECT ` + linkColumns + `
+	            FROM links
+	           WHERE deleted_at IS NOT NULL
+	             AND (?1 IS NULL OR owner_id = ?1)
+	           ORDER BY deleted_at DESC`
+
+	return d.queryLinks(ctx, "GetDeletedLinks", query, ownerID)
+}
+
+// GetLinks получает крайние по времени 20 записей по сокращению ссылок
+func (d *DataBase) GetLinks(ctx context.Context, ownerID *int) ([]*db.Link, error) {
+
+	const limitGetLinks = 20
+
+	query := `SELECT ` + linkColumns + `
+	            FROM links
+	           WHERE deleted_at IS NULL
+	             AND (?2 IS NULL OR owner_id = ?2)
+	           ORDER BY created_at DESC
+	           LIMIT ?1`
+
+	return d.queryLinks(ctx, "GetLinks", query, limitGetLinks, ownerID)
+}
+
+// GetPopularLinks возвращает не более limit активных ссылок с наибольшим числом переходов за крайний period времени
+func (d *DataBase) GetPopularLinks(ctx context.Context, period time.Duration, limit int) ([]*db.Link, error) {
+
+	threshold := time.Now().Add(-period)
+
+	query := `SELECT ` + linkColumns + `
+	            FROM (SELECT link_id, COUNT(*) AS clicks
+	                    FROM analytics
+	                   WHERE accessed_at >= ?
+	                   GROUP BY link_id) AS popular
+	            JOIN links ON links.id = popular.link_id
+	           WHERE deleted_at IS NULL
+	           ORDER BY popular.clicks DESC, links.id DESC
+	           LIMIT ?`
+
+	return d.queryLinks(ctx, "GetPopularLinks", query, toMicro(threshold), limit)
+}
+
+// SearchByOriginalURL ищет ссылки, OriginalURL которых содержит подстроку search (регистронезависимо)
+func (d *DataBase) SearchByOriginalURL(ctx context.Context, search string, ownerID *int) ([]*db.Link, error) {
+
+	query := `SELECT ` + linkColumns + `
+	            FROM links
+	           WHERE icontains(original_url, ?1)
+	             AND deleted_at IS NULL
+	             AND (?2 IS NULL OR owner_id = ?2)
+	           ORDER BY created_at DESC`
+
+	return d.queryLinks(ctx, "SearchByOriginalURL", query, search, ownerID)
+}
+
+// SearchByShortURL ищет ссылки, ShortURL которых содержит подстроку search (регистронезависимо)
+func (d *DataBase) SearchByShortURL(ctx context.Context, search string, ownerID *int) ([]*db.Link, error) {
+
+	query := `SELECT ` + linkColumns + `
+	            FROM links
+	           WHERE icontains(short_url, ?1)
+	             AND deleted_at IS NULL
+	             AND (?2 IS NULL OR owner_id = ?2)
+	           ORDER BY created_at DESC`
+
+	return d.queryLinks(ctx, "SearchByShortURL", query, search, ownerID)
+}
+
+// inTx выполняет fn в транзакции (изменения сохраняются, только если fn не вернула ошибку)
+func (d *DataBase) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,228 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/configuration"
+	"github.com/wb-go/wbf/logger"
+	sqlitedriver "modernc.org/sqlite" // драйвер database/sql "sqlite" без cgo
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// DataBase хранит подключение к встроенной базе SQLite
+type DataBase struct {
+	conn *sql.DB
+	log  logger.Logger
+}
+
+// schema - таблицы те же, что в миграциях PostgreSQL, без сводок и секций; все моменты времени
+// хранятся в микросекундах Unix (INTEGER), дни посетителей - строками YYYY-MM-DD
+const schema = `CREATE TABLE IF NOT EXISTS users (
+	                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+	                     name TEXT UNIQUE NOT NULL,
+	                 is_admin INTEGER NOT NULL DEFAULT 0,
+	               created_at INTEGER NOT NULL);
+
+	CREATE TABLE IF NOT EXISTS api_keys (
+	                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+	                  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	                 key_hash TEXT UNIQUE NOT NULL,
+	               created_at INTEGER NOT NULL,
+	               revoked_at INTEGER);
+
+	CREATE TABLE IF NOT EXISTS sequences (
+	                     name TEXT PRIMARY KEY,
+	                    value INTEGER NOT NULL);
+
+	INSERT OR IGNORE INTO sequences (name, value) VALUES ('links', 0);
+
+	CREATE TABLE IF NOT EXISTS links (
+	                       id INTEGER PRIMARY KEY,
+	                short_url TEXT UNIQUE NOT NULL,
+	             original_url TEXT NOT NULL,
+	               created_at INTEGER NOT NULL,
+	                is_custom INTEGER NOT NULL DEFAULT 0,
+	             clicks_count INTEGER NOT NULL DEFAULT 0,
+	               expires_at INTEGER,
+	               max_clicks INTEGER,
+	               deleted_at INTEGER,
+	                 owner_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	            redirect_type TEXT NOT NULL DEFAULT '302',
+	               pass_query INTEGER NOT NULL DEFAULT 0,
+	       dedup_clicks_count INTEGER NOT NULL DEFAULT 0);
+
+	CREATE INDEX IF NOT EXISTS idx_links_created_at ON links(created_at);
+	CREATE INDEX IF NOT EXISTS idx_links_owner_id ON links(owner_id);
+	CREATE INDEX IF NOT EXISTS idx_links_original_url ON links(original_url);
+
+	CREATE TABLE IF NOT EXISTS analytics (
+	                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+	                  link_id INTEGER NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+	              accessed_at INTEGER NOT NULL,
+	               user_agent TEXT,
+	               ip_address TEXT,
+	                  referer TEXT,
+	                   is_bot INTEGER NOT NULL DEFAULT 0,
+	                is_repeat INTEGER NOT NULL DEFAULT 0,
+	                  browser TEXT,
+	          browser_version TEXT,
+	                       os TEXT,
+	               os_version TEXT,
+	                   device TEXT,
+	                  country TEXT,
+	                   region TEXT,
+	                     city TEXT,
+	                      asn INTEGER,
+	                   as_org TEXT);
+
+	CREATE INDEX IF NOT EXISTS idx_analytics_link_id_accessed_at ON analytics(link_id, accessed_at);
+	CREATE INDEX IF NOT EXISTS idx_analytics_link_id_id ON analytics(link_id, id);
+	CREATE INDEX IF NOT EXISTS idx_analytics_accessed_at ON analytics(accessed_at);
+
+	CREATE TABLE IF NOT EXISTS link_visitors (
+	                  link_id INTEGER NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+	                      day TEXT NOT NULL,
+	                  visitor INTEGER NOT NULL,
+	              PRIMARY KEY (link_id, day, visitor));
+
+	CREATE TABLE IF NOT EXISTS service_settings (
+	                     name TEXT PRIMARY KEY,
+	                    value TEXT NOT NULL);`
+
+// InitSQLite открывает (или создаёт) файл базы SQLite из DB_SQLITE_PATH и создаёт недостающие таблицы
+func InitSQLite(ctx context.Context, cfgDb *configuration.ConfDB, log logger.Logger) (*DataBase, error) {
+
+	// WAL позволяет читать во время записи, busy_timeout - подождать, пока файл занят другим процессом
+	dsn := "file:" + cfgDb.SQLitePath + "?" + url.Values{
+		"_pragma": {"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)"},
+	}.Encode()
+
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия базы SQLite: %w", err)
+	}
+
+	// SQLite допускает одного пишущего: одно соединение избавляет от ошибок SQLITE_BUSY
+	// между воркерами конвейера (и сохраняет базу :memory: между запросами)
+	conn.SetMaxOpenConns(1)
+
+	if err = conn.PingContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("ошибка соединения с базой SQLite: %w", err)
+	}
+
+	if _, err = conn.ExecContext(ctx, schema); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("ошибка создания таблиц SQLite: %w", err)
+	}
+
+	log.Info("База данных SQLite успешно запущена.", "path", cfgDb.SQLitePath)
+
+	return &DataBase{conn: conn, log: log}, nil
+}
+
+// Close закрывает соединение с базой
+func (d *DataBase) Close() {
+
+	if err := d.conn.Close(); err != nil {
+		d.log.Warn("ошибка закрытия базы SQLite", "error", err)
+	}
+}
+
+// scanner - строка выборки (*sql.Row или *sql.Rows)
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// toMicro переводит момент времени в микросекунды Unix (точность, как у TIMESTAMPTZ в PostgreSQL)
+func toMicro(t time.Time) int64 {
+
+	return t.UnixMicro()
+}
+
+// nullMicro переводит необязательный момент времени в микросекунды Unix (nil - NULL)
+func nullMicro(t *time.Time) *int64 {
+
+	if t == nil {
+		return nil
+	}
+
+	micro := toMicro(*t)
+	return &micro
+}
+
+// fromMicro переводит микросекунды Unix обратно в момент времени
+func fromMicro(micro int64) time.Time {
+
+	return time.UnixMicro(micro)
+}
+
+// timeOrNil возвращает момент времени из необязательной колонки (NULL - nil)
+func timeOrNil(micro sql.NullInt64) *time.Time {
+
+	if !micro.Valid {
+		return nil
+	}
+
+	t := fromMicro(micro.Int64)
+	return &t
+}
+
+// intOrNil возвращает число из необязательной колонки (NULL - nil)
+func intOrNil(n sql.NullInt64) *int {
+
+	if !n.Valid {
+		return nil
+	}
+
+	v := int(n.Int64)
+	return &v
+}
+
+// nullString превращает пустую строку в NULL (неизвестное значение)
+func nullString(s string) *string {
+
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
+
+// nullInt превращает ноль в NULL (неизвестное значение)
+func nullInt(n int) *int {
+
+	if n == 0 {
+		return nil
+	}
+
+	return &n
+}
+
+// isUniqueViolation проверяет, что запрос нарушил ограничение UNIQUE
+// (первичный ключ даёт другой код, поэтому в таблице с одним UNIQUE-столбцом он определяется однозначно)
+func isUniqueViolation(err error) bool {
+
+	var sqliteErr *sqlitedriver.Error
+
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// LIKE в SQLite не учитывает регистр только латиницы, поэтому подстроки (как ILIKE в PostgreSQL)
+// ищутся функцией icontains(строка, подстрока)
+func init() {
+
+	sqlitedriver.MustRegisterDeterministicScalarFunction("icontains", 2,
+		func(_ *sqlitedriver.FunctionContext, args []driver.Value) (driver.Value, error) {
+			haystack, _ := args[0].(string)
+			needle, _ := args[1].(string)
+			return strings.Contains(strings.ToLower(haystack), strings.ToLower(needle)), nil
+		})
+}
@@ -0,0 +1,145 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// scanUser считывает строку выборки из users в структуру User
+func scanUser(row scanner, user *db.User) error {
+
+	var createdAt int64
+	if err := row.Scan(&user.ID, &user.Name, &user.IsAdmin, &createdAt); err != nil {
+		return err
+	}
+
+	user.CreatedAt = fromMicro(createdAt)
+
+	return nil
+}
+
+// CreateUser добавляет нового пользователя (db.ErrUserExists, если имя занято)
+func (d *DataBase) CreateUser(ctx context.Context, name string, isAdmin bool) (*db.User, error) {
+
+	query := `INSERT INTO users (name, is_admin, created_at)
+	          VALUES (?, ?, ?)
+	          RETURNING id, name, is_admin, created_at`
+
+	user := &db.User{}
+
+	err := scanUser(d.conn.QueryRowContext(ctx, query, name, isAdmin, toMicro(time.Now())), user)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, db.ErrUserExists
+		}
+		return nil, fmt.Errorf("ошибка добавления пользователя в CreateUser: %w", err)
+	}
+
+	return user, nil
+}
+
+// GetUserByName возвращает пользователя по имени (или nil, nil)
+func (d *DataBase) GetUserByName(ctx context.Context, name string) (*db.User, error) {
+
+	query := `SELECT id, name, is_admin, created_at
+	            FROM users
+	           WHERE name = ?`
+
+	user := &db.User{}
+
+	err := scanUser(d.conn.QueryRowContext(ctx, query, name), user)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения пользователя по имени в GetUserByName: %w", err)
+	}
+
+	return user, nil
+}
+
+// AddAPIKey сохраняет хэш нового API-ключа пользователя (повторное добавление того же хэша игнорируется)
+func (d *DataBase) AddAPIKey(ctx context.Context, userID int, keyHash string) error {
+
+	query := `INSERT INTO api_keys (user_id, key_hash, created_at)
+	          VALUES (?, ?, ?)
+	          ON CONFLICT (key_hash) DO NOTHING`
+
+	_, err := d.conn.ExecContext(ctx, query, userID, keyHash, toMicro(time.Now()))
+	if err != nil {
+		return fmt.Errorf("ошибка добавления API-ключа в AddAPIKey: %w", err)
+	}
+
+	return nil
+}
+
+// ReplaceAPIKeys делает ключ единственным действующим ключом пользователя: сохраняет его хэш
+// (снимая отзыв, если ключ был отозван) и отзывает остальные ключи; возвращает число отозванных
+func (d *DataBase) ReplaceAPIKeys(ctx context.Context, userID int, keyHash string) (int, error) {
+
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка открытия транзакции в ReplaceAPIKeys: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := toMicro(time.Now())
+
+	query := `INSERT INTO api_keys (user_id, key_hash, created_at)
+	          VALUES (?, ?, ?)
+	          ON CONFLICT (key_hash) DO UPDATE SET revoked_at = NULL
+	          WHERE api_keys.user_id = excluded.user_id`
+
+	if _, err = tx.ExecContext(ctx, query, userID, keyHash, now); err != nil {
+		return 0, fmt.Errorf("ошибка добавления API-ключа в ReplaceAPIKeys: %w", err)
+	}
+
+	query = `UPDATE api_keys
+	            SET revoked_at = ?
+	          WHERE user_id = ?
+	            AND key_hash <> ?
+	            AND revoked_at IS NULL`
+
+	res, err := tx.ExecContext(ctx, query, now, userID, keyHash)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка отзыва API-ключей в ReplaceAPIKeys: %w", err)
+	}
+
+	revoked, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка отзыва API-ключей в ReplaceAPIKeys: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("ошибка завершения транзакции в ReplaceAPIKeys: %w", err)
+	}
+
+	return int(revoked), nil
+}
+
+// GetUserByKeyHash возвращает владельца действующего API-ключа по его хэшу (или nil, nil)
+func (d *DataBase) GetUserByKeyHash(ctx context.Context, keyHash string) (*db.User, error) {
+
+	query := `SELECT u.id, u.name, u.is_admin, u.created_at
+	            FROM api_keys AS k
+	            JOIN users AS u ON u.id = k.user_id
+	           WHERE k.key_hash = ?
+	             AND k.revoked_at IS NULL`
+
+	user := &db.User{}
+
+	err := scanUser(d.conn.QueryRowContext(ctx, query, keyHash), user)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения пользователя по API-ключу в GetUserByKeyHash: %w", err)
+	}
+
+	return user, nil
+}
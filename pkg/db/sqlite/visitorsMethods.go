@@ -0,0 +1,86 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// AddVisitors сохраняет посетителей ссылок по дням (повторный посетитель за день не дублируется)
+func (d *DataBase) AddVisitors(ctx context.Context, visits []db.Visit) error {
+
+	if len(visits) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO link_visitors (link_id, day, visitor)
+	          VALUES (?, ?, ?)
+	          ON CONFLICT DO NOTHING`
+
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		for _, v := range visits {
+			if _, err := tx.ExecContext(ctx, query, v.LinkID, v.Day.Format(time.DateOnly), v.Visitor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения посетителей в AddVisitors: %w", err)
+	}
+
+	return nil
+}
+
+// CountVisitors - число уникальных посетителей ссылки за дни [from, to] по дням и за весь период
+func (d *DataBase) CountVisitors(ctx context.Context, linkID int, from, to time.Time) (int, map[string]int, error) {
+
+	dayFrom, dayTo := from.Format(time.DateOnly), to.Format(time.DateOnly)
+
+	query := `SELECT day,
+	                 COUNT(*)
+	            FROM link_visitors
+	           WHERE link_id = ?
+	             AND day BETWEEN ? AND ?
+	           GROUP BY day`
+
+	byDay, err := d.countGrouped(ctx, "CountVisitors", query, linkID, dayFrom, dayTo)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	query = `SELECT COUNT(DISTINCT visitor)
+	           FROM link_visitors
+	          WHERE link_id = ?
+	            AND day BETWEEN ? AND ?`
+
+	var total int
+	if err = d.conn.QueryRowContext(ctx, query, linkID, dayFrom, dayTo).Scan(&total); err != nil {
+		return 0, nil, fmt.Errorf("ошибка подсчёта посетителей за период в CountVisitors: %w", err)
+	}
+
+	return total, byDay, nil
+}
+
+// VisitorSalt возвращает сохранённую соль хэширования посетителей, а если её ещё нет - сохраняет candidate
+func (d *DataBase) VisitorSalt(ctx context.Context, candidate string) (string, error) {
+
+	query := `INSERT INTO service_settings (name, value)
+	          VALUES (?, ?)
+	          ON CONFLICT (name) DO NOTHING`
+
+	if _, err := d.conn.ExecContext(ctx, query, db.VisitorSaltSetting, candidate); err != nil {
+		return "", fmt.Errorf("ошибка сохранения соли посетителей в VisitorSalt: %w", err)
+	}
+
+	var salt string
+	err := d.conn.QueryRowContext(ctx, `SELECT value FROM service_settings WHERE name = ?`, db.VisitorSaltSetting).Scan(&salt)
+	if err != nil {
+		return "", fmt.Errorf("ошибка чтения соли посетителей в VisitorSalt: %w", err)
+	}
+
+	return salt, nil
+}
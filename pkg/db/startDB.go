@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/IPampurin/UrlShortener/pkg/configuration"
 	pgxdriver "github.com/wb-go/wbf/dbpg/pgx-driver"
@@ -15,8 +16,46 @@ type DataBase struct {
 }
 
 // InitDB инициализирует подключение к PostgreSQL и применяет миграции
+// (при DB_AUTO_MIGRATE=false только проверяет, что все миграции уже применены)
 func InitDB(ctx context.Context, cfgDb *configuration.ConfDB, log logger.Logger) (*DataBase, error) {
 
+	storage, err := ConnectDB(ctx, cfgDb, log)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cfgDb.AutoMigrate {
+		if err = storage.checkMigrated(ctx); err != nil {
+			storage.Close()
+			return nil, err
+		}
+
+		// секции на текущий месяц нужны до первой записи переходов
+		if err = storage.EnsurePartitions(ctx, time.Now().AddDate(0, 1, 0)); err != nil {
+			storage.Close()
+			return nil, err
+		}
+
+		log.Info("База данных успешно запущена, схема актуальна.")
+
+		return storage, nil
+	}
+
+	// запускаем миграции
+	applied, err := storage.Migration(ctx)
+	if err != nil {
+		storage.Close()
+		return nil, fmt.Errorf("ошибка миграций: %w", err)
+	}
+
+	log.Info("База данных успешно запущена, миграции применены.", "applied", applied)
+
+	return storage, nil
+}
+
+// ConnectDB подключается к PostgreSQL без применения миграций (для команды migrate)
+func ConnectDB(ctx context.Context, cfgDb *configuration.ConfDB, log logger.Logger) (*DataBase, error) {
+
 	// формируем DSN из конфигурации
 	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
 		cfgDb.User, cfgDb.Password, cfgDb.HostName, cfgDb.Port, cfgDb.Name)
@@ -30,21 +69,30 @@ func InitDB(ctx context.Context, cfgDb *configuration.ConfDB, log logger.Logger)
 
 	// проверяем соединение
 	if err = pgxConn.Ping(ctx); err != nil {
+		pgxConn.Close()
 		return nil, fmt.Errorf("ошибка соединения с клиентом pgxdriver: %w", err)
 	}
 
-	storage := &DataBase{pgxConn}
-
 	log.Info("Клиент БД получен.")
 
-	// запускаем миграции
-	if err = storage.Migration(ctx); err != nil {
-		return nil, fmt.Errorf("ошибка миграций: %w", err)
+	return &DataBase{pgxConn}, nil
+}
+
+// checkMigrated возвращает ошибку, если в БД применены не все миграции этой версии сервиса
+func (d *DataBase) checkMigrated(ctx context.Context) error {
+
+	statuses, err := d.MigrationStatus(ctx)
+	if err != nil {
+		return err
 	}
 
-	log.Info("База данных успешно запущена, миграции применены.")
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			return fmt.Errorf("миграция %04d_%s не применена: выполните migrate up", s.Version, s.Name)
+		}
+	}
 
-	return storage, nil
+	return nil
 }
 
 // CloseDB закрывает пул соединений с БД
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateUser добавляет нового пользователя (ErrUserExists, если имя занято)
+func (d *DataBase) CreateUser(ctx context.Context, name string, isAdmin bool) (*User, error) {
+
+	query := `INSERT INTO users (name, is_admin, created_at)
+	          VALUES ($1, $2, NOW())
+			  RETURNING id, name, is_admin, created_at`
+
+	user := &User{}
+
+	err := d.Pool.QueryRow(ctx, query, name, isAdmin).
+		Scan(&user.ID, &user.Name, &user.IsAdmin, &user.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err, "users_name_key") {
+			return nil, ErrUserExists
+		}
+		return nil, fmt.Errorf("ошибка добавления пользователя в CreateUser: %w", err)
+	}
+
+	return user, nil
+}
+
+// GetUserByName возвращает пользователя по имени (или nil, nil)
+func (d *DataBase) GetUserByName(ctx context.Context, name string) (*User, error) {
+
+	query := `SELECT id, name, is_admin, created_at
+	            FROM users
+			   WHERE name = $1`
+
+	user := &User{}
+
+	err := d.Pool.QueryRow(ctx, query, name).
+		Scan(&user.ID, &user.Name, &user.IsAdmin, &user.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения пользователя по имени в GetUserByName: %w", err)
+	}
+
+	return user, nil
+}
+
+// AddAPIKey сохраняет хэш нового API-ключа пользователя (повторное добавление того же хэша игнорируется)
+func (d *DataBase) AddAPIKey(ctx context.Context, userID int, keyHash string) error {
+
+	query := `INSERT INTO api_keys (user_id, key_hash, created_at)
+	          VALUES ($1, $2, NOW())
+			  ON CONFLICT (key_hash) DO NOTHING`
+
+	_, err := d.Pool.Exec(ctx, query, userID, keyHash)
+	if err != nil {
+		return fmt.Errorf("ошибка добавления API-ключа в AddAPIKey: %w", err)
+	}
+
+	return nil
+}
+
+// ReplaceAPIKeys делает ключ единственным действующим ключом пользователя: сохраняет его хэш
+// (снимая отзыв, если ключ был отозван) и отзывает остальные ключи; возвращает число отозванных
+func (d *DataBase) ReplaceAPIKeys(ctx context.Context, userID int, keyHash string) (int, error) {
+
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка открытия транзакции в ReplaceAPIKeys: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	query := `INSERT INTO api_keys (user_id, key_hash, created_at)
+	          VALUES ($1, $2, NOW())
+			  ON CONFLICT (key_hash) DO UPDATE SET revoked_at = NULL
+			  WHERE api_keys.user_id = EXCLUDED.user_id`
+
+	if _, err = tx.Exec(ctx, query, userID, keyHash); err != nil {
+		return 0, fmt.Errorf("ошибка добавления API-ключа в ReplaceAPIKeys: %w", err)
+	}
+
+	query = `UPDATE api_keys
+	            SET revoked_at = NOW()
+	          WHERE user_id = $1
+	            AND key_hash <> $2
+			    AND revoked_at IS NULL`
+
+	tag, err := tx.Exec(ctx, query, userID, keyHash)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка отзыва API-ключей в ReplaceAPIKeys: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("ошибка завершения транзакции в ReplaceAPIKeys: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// GetUserByKeyHash возвращает владельца действующего API-ключа по его хэшу (или nil, nil)
+func (d *DataBase) GetUserByKeyHash(ctx context.Context, keyHash string) (*User, error) {
+
+	query := `SELECT u.id, u.name, u.is_admin, u.created_at
+	            FROM api_keys AS k
+				JOIN users AS u ON u.id = k.user_id
+			   WHERE k.key_hash = $1
+			     AND k.revoked_at IS NULL`
+
+	user := &User{}
+
+	err := d.Pool.QueryRow(ctx, query, keyHash).
+		Scan(&user.ID, &user.Name, &user.IsAdmin, &user.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения пользователя по API-ключу в GetUserByKeyHash: %w", err)
+	}
+
+	return user, nil
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AddVisitors сохраняет посетителей ссылок по дням (повторный посетитель за день не дублируется);
+// используется, когда Redis с HyperLogLog недоступен
+func (d *DataBase) AddVisitors(ctx context.Context, visits []Visit) error {
+
+	if len(visits) == 0 {
+		return nil
+	}
+
+	linkIDs := make([]int, len(visits))
+	days := make([]time.Time, len(visits))
+	visitors := make([]int64, len(visits))
+	for i, v := range visits {
+		linkIDs[i] = v.LinkID
+		days[i] = v.Day
+		visitors[i] = v.Visitor
+	}
+
+	query := `INSERT INTO link_visitors (link_id, day, visitor)
+	          SELECT * FROM UNNEST($1::INT[], $2::DATE[], $3::BIGINT[])
+	          ON CONFLICT DO NOTHING`
+
+	_, err := d.Pool.Exec(ctx, query, linkIDs, days, visitors)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения посетителей в AddVisitors: %w", err)
+	}
+
+	return nil
+}
+
+// CountVisitors - число уникальных посетителей ссылки за дни [from, to] по дням и за весь период
+func (d *DataBase) CountVisitors(ctx context.Context, linkID int, from, to time.Time) (int, map[string]int, error) {
+
+	query := `SELECT TO_CHAR(day, 'YYYY-MM-DD'),
+	                 COUNT(*)
+	            FROM link_visitors
+	           WHERE link_id = $1
+	             AND day BETWEEN $2::DATE AND $3::DATE
+	           GROUP BY day`
+
+	rows, err := d.Pool.Query(ctx, query, linkID, from, to)
+	if err != nil {
+		return 0, nil, fmt.Errorf("ошибка при выполнении запроса в CountVisitors: %w", err)
+	}
+	defer rows.Close()
+
+	byDay := make(map[string]int)
+	var key string
+	var val int
+	for rows.Next() {
+		if err := rows.Scan(&key, &val); err != nil {
+			return 0, nil, fmt.Errorf("ошибка при сканировании строки запроса в CountVisitors: %w", err)
+		}
+		byDay[key] = val
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("ошибка при итерации по списку записей в CountVisitors: %w", err)
+	}
+
+	query = `SELECT COUNT(DISTINCT visitor)
+	           FROM link_visitors
+	          WHERE link_id = $1
+	            AND day BETWEEN $2::DATE AND $3::DATE`
+
+	var total int
+	if err = d.Pool.QueryRow(ctx, query, linkID, from, to).Scan(&total); err != nil {
+		return 0, nil, fmt.Errorf("ошибка подсчёта посетителей за период в CountVisitors: %w", err)
+	}
+
+	return total, byDay, nil
+}
+
+// VisitorSalt возвращает сохранённую в service_settings соль хэширования посетителей,
+// а если её ещё нет - сохраняет candidate (одновременный старт нескольких экземпляров даёт одну соль)
+func (d *DataBase) VisitorSalt(ctx context.Context, candidate string) (string, error) {
+
+	query := `INSERT INTO service_settings (name, value)
+	          VALUES ($1, $2)
+	          ON CONFLICT (name) DO NOTHING`
+
+	if _, err := d.Pool.Exec(ctx, query, VisitorSaltSetting, candidate); err != nil {
+		return "", fmt.Errorf("ошибка сохранения соли посетителей в VisitorSalt: %w", err)
+	}
+
+	// отдельный запрос видит и соль, сохранённую другим экземпляром одновременно с нами
+	var salt string
+	err := d.Pool.QueryRow(ctx, `SELECT value FROM service_settings WHERE name = $1`, VisitorSaltSetting).Scan(&salt)
+	if err != nil {
+		return "", fmt.Errorf("ошибка чтения соли посетителей в VisitorSalt: %w", err)
+	}
+
+	return salt, nil
+}
@@ -0,0 +1,158 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRowGroup - строк в одной группе Parquet: группа целиком держится в памяти до записи
+const parquetRowGroup = 10000
+
+// NewEncoder возвращает кодировщик формата format, пишущий в w
+func NewEncoder(format string, w io.Writer) (Encoder, error) {
+
+	switch format {
+	case FormatCSV:
+		enc := &csvEncoder{w: csv.NewWriter(w)}
+		if err := enc.w.Write(csvHeader); err != nil {
+			return nil, fmt.Errorf("ошибка записи заголовка CSV: %w", err)
+		}
+		return enc, nil
+
+	case FormatNDJSON:
+		buf := bufio.NewWriter(w)
+		return &ndjsonEncoder{buf: buf, enc: json.NewEncoder(buf)}, nil
+
+	case FormatParquet:
+		return &parquetEncoder{
+			w:     parquet.NewGenericWriter[Row](w, parquet.MaxRowsPerRowGroup(parquetRowGroup)),
+			batch: make([]Row, 0, parquetRowGroup),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("неизвестный формат выгрузки %q", format)
+}
+
+// Supported проверяет, что формат поддерживается
+func Supported(format string) bool {
+
+	_, ok := contentTypes[format]
+
+	return ok
+}
+
+// ContentType возвращает MIME-тип формата
+func ContentType(format string) string {
+
+	return contentTypes[format]
+}
+
+// csvEncoder пишет строки CSV (encoding/csv буферизует вывод сам)
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) Write(row *Row) error {
+
+	return e.w.Write([]string{
+		csvText(row.ShortURL),
+		row.AccessedAt.UTC().Format(time.RFC3339Nano),
+		csvText(row.UserAgent),
+		csvText(row.IPAddress),
+		csvText(row.Referer),
+		strconv.FormatBool(row.IsBot),
+		strconv.FormatBool(row.IsRepeat),
+		csvText(row.Browser),
+		csvText(row.BrowserVersion),
+		csvText(row.OS),
+		csvText(row.OSVersion),
+		csvText(row.Device),
+		csvText(row.Country),
+		csvText(row.Region),
+		csvText(row.City),
+		strconv.Itoa(row.ASN),
+		csvText(row.ASOrg),
+	})
+}
+
+// csvText защищает текстовую ячейку от CSV-инъекции (рекомендация OWASP): выгрузку открывают в таблицах,
+// а User-Agent и Referer задаёт посетитель, поэтому значение, которое табличный редактор принял бы
+// за формулу (начинается с =, +, -, @, табуляции или перевода каретки), предваряется апострофом
+func csvText(s string) string {
+
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+
+	return s
+}
+
+func (e *csvEncoder) Close() error {
+
+	e.w.Flush()
+
+	return e.w.Error()
+}
+
+// ndjsonEncoder пишет по одному JSON-объекту на строку
+type ndjsonEncoder struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) Write(row *Row) error {
+
+	return e.enc.Encode(row)
+}
+
+func (e *ndjsonEncoder) Close() error {
+
+	return e.buf.Flush()
+}
+
+// parquetEncoder копит строки пачками и отдаёт их писателю Parquet
+type parquetEncoder struct {
+	w     *parquet.GenericWriter[Row]
+	batch []Row
+}
+
+func (e *parquetEncoder) Write(row *Row) error {
+
+	e.batch = append(e.batch, *row)
+	if len(e.batch) < cap(e.batch) {
+		return nil
+	}
+
+	return e.flush()
+}
+
+func (e *parquetEncoder) flush() error {
+
+	if len(e.batch) == 0 {
+		return nil
+	}
+
+	if _, err := e.w.Write(e.batch); err != nil {
+		return fmt.Errorf("ошибка записи строк Parquet: %w", err)
+	}
+	e.batch = e.batch[:0]
+
+	return nil
+}
+
+func (e *parquetEncoder) Close() error {
+
+	if err := e.flush(); err != nil {
+		return err
+	}
+
+	return e.w.Close()
+}
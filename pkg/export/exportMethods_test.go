@@ -0,0 +1,158 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// testRows - строки выгрузки, в том числе с полями, которые табличный редактор принял бы за формулу
+func testRows() []Row {
+
+	at := time.Date(2026, time.October, 1, 12, 30, 0, 123000000, time.UTC)
+
+	return []Row{
+		{
+			ShortURL: "abc123", AccessedAt: at, UserAgent: "Mozilla/5.0", IPAddress: "203.0.113.7",
+			Referer: "https://example.com/", Browser: "Firefox", BrowserVersion: "121", OS: "Linux",
+			Device: "desktop", Country: "DE", Region: "Berlin", City: "Berlin", ASN: 3320, ASOrg: "Deutsche Telekom",
+		},
+		{
+			ShortURL: "abc123", AccessedAt: at.Add(time.Second), UserAgent: "=cmd|' /C calc'!A0", IPAddress: "2001:db8::1",
+			Referer: `=HYPERLINK("https://evil.example","x")`, IsBot: true, IsRepeat: true, City: "@SUM(1+1)",
+			ASOrg: "+1", Region: "-2", OS: "\tTab", Device: "\rCR",
+		},
+	}
+}
+
+func encode(t *testing.T, format string, rows []Row) []byte {
+
+	t.Helper()
+
+	var buf bytes.Buffer
+	enc, err := NewEncoder(format, &buf)
+	if err != nil {
+		t.Fatalf("NewEncoder(%s): %v", format, err)
+	}
+	for i := range rows {
+		if err = enc.Write(&rows[i]); err != nil {
+			t.Fatalf("Write(%s): %v", format, err)
+		}
+	}
+	if err = enc.Close(); err != nil {
+		t.Fatalf("Close(%s): %v", format, err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestCSVEncoder(t *testing.T) {
+
+	records, err := csv.NewReader(bytes.NewReader(encode(t, FormatCSV, testRows()))).ReadAll()
+	if err != nil {
+		t.Fatalf("разбор CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("строк CSV %d, ожидалось 3 (заголовок и две строки)", len(records))
+	}
+	if !reflect.DeepEqual(records[0], csvHeader) {
+		t.Errorf("заголовок %v, ожидался %v", records[0], csvHeader)
+	}
+
+	column := make(map[string]int, len(csvHeader))
+	for i, name := range csvHeader {
+		column[name] = i
+	}
+
+	plain := map[string]string{
+		"short_url": "abc123", "accessed_at": "2026-10-01T12:30:00.123Z", "user_agent": "Mozilla/5.0",
+		"referer": "https://example.com/", "is_bot": "false", "asn": "3320", "as_org": "Deutsche Telekom",
+	}
+	for name, want := range plain {
+		if got := records[1][column[name]]; got != want {
+			t.Errorf("%s = %q, ожидалось %q", name, got, want)
+		}
+	}
+
+	// значения, начинающиеся с =, +, -, @, табуляции и CR, не должны исполняться как формулы
+	escaped := map[string]string{
+		"user_agent": "'=cmd|' /C calc'!A0",
+		"referer":    `'=HYPERLINK("https://evil.example","x")`,
+		"city":       "'@SUM(1+1)",
+		"as_org":     "'+1",
+		"region":     "'-2",
+		"os":         "'\tTab",
+		"device":     "'\rCR",
+		"ip_address": "2001:db8::1",
+		"is_bot":     "true",
+	}
+	for name, want := range escaped {
+		if got := records[2][column[name]]; got != want {
+			t.Errorf("%s = %q, ожидалось %q", name, got, want)
+		}
+	}
+}
+
+func TestNDJSONEncoder(t *testing.T) {
+
+	want := testRows()
+
+	var got []Row
+	scanner := bufio.NewScanner(bytes.NewReader(encode(t, FormatNDJSON, want)))
+	for scanner.Scan() {
+		var row Row
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatalf("разбор строки NDJSON %q: %v", scanner.Text(), err)
+		}
+		got = append(got, row)
+	}
+
+	// в JSON значения передаются как есть: формулами их делает только табличный редактор
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NDJSON:\n%+v\nожидалось\n%+v", got, want)
+	}
+}
+
+func TestParquetEncoder(t *testing.T) {
+
+	// больше одной группы строк, чтобы проверить сброс пачек
+	rows := testRows()
+	want := make([]Row, parquetRowGroup+3)
+	for i := range want {
+		want[i] = rows[i%len(rows)]
+		want[i].ASN = i
+	}
+
+	data := encode(t, FormatParquet, want)
+
+	got, err := parquet.Read[Row](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("чтение Parquet: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("строк Parquet %d, ожидалось %d", len(got), len(want))
+	}
+	for i := range want {
+		// время в Parquet хранится с точностью до миллисекунды
+		got[i].AccessedAt = got[i].AccessedAt.UTC()
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Fatalf("строка %d:\n%+v\nожидалась\n%+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestNewEncoderUnknownFormat(t *testing.T) {
+
+	if _, err := NewEncoder("xlsx", &bytes.Buffer{}); err == nil {
+		t.Error("NewEncoder: неизвестный формат не отклонён")
+	}
+	if Supported("xlsx") || !Supported(FormatParquet) {
+		t.Error("Supported: неверный список форматов")
+	}
+}
@@ -0,0 +1,9 @@
+package export
+
+type Encoder interface {
+	// Write кодирует одну строку выгрузки (кодировщик может буферизовать строки)
+	Write(row *Row) error
+
+	// Close дописывает буферизованные строки и завершающие данные формата (футер Parquet)
+	Close() error
+}
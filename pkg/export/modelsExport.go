@@ -0,0 +1,47 @@
+package export
+
+import (
+	"time"
+)
+
+// форматы выгрузки
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+// Row - строка выгрузки переходов (одинаковый набор колонок во всех форматах)
+type Row struct {
+	ShortURL       string    `json:"short_url"       parquet:"short_url,dict"`
+	AccessedAt     time.Time `json:"accessed_at"     parquet:"accessed_at,timestamp(millisecond)"`
+	UserAgent      string    `json:"user_agent"      parquet:"user_agent,dict"`
+	IPAddress      string    `json:"ip_address"      parquet:"ip_address"`
+	Referer        string    `json:"referer"         parquet:"referer,dict"`
+	IsBot          bool      `json:"is_bot"          parquet:"is_bot"`
+	IsRepeat       bool      `json:"is_repeat"       parquet:"is_repeat"`
+	Browser        string    `json:"browser"         parquet:"browser,dict"`
+	BrowserVersion string    `json:"browser_version" parquet:"browser_version,dict"`
+	OS             string    `json:"os"              parquet:"os,dict"`
+	OSVersion      string    `json:"os_version"      parquet:"os_version,dict"`
+	Device         string    `json:"device"          parquet:"device,dict"`
+	Country        string    `json:"country"         parquet:"country,dict"`
+	Region         string    `json:"region"          parquet:"region,dict"`
+	City           string    `json:"city"            parquet:"city,dict"`
+	ASN            int       `json:"asn"             parquet:"asn"`
+	ASOrg          string    `json:"as_org"          parquet:"as_org,dict"`
+}
+
+// csvHeader - заголовок CSV в порядке полей Row
+var csvHeader = []string{
+	"short_url", "accessed_at", "user_agent", "ip_address", "referer", "is_bot", "is_repeat",
+	"browser", "browser_version", "os", "os_version", "device",
+	"country", "region", "city", "asn", "as_org",
+}
+
+// contentTypes - MIME-типы форматов выгрузки
+var contentTypes = map[string]string{
+	FormatCSV:     "text/csv; charset=utf-8",
+	FormatNDJSON:  "application/x-ndjson",
+	FormatParquet: "application/vnd.apache.parquet",
+}
@@ -0,0 +1,165 @@
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// database - одна MMDB-база, которую можно атомарно подменить новой версией файла
+type database struct {
+	path string
+
+	reader  atomic.Pointer[maxminddb.Reader]
+	modTime time.Time // время изменения загруженного файла (меняется только в watch)
+	size    int64
+}
+
+// newDatabase возвращает базу для path (nil, если путь не задан)
+func newDatabase(path string) *database {
+
+	if path == "" {
+		return nil
+	}
+
+	return &database{path: path}
+}
+
+// load читает файл целиком в память: старый reader не нужно закрывать,
+// идущие по нему поиски спокойно доработают, а память освободит сборщик мусора
+// (при ошибке продолжает работать прежняя версия базы)
+func (d *database) load() error {
+
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return fmt.Errorf("ошибка получения сведений о файле: %w", err)
+	}
+
+	// запоминаем версию файла и при неудаче, чтобы не перечитывать битый файл на каждом тике
+	d.modTime = info.ModTime()
+	d.size = info.Size()
+
+	buf, err := os.ReadFile(d.path)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+
+	reader, err := maxminddb.FromBytes(buf)
+	if err != nil {
+		return fmt.Errorf("ошибка разбора MMDB: %w", err)
+	}
+
+	d.reader.Store(reader)
+
+	return nil
+}
+
+// changed сообщает, что файл базы заменён с момента последней загрузки
+func (d *database) changed() bool {
+
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return false // файл могут заменять прямо сейчас, попробуем на следующем тике
+	}
+
+	return !info.ModTime().Equal(d.modTime) || info.Size() != d.size
+}
+
+// lookup ищет ip в базе и заполняет rec (false - базы нет или адрес не найден)
+func (d *database) lookup(ip net.IP, rec *record) bool {
+
+	if d == nil {
+		return false
+	}
+
+	reader := d.reader.Load()
+	if reader == nil {
+		return false
+	}
+
+	return reader.Lookup(ip, rec) == nil
+}
+
+// Lookup определяет страну, регион, город и автономную систему IP-адреса
+func (e *Enricher) Lookup(ip net.IP) Location {
+
+	var loc Location
+
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() {
+		return loc
+	}
+
+	var rec record
+	if e.city.lookup(ip, &rec) {
+		loc.Country = rec.Country.ISOCode
+		loc.City = localized(rec.City.Names)
+		if len(rec.Subdivisions) > 0 {
+			loc.Region = localized(rec.Subdivisions[0].Names)
+		}
+		// базы, совмещающие город и ASN
+		loc.ASN = int(rec.ASN)
+		loc.ASOrg = rec.ASOrg
+	}
+
+	var asn record
+	if e.asn.lookup(ip, &asn) && asn.ASN != 0 {
+		loc.ASN = int(asn.ASN)
+		loc.ASOrg = asn.ASOrg
+	}
+
+	return loc
+}
+
+// watch периодически проверяет файлы баз и перечитывает заменённые
+func (e *Enricher) watch(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			for _, d := range e.databases() {
+				if !d.changed() {
+					continue
+				}
+				if err := d.load(); err != nil {
+					e.log.Error("ошибка перечитывания GeoIP базы", "path", d.path, "error", err)
+					continue
+				}
+				e.log.Info("GeoIP база перечитана", "path", d.path)
+			}
+		}
+	}
+}
+
+// databases возвращает заданные в конфигурации базы
+func (e *Enricher) databases() []*database {
+
+	var list []*database
+	for _, d := range []*database{e.city, e.asn} {
+		if d != nil {
+			list = append(list, d)
+		}
+	}
+
+	return list
+}
+
+// localized выбирает английское название (оно есть у всех записей), иначе русское
+func localized(names map[string]string) string {
+
+	if name, ok := names["en"]; ok {
+		return name
+	}
+
+	return names["ru"]
+}
@@ -0,0 +1,10 @@
+package geoip
+
+import (
+	"net"
+)
+
+type GeoIPMethods interface {
+	// Lookup определяет местоположение IP-адреса (без баз или для неизвестного адреса - пустой Location)
+	Lookup(ip net.IP) Location
+}
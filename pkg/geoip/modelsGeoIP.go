@@ -0,0 +1,26 @@
+package geoip
+
+// Location - результат определения местоположения по IP-адресу (пустые поля - не определено)
+type Location struct {
+	Country string // ISO-код страны (RU, DE, ...)
+	Region  string // регион (субъект, штат, земля)
+	City    string // город
+	ASN     int    // номер автономной системы
+	ASOrg   string // организация, владеющая автономной системой
+}
+
+// record - поля MMDB-записи, которые нам нужны (совместимо с GeoLite2/GeoIP2 City и ASN,
+// а также с базами, где город и ASN лежат в одной записи)
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
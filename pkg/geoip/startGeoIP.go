@@ -0,0 +1,50 @@
+package geoip
+
+import (
+	"context"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/configuration"
+	"github.com/wb-go/wbf/logger"
+)
+
+// Enricher определяет местоположение по локальным MMDB-базам и перечитывает их при замене файлов
+type Enricher struct {
+	city *database // база городов (GeoLite2-City и аналоги)
+	asn  *database // база автономных систем (GeoLite2-ASN и аналоги)
+
+	log logger.Logger
+}
+
+// InitGeoIP открывает базы из конфигурации и запускает их отслеживание;
+// без путей (или при ошибке чтения) обогащение просто не выполняется
+func InitGeoIP(ctx context.Context, cfgGeo *configuration.ConfGeoIP, log logger.Logger) *Enricher {
+
+	e := &Enricher{
+		city: newDatabase(cfgGeo.CityPath),
+		asn:  newDatabase(cfgGeo.ASNPath),
+		log:  log,
+	}
+
+	for _, d := range e.databases() {
+		if err := d.load(); err != nil {
+			log.Warn("GeoIP база не загружена", "path", d.path, "error", err)
+		}
+	}
+
+	if len(e.databases()) == 0 {
+		log.Info("GeoIP отключён: пути к базам не заданы.")
+		return e
+	}
+
+	interval := cfgGeo.ReloadInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	go e.watch(ctx, interval)
+
+	log.Info("GeoIP запущен.", "city", cfgGeo.CityPath, "asn", cfgGeo.ASNPath, "reload_interval", interval)
+
+	return e
+}
@@ -0,0 +1,88 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/cache"
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// localDedup - окно дедупликации в памяти процесса на случай, когда Redis недоступен
+// (работает в пределах одного экземпляра сервиса)
+type localDedup struct {
+	mu        sync.Mutex
+	window    time.Duration
+	seen      map[string]time.Time // ключ посетителя ссылки -> время его последнего учтённого перехода
+	lastSweep time.Time
+}
+
+func newLocalDedup(window time.Duration) *localDedup {
+
+	return &localDedup{
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// first сообщает, что переход key в момент at - первый в окне (и начинает окно заново)
+func (d *localDedup) first(key string, at time.Time) bool {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// раз в окно выбрасываем истёкшие ключи, чтобы карта не росла бесконечно
+	if at.Sub(d.lastSweep) > d.window {
+		for k, t := range d.seen {
+			if at.Sub(t) >= d.window {
+				delete(d.seen, k)
+			}
+		}
+		d.lastSweep = at
+	}
+
+	if last, ok := d.seen[key]; ok && at.Sub(last) < d.window {
+		return false
+	}
+	d.seen[key] = at
+
+	return true
+}
+
+// markRepeats помечает повторные переходы одного посетителя по одной ссылке в окне дедупликации:
+// окно хранится короткоживущими ключами Redis, а если Redis не подключён или не ответил - в памяти
+func (p *Pipeline) markRepeats(ctx context.Context, batch []*db.Analytics, hashes []uint64) {
+
+	if p.dedupWindow <= 0 {
+		return
+	}
+
+	clicks := make([]*db.Analytics, 0, len(batch))
+	keys := make([]string, 0, len(batch))
+	for i, click := range batch {
+		if click.IsBot {
+			continue
+		}
+		clicks = append(clicks, click)
+		keys = append(keys, strconv.Itoa(click.LinkID)+":"+strconv.FormatUint(hashes[i], 16))
+	}
+
+	first, err := p.visitorsCache.FirstSeen(ctx, keys, p.dedupWindow)
+	if err == nil {
+		for i, click := range clicks {
+			click.IsRepeat = !first[i]
+		}
+		return
+	}
+	// о выключенном или недоступном кэше сообщает сам кэш
+	if !errors.Is(err, cache.ErrUnavailable) {
+		p.log.Warn("окно дедупликации ведётся в памяти: ошибка Redis", "error", err)
+	}
+
+	for i, click := range clicks {
+		click.IsRepeat = !p.dedup.first(keys[i], click.AccessedAt)
+	}
+}
@@ -0,0 +1,132 @@
+package ingest
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/cache"
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/IPampurin/UrlShortener/pkg/db/memory"
+	"github.com/wb-go/wbf/logger"
+)
+
+// fakeRedis - окно дедупликации, общее для экземпляров сервиса, как ключи SET NX с TTL в Redis
+// (остальные методы CacheMethods тестам не нужны)
+type fakeRedis struct {
+	cache.CacheMethods
+	seen map[string]time.Time
+	now  time.Time
+}
+
+func (r *fakeRedis) FirstSeen(_ context.Context, keys []string, window time.Duration) ([]bool, error) {
+
+	first := make([]bool, len(keys))
+	for i, key := range keys {
+		if at, ok := r.seen[key]; ok && r.now.Sub(at) < window {
+			continue
+		}
+		r.seen[key] = r.now
+		first[i] = true
+	}
+
+	return first, nil
+}
+
+func testLogger(t *testing.T) logger.Logger {
+
+	t.Helper()
+
+	log, err := logger.InitLogger(logger.SlogEngine, "UrlShortener", "test", logger.WithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("ошибка создания логгера: %v", err)
+	}
+
+	return log
+}
+
+// newReplica создаёт конвейер экземпляра сервиса с солью из общего хранилища (без воркеров)
+func newReplica(t *testing.T, storage db.VisitorMethods, redis cache.CacheMethods, window time.Duration) *Pipeline {
+
+	t.Helper()
+
+	salt, err := visitorSalt(context.Background(), storage, "")
+	if err != nil {
+		t.Fatalf("visitorSalt: %v", err)
+	}
+
+	return &Pipeline{
+		visitorsCache: redis,
+		visitorSalt:   salt,
+		dedupWindow:   window,
+		dedup:         newLocalDedup(window),
+		log:           testLogger(t),
+	}
+}
+
+func TestReplicasShareDedupWindow(t *testing.T) {
+
+	storage := memory.InitMemory(testLogger(t))
+	now := time.Date(2026, time.October, 1, 12, 0, 0, 0, time.UTC)
+	redis := &fakeRedis{seen: make(map[string]time.Time), now: now}
+
+	a := newReplica(t, storage, redis, 30*time.Second)
+	b := newReplica(t, storage, redis, 30*time.Second)
+
+	click := func() *db.Analytics {
+		return &db.Analytics{LinkID: 1, AccessedAt: now, IPAddress: net.ParseIP("203.0.113.7"), UserAgent: "Mozilla/5.0"}
+	}
+
+	first := []*db.Analytics{click()}
+	a.markRepeats(context.Background(), first, a.visitorHashes(first))
+
+	// тот же посетитель попал на другой экземпляр: его хэш и ключ окна должны совпасть
+	second := []*db.Analytics{click()}
+	b.markRepeats(context.Background(), second, b.visitorHashes(second))
+
+	if first[0].IsRepeat {
+		t.Error("первый переход помечен повторным")
+	}
+	if !second[0].IsRepeat {
+		t.Error("повторный переход на другом экземпляре не помечен: экземпляры хэшируют посетителя по-разному")
+	}
+}
+
+func TestVisitorSaltPrefersConfigured(t *testing.T) {
+
+	storage := memory.InitMemory(testLogger(t))
+
+	salt, err := visitorSalt(context.Background(), storage, "configured")
+	if err != nil || string(salt) != "configured" {
+		t.Fatalf("visitorSalt = %q, %v; ожидалась соль из конфигурации", salt, err)
+	}
+
+	stored, err := visitorSalt(context.Background(), storage, "")
+	if err != nil || len(stored) == 0 || string(stored) == "configured" {
+		t.Fatalf("visitorSalt = %q, %v; ожидалась сгенерированная соль из хранилища", stored, err)
+	}
+}
+
+func TestLocalDedupWindow(t *testing.T) {
+
+	d := newLocalDedup(30 * time.Second)
+	t0 := time.Date(2026, time.October, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		key   string
+		at    time.Time
+		first bool
+	}{
+		{"1:a", t0, true},
+		{"1:a", t0.Add(10 * time.Second), false},
+		{"2:a", t0.Add(10 * time.Second), true},
+		{"1:a", t0.Add(40 * time.Second), true}, // окно отсчитывается от последнего учтённого перехода
+		{"1:a", t0.Add(60 * time.Second), false},
+	}
+	for i, s := range steps {
+		if got := d.first(s.key, s.at); got != s.first {
+			t.Errorf("шаг %d (%s): first = %v, ожидалось %v", i, s.key, got, s.first)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/IPampurin/UrlShortener/pkg/useragent"
+	"github.com/wb-go/wbf/retry"
+)
+
+// flushTimeout ограничивает время одной записи пачки в БД (вместе с повторами)
+const flushTimeout = 10 * time.Second
+
+// saveRetry - повторы записи пачки при временных ошибках БД (обрыв соединения, перезапуск сервера)
+var saveRetry = retry.Strategy{Attempts: 3, Delay: 200 * time.Millisecond, Backoff: 2}
+
+// ширины столбцов analytics (VARCHAR(n) в миграциях): значение длиннее столбца
+// приводит к ошибке COPY всей пачки, поэтому измерения обрезаются до записи
+const (
+	familyWidth  = 32  // browser, os
+	versionWidth = 16  // browser_version, os_version
+	deviceWidth  = 16  // device
+	countryWidth = 2   // country
+	placeWidth   = 128 // region, city
+	asOrgWidth   = 255 // as_org
+)
+
+// Submit ставит переход в очередь, при переполнении очереди переход отбрасывается,
+// чтобы редирект никогда не ждал БД
+func (p *Pipeline) Submit(click *db.Analytics) bool {
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		p.dropped.Add(1)
+		return false
+	}
+
+	select {
+	case p.queue <- click:
+		p.accepted.Add(1)
+		return true
+	default:
+		p.dropped.Add(1)
+		return false
+	}
+}
+
+// Stats возвращает текущие значения счётчиков конвейера
+func (p *Pipeline) Stats() Stats {
+
+	return Stats{
+		Queued:   len(p.queue),
+		Capacity: cap(p.queue),
+		Accepted: p.accepted.Load(),
+		Dropped:  p.dropped.Load(),
+		Written:  p.written.Load(),
+		Failed:   p.failed.Load(),
+		Batches:  p.batches.Load(),
+	}
+}
+
+// Close закрывает очередь и ждёт, пока воркеры запишут всё, что в ней осталось
+// (если ctx без дедлайна, ожидание ограничено DrainTimeout из конфигурации)
+func (p *Pipeline) Close(ctx context.Context) error {
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.queue)
+	p.mu.Unlock()
+
+	if _, ok := ctx.Deadline(); !ok && p.drainTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.drainTimeout)
+		defer cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.log.Info("очередь переходов записана в БД", "written", p.written.Load(), "dropped", p.dropped.Load())
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("очередь переходов не успела записаться (осталось %d): %w", len(p.queue), ctx.Err())
+	}
+}
+
+// worker копит переходы в пачку и сбрасывает её при заполнении, по таймеру и при закрытии очереди
+func (p *Pipeline) worker() {
+
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*db.Analytics, 0, p.batchSize)
+
+	for {
+		select {
+		case click, ok := <-p.queue:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			p.enrich(click)
+			batch = append(batch, click)
+			if len(batch) >= p.batchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// enrich заполняет измерения перехода разбором User-Agent и GeoIP (в фоне, чтобы не задерживать редирект)
+func (p *Pipeline) enrich(click *db.Analytics) {
+
+	// PostgreSQL не принимает в TEXT нулевые байты и невалидный UTF-8
+	click.UserAgent = sanitize(click.UserAgent)
+	click.Referer = sanitize(click.Referer)
+
+	info := useragent.Parse(click.UserAgent, click.IsBot)
+
+	click.Browser = clip(info.Browser, familyWidth)
+	click.BrowserVersion = clip(info.BrowserVersion, versionWidth)
+	click.OS = clip(info.OS, familyWidth)
+	click.OSVersion = clip(info.OSVersion, versionWidth)
+	click.Device = clip(info.Device, deviceWidth)
+
+	loc := p.geo.Lookup(click.IPAddress)
+
+	click.Country = clip(loc.Country, countryWidth)
+	click.Region = clip(sanitize(loc.Region), placeWidth)
+	click.City = clip(sanitize(loc.City), placeWidth)
+	click.ASN = loc.ASN
+	click.ASOrg = clip(sanitize(loc.ASOrg), asOrgWidth)
+}
+
+// sanitize убирает из строки нулевые байты и невалидные последовательности UTF-8
+func sanitize(s string) string {
+
+	return strings.ReplaceAll(strings.ToValidUTF8(s, ""), "\x00", "")
+}
+
+// clip обрезает строку до width символов (VARCHAR(n) считает символы, а не байты)
+func clip(s string, width int) string {
+
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+
+	return string([]rune(s)[:width])
+}
+
+// flush записывает пачку переходов и одним запросом увеличивает счётчики затронутых ссылок
+func (p *Pipeline) flush(batch []*db.Analytics) {
+
+	if len(batch) == 0 {
+		return
+	}
+
+	// контекст не наследуется от запросов и сигналов: пачка должна дописаться и при остановке сервиса
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	p.batches.Add(1)
+
+	// хэши посетителей нужны и для дедупликации, и для подсчёта уникальных посетителей
+	hashes := p.visitorHashes(batch)
+	p.markRepeats(ctx, batch, hashes)
+
+	saved := p.save(ctx, batch)
+	if len(saved) == 0 {
+		return
+	}
+	if len(saved) < len(batch) {
+		batch = saved
+		hashes = p.visitorHashes(batch)
+	}
+
+	// переходы ботов сохраняются в аналитике, но не расходуют clicks_count (и бюджет max_clicks),
+	// повторы в окне дедупликации не попадают в dedup_clicks_count
+	counts := make(map[int]db.ClickDelta)
+	for _, click := range batch {
+		if click.IsBot {
+			continue
+		}
+		delta := counts[click.LinkID]
+		delta.Raw++
+		if !click.IsRepeat {
+			delta.Dedup++
+		}
+		counts[click.LinkID] = delta
+	}
+
+	if err := p.link.AddClicks(ctx, counts); err != nil {
+		p.log.Error("ошибка увеличения счётчиков переходов", "error", err, "links", len(counts))
+	}
+
+	p.countVisitors(ctx, batch, hashes)
+
+	p.written.Add(uint64(len(batch)))
+}
+
+// save записывает пачку переходов и возвращает записанные: временные ошибки БД переживаются
+// повторами с нарастающей паузой, а если пачка так и не записалась - она делится на части,
+// чтобы из-за негодной записи не терялись остальные
+func (p *Pipeline) save(ctx context.Context, batch []*db.Analytics) []*db.Analytics {
+
+	err := retry.DoContext(ctx, saveRetry, func() error {
+		return p.analytics.SaveAnalyticsBatch(ctx, batch)
+	})
+	if err == nil {
+		return batch
+	}
+
+	saved := p.split(ctx, batch)
+	if lost := len(batch) - len(saved); lost > 0 {
+		p.failed.Add(uint64(lost))
+		p.log.Error("ошибка записи пачки переходов", "error", err, "size", len(batch), "lost", lost)
+	}
+
+	return saved
+}
+
+// split делит отвергнутую пачку пополам и записывает половины по отдельности,
+// пока не останутся только записи, которые БД не принимает
+func (p *Pipeline) split(ctx context.Context, batch []*db.Analytics) []*db.Analytics {
+
+	// одиночную запись делить некуда, а по истёкшему контексту не запишется и остаток
+	if len(batch) == 1 || ctx.Err() != nil {
+		return nil
+	}
+
+	var saved []*db.Analytics
+
+	half := len(batch) / 2
+	for _, part := range [][]*db.Analytics{batch[:half], batch[half:]} {
+		if err := p.analytics.SaveAnalyticsBatch(ctx, part); err == nil {
+			saved = append(saved, part...)
+			continue
+		}
+		saved = append(saved, p.split(ctx, part)...)
+	}
+
+	return saved
+}
@@ -0,0 +1,18 @@
+package ingest
+
+import (
+	"context"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+type IngestMethods interface {
+	// Submit ставит переход в очередь без блокировки (false - очередь переполнена или конвейер остановлен)
+	Submit(click *db.Analytics) bool
+
+	// Stats возвращает текущие значения счётчиков конвейера
+	Stats() Stats
+
+	// Close прекращает приём переходов и дожидается записи очереди в БД (не дольше, чем позволяет ctx)
+	Close(ctx context.Context) error
+}
@@ -0,0 +1,12 @@
+package ingest
+
+// Stats - снимок счётчиков конвейера записи переходов (GET /admin/ingest)
+type Stats struct {
+	Queued   int    `json:"queued"`   // переходов в очереди на текущий момент
+	Capacity int    `json:"capacity"` // ёмкость очереди
+	Accepted uint64 `json:"accepted"` // принято в очередь
+	Dropped  uint64 `json:"dropped"`  // отброшено из-за переполнения очереди или остановки конвейера
+	Written  uint64 `json:"written"`  // записано в БД
+	Failed   uint64 `json:"failed"`   // потеряно из-за ошибок записи в БД
+	Batches  uint64 `json:"batches"`  // выполнено сбросов пачек в БД
+}
@@ -0,0 +1,87 @@
+package ingest
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/cache"
+	"github.com/IPampurin/UrlShortener/pkg/configuration"
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/IPampurin/UrlShortener/pkg/geoip"
+	"github.com/wb-go/wbf/logger"
+)
+
+// Pipeline хранит очередь переходов и пул воркеров, пишущих их в БД пачками
+type Pipeline struct {
+	link      db.LinkMethods
+	analytics db.AnalyticsMethods
+	geo       geoip.GeoIPMethods
+	log       logger.Logger
+
+	visitorsCache cache.CacheMethods // HyperLogLog уникальных посетителей и окно дедупликации в Redis
+	visitorsDB    db.VisitorMethods  // запасное хранилище уникальных посетителей
+	visitorSalt   []byte             // секрет для хэширования посетителей
+	dedupWindow   time.Duration      // окно, в котором повторные переходы посетителя не учитываются (0 - выключено)
+	dedup         *localDedup        // окно дедупликации в памяти, пока Redis недоступен
+
+	queue         chan *db.Analytics
+	batchSize     int
+	flushInterval time.Duration
+	drainTimeout  time.Duration
+
+	mu     sync.RWMutex // защищает closed и отправку в queue от гонки с закрытием канала
+	closed bool
+	wg     sync.WaitGroup
+
+	accepted atomic.Uint64
+	dropped  atomic.Uint64
+	written  atomic.Uint64
+	failed   atomic.Uint64
+	batches  atomic.Uint64
+}
+
+// InitIngest создаёт конвейер записи переходов и запускает его воркеры
+func InitIngest(ctx context.Context, storage db.Storage, redis cache.CacheMethods, geo *geoip.Enricher,
+	cfgIngest *configuration.ConfIngest, log logger.Logger) (*Pipeline, error) {
+
+	p := &Pipeline{
+		link:          storage, // db.Storage включает LinkMethods
+		analytics:     storage, // db.Storage включает AnalyticsMethods
+		geo:           geo,     // *geoip.Enricher реализует GeoIPMethods
+		visitorsDB:    storage, // db.Storage включает VisitorMethods
+		visitorsCache: redis,   // *cache.Cache или cache.Disabled
+		dedupWindow:   cfgIngest.DedupWindow,
+		dedup:         newLocalDedup(cfgIngest.DedupWindow),
+		log:           log,
+		queue:         make(chan *db.Analytics, max(cfgIngest.QueueSize, 1)),
+		batchSize:     max(cfgIngest.BatchSize, 1),
+		flushInterval: cfgIngest.FlushInterval,
+		drainTimeout:  cfgIngest.DrainTimeout,
+	}
+
+	if p.flushInterval <= 0 {
+		p.flushInterval = time.Second
+	}
+
+	salt, err := visitorSalt(ctx, storage, cfgIngest.VisitorSalt)
+	if err != nil {
+		return nil, err
+	}
+	p.visitorSalt = salt
+	if cfgIngest.VisitorSalt == "" {
+		log.Info("INGEST_VISITOR_SALT не задан, используется соль посетителей, сохранённая в БД")
+	}
+
+	workers := max(cfgIngest.Workers, 1)
+	for range workers {
+		p.wg.Add(1)
+		go p.worker()
+	}
+
+	log.Info("Конвейер записи переходов запущен.",
+		"workers", workers, "queue_size", cap(p.queue), "batch_size", p.batchSize)
+
+	return p, nil
+}
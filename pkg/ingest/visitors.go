@@ -0,0 +1,116 @@
+package ingest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/cache"
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// visitorSalt возвращает соль хэширования посетителей: заданную в конфигурации или общую, хранящуюся в БД.
+// Соль должна быть одной у всех экземпляров и после перезапусков, иначе один посетитель попадает
+// в HyperLogLog и окно дедупликации Redis под разными хэшами и считается несколько раз
+func visitorSalt(ctx context.Context, storage db.VisitorMethods, configured string) ([]byte, error) {
+
+	if configured != "" {
+		return []byte(configured), nil
+	}
+
+	salt, err := storage.VisitorSalt(ctx, rand.Text())
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(salt), nil
+}
+
+// visitorHash - необратимый идентификатор посетителя: HMAC от IP и User-Agent с секретной солью,
+// сами IP и User-Agent в подсчёте уникальных посетителей не хранятся
+func (p *Pipeline) visitorHash(click *db.Analytics) uint64 {
+
+	mac := hmac.New(sha256.New, p.visitorSalt)
+	mac.Write([]byte(click.IPAddress.String()))
+	mac.Write([]byte{0})
+	mac.Write([]byte(click.UserAgent))
+
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+// visitorHashes возвращает хэши посетителей пачки (для переходов ботов - 0)
+func (p *Pipeline) visitorHashes(batch []*db.Analytics) []uint64 {
+
+	hashes := make([]uint64, len(batch))
+	for i, click := range batch {
+		if !click.IsBot {
+			hashes[i] = p.visitorHash(click)
+		}
+	}
+
+	return hashes
+}
+
+// visitorsGroup - посетители одной ссылки за один день
+type visitorsGroup struct {
+	linkID int
+	day    time.Time
+	hashes []uint64
+}
+
+// countVisitors добавляет посетителей пачки в HyperLogLog в Redis,
+// а если Redis не подключён или не ответил - в таблицу link_visitors (переходы ботов не учитываются)
+func (p *Pipeline) countVisitors(ctx context.Context, batch []*db.Analytics, hashes []uint64) {
+
+	type groupKey struct {
+		linkID int
+		day    string
+	}
+
+	groups := make(map[groupKey]*visitorsGroup)
+	for i, click := range batch {
+		if click.IsBot {
+			continue
+		}
+
+		day := click.AccessedAt.UTC().Truncate(24 * time.Hour)
+		key := groupKey{click.LinkID, day.Format(time.DateOnly)}
+
+		g, ok := groups[key]
+		if !ok {
+			g = &visitorsGroup{linkID: click.LinkID, day: day}
+			groups[key] = g
+		}
+		g.hashes = append(g.hashes, hashes[i])
+	}
+
+	var fallback []db.Visit
+	for key, g := range groups {
+		hashes := make([]string, len(g.hashes))
+		for i, h := range g.hashes {
+			hashes[i] = strconv.FormatUint(h, 16)
+		}
+
+		err := p.visitorsCache.AddVisitors(ctx, g.linkID, key.day, hashes)
+		if err == nil {
+			continue
+		}
+		// о выключенном или недоступном кэше сообщает сам кэш
+		if !errors.Is(err, cache.ErrUnavailable) {
+			p.log.Warn("уникальные посетители записываются в БД: ошибка Redis", "error", err)
+		}
+
+		for _, h := range g.hashes {
+			fallback = append(fallback, db.Visit{LinkID: g.linkID, Day: g.day, Visitor: int64(h)})
+		}
+	}
+
+	if err := p.visitorsDB.AddVisitors(ctx, fallback); err != nil {
+		p.log.Error("ошибка записи уникальных посетителей", "error", err, "visitors", len(fallback))
+	}
+}
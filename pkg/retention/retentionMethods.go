@@ -0,0 +1,63 @@
+package retention
+
+import (
+	"context"
+	"time"
+)
+
+// run обслуживает секции сразу после старта и затем по таймеру
+func (k *Keeper) run(ctx context.Context) {
+
+	ticker := time.NewTicker(k.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		k.maintain(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// maintain создаёт секции на PartitionsAhead месяцев вперёд и убирает секции, целиком вышедшие за срок хранения
+func (k *Keeper) maintain(ctx context.Context, now time.Time) {
+
+	if err := k.storage.EnsurePartitions(ctx, now.AddDate(0, k.cfg.PartitionsAhead, 0)); err != nil {
+		k.log.Error("ошибка создания секций analytics", "error", err)
+	}
+
+	if k.cfg.Months <= 0 {
+		return
+	}
+
+	// хранятся текущий месяц и Months полных месяцев перед ним
+	now = now.UTC()
+	cutoff := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -k.cfg.Months, 0)
+
+	partitions, err := k.storage.AnalyticsPartitions(ctx)
+	if err != nil {
+		k.log.Error("ошибка получения секций analytics", "error", err)
+		return
+	}
+
+	for _, p := range partitions {
+		if !p.Month.Before(cutoff) {
+			continue
+		}
+
+		removed, err := k.storage.RemovePartition(ctx, p, k.cfg.Mode == ModeArchive)
+		if err != nil {
+			k.log.Error("ошибка удаления секции analytics", "partition", p.Name, "error", err)
+			continue
+		}
+		if !removed {
+			k.log.Warn("секция analytics не удалена: переходы ещё не свёрнуты в сводки", "partition", p.Name)
+			continue
+		}
+
+		k.log.Info("секция analytics вышла за срок хранения", "partition", p.Name, "mode", k.cfg.Mode)
+	}
+}
@@ -0,0 +1,50 @@
+package retention
+
+import (
+	"context"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/configuration"
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/wb-go/wbf/logger"
+)
+
+// способы избавления от устаревших секций analytics
+const (
+	ModeDrop    = "drop"    // секция удаляется
+	ModeArchive = "archive" // секция отсоединяется и переносится в схему analytics_archive
+)
+
+// Keeper в фоне создаёт будущие секции analytics и убирает секции старше срока хранения
+type Keeper struct {
+	storage db.PartitionMethods
+	cfg     *configuration.ConfRetention
+
+	log logger.Logger
+}
+
+// InitRetention запускает обслуживание секций; при нулевом RETENTION_MONTHS сырые переходы хранятся бессрочно
+func InitRetention(ctx context.Context, storage db.PartitionMethods, cfgRetention *configuration.ConfRetention, log logger.Logger) *Keeper {
+
+	k := &Keeper{
+		storage: storage,
+		cfg:     cfgRetention,
+		log:     log,
+	}
+
+	if k.cfg.Mode != ModeDrop && k.cfg.Mode != ModeArchive {
+		log.Warn("неизвестный режим хранения, используется drop", "mode", k.cfg.Mode)
+		k.cfg.Mode = ModeDrop
+	}
+
+	if k.cfg.Interval <= 0 {
+		k.cfg.Interval = time.Hour
+	}
+
+	go k.run(ctx)
+
+	log.Info("Обслуживание секций analytics запущено.", "retention_months", k.cfg.Months, "mode", k.cfg.Mode,
+		"partitions_ahead", k.cfg.PartitionsAhead)
+
+	return k
+}
@@ -0,0 +1,55 @@
+package rollup
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// run сворачивает накопившиеся дни сразу после старта и затем по таймеру
+func (r *Roller) run(ctx context.Context) {
+
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.catchUp(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// catchUp сворачивает по одному дню, пока есть закончившиеся несвёрнутые дни или дни с поздно записанными переходами
+// (день считается закончившимся спустя Delay после полуночи UTC, чтобы очередь переходов успела записаться)
+func (r *Roller) catchUp(ctx context.Context) {
+
+	rolled := 0
+	var last time.Time
+
+	for ctx.Err() == nil {
+		day, ok, err := r.storage.RollupNextDay(ctx, time.Now().Add(-r.cfg.Delay))
+		if errors.Is(err, db.ErrRollupDaySkipped) {
+			r.log.Error("ошибка сворачивания дня аналитики, день отложен", "day", day.Format(time.DateOnly), "error", err)
+			continue
+		}
+		if err != nil {
+			r.log.Error("ошибка сворачивания аналитики", "error", err)
+			break
+		}
+		if !ok {
+			break
+		}
+		rolled++
+		last = day
+	}
+
+	if rolled > 0 {
+		r.log.Info("аналитика свёрнута в дневные сводки", "days", rolled, "last_day", last.Format(time.DateOnly))
+	}
+}
@@ -0,0 +1,88 @@
+package rollup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/configuration"
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/wb-go/wbf/logger"
+)
+
+// rollupResult - ответ fakeStorage на очередной вызов RollupNextDay
+type rollupResult struct {
+	day time.Time
+	ok  bool
+	err error
+}
+
+// fakeStorage отдаёт заранее заданные ответы RollupNextDay и считает вызовы
+type fakeStorage struct {
+	results []rollupResult
+	calls   int
+}
+
+func (f *fakeStorage) RolledUntil(context.Context) (time.Time, error) {
+
+	return time.Time{}, nil
+}
+
+func (f *fakeStorage) RollupNextDay(context.Context, time.Time) (time.Time, bool, error) {
+
+	f.calls++
+	if len(f.results) == 0 {
+		return time.Time{}, false, nil
+	}
+
+	r := f.results[0]
+	f.results = f.results[1:]
+
+	return r.day, r.ok, r.err
+}
+
+func newTestRoller(t *testing.T, storage db.RollupMethods) *Roller {
+
+	t.Helper()
+
+	log, err := logger.InitLogger(logger.SlogEngine, "UrlShortener", "test", logger.WithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("ошибка создания логгера: %v", err)
+	}
+
+	return &Roller{storage: storage, cfg: &configuration.ConfRollup{Delay: 10 * time.Minute}, log: log}
+}
+
+func TestCatchUpSkipsFailedDay(t *testing.T) {
+
+	day := time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+	storage := &fakeStorage{results: []rollupResult{
+		{day, true, nil},
+		{day.AddDate(0, 0, 1), true, fmt.Errorf("%w: ошибка сворачивания измерений", db.ErrRollupDaySkipped)},
+		{day.AddDate(0, 0, 2), true, nil},
+	}}
+
+	newTestRoller(t, storage).catchUp(context.Background())
+
+	// три дня и последний вызов, на котором сворачивать уже нечего
+	if storage.calls != 4 {
+		t.Errorf("RollupNextDay вызван %d раз, ожидалось 4: отложенный день остановил сворачивание", storage.calls)
+	}
+}
+
+func TestCatchUpStopsOnStorageError(t *testing.T) {
+
+	day := time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+	storage := &fakeStorage{results: []rollupResult{
+		{time.Time{}, false, errors.New("соединение с БД потеряно")},
+		{day, true, nil},
+	}}
+
+	newTestRoller(t, storage).catchUp(context.Background())
+
+	if storage.calls != 1 {
+		t.Errorf("RollupNextDay вызван %d раз, ожидался 1: ошибка БД должна прерывать проход", storage.calls)
+	}
+}
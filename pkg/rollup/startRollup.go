@@ -0,0 +1,39 @@
+package rollup
+
+import (
+	"context"
+
+	"github.com/IPampurin/UrlShortener/pkg/configuration"
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/wb-go/wbf/logger"
+)
+
+// Roller в фоне сворачивает закончившиеся дни аналитики в дневные сводки
+type Roller struct {
+	storage db.RollupMethods
+	cfg     *configuration.ConfRollup
+
+	log logger.Logger
+}
+
+// InitRollup запускает фоновое сворачивание; при нулевом интервале сводки не обновляются,
+// и агрегаты аналитики считаются по сырым переходам
+func InitRollup(ctx context.Context, storage db.RollupMethods, cfgRollup *configuration.ConfRollup, log logger.Logger) *Roller {
+
+	r := &Roller{
+		storage: storage,
+		cfg:     cfgRollup,
+		log:     log,
+	}
+
+	if cfgRollup.Interval <= 0 {
+		log.Info("Сворачивание аналитики в дневные сводки отключено.")
+		return r
+	}
+
+	go r.run(ctx)
+
+	log.Info("Сворачивание аналитики запущено.", "interval", cfgRollup.Interval, "delay", cfgRollup.Delay)
+
+	return r
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/IPampurin/UrlShortener/pkg/api"
+	"github.com/IPampurin/UrlShortener/pkg/service"
+	"github.com/gin-gonic/gin"
+	"github.com/wb-go/wbf/logger"
+)
+
+// authenticate проверяет API-ключ (заголовок X-API-Key или Authorization: Bearer)
+// и кладёт вызывающего в контекст запроса; при отключённой аутентификации пропускает всех
+func authenticate(svc service.ServiceMethods, log logger.Logger, enabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if !enabled {
+			c.Next()
+			return
+		}
+
+		caller, err := svc.Authenticate(c.Request.Context(), log, apiKeyFromRequest(c))
+		if err != nil {
+			api.RespondError(c, log, err)
+			return
+		}
+
+		c.Request = c.Request.WithContext(service.WithCaller(c.Request.Context(), caller))
+		c.Next()
+	}
+}
+
+// requireAdmin пропускает только администраторов (вызывается после authenticate)
+func requireAdmin(log logger.Logger, enabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if !enabled {
+			c.Next()
+			return
+		}
+
+		caller := service.CallerFromContext(c.Request.Context())
+		if caller == nil || !caller.IsAdmin {
+			api.RespondError(c, log, service.ErrAdminRequired)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// apiKeyFromRequest достаёт API-ключ из заголовков запроса
+func apiKeyFromRequest(c *gin.Context) string {
+
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+
+	return ""
+}
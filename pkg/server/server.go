@@ -14,7 +14,7 @@ import (
 	"github.com/wb-go/wbf/logger"
 )
 
-func Run(ctx context.Context, cfgServer *configuration.ConfServer, service *service.Service, log logger.Logger) error {
+func Run(ctx context.Context, cfgServer *configuration.ConfServer, cfgAuth *configuration.ConfAuth, service *service.Service, log logger.Logger) error {
 
 	// создаём движок Gin через обёртку ginext
 	engine := ginext.New(cfgServer.GinMode)
@@ -31,13 +31,33 @@ func Run(ctx context.Context, cfgServer *configuration.ConfServer, service *serv
 		log.LogRequest(c.Request.Context(), c.Request.Method, c.Request.URL.Path, c.Writer.Status(), duration)
 	})
 
-	// регистрируем эндпоинты
-	engine.POST("/shorten", api.CreateShortLink(service, log))               // создание новой сокращённой ссылки
-	engine.GET("/s/:short_url", api.Redirect(service, log))                  // переход по короткой ссылке
-	engine.GET("/analytics/:short_url", api.GetAnalytics(service, log))      // получение аналитики (число и время переходов, User-Agent)
-	engine.GET("/links", api.GetLinks(service, log))                         // список последних ссылок для UI
-	engine.GET("/links/search/original", api.SearchByOriginal(service, log)) // поиск по OriginalURL
-	engine.GET("/links/search/short", api.SearchByShort(service, log))       // поиск по ShortURL
+	// публичные эндпоинты
+	engine.GET("/s/:short_url", api.Redirect(service, log))  // переход по короткой ссылке
+	engine.HEAD("/s/:short_url", api.Redirect(service, log)) // проверка ссылки (так делают сервисы предпросмотра)
+	engine.GET("/health", api.GetHealth(service, log))       // состояние сервиса и кэша
+
+	// эндпоинты, требующие API-ключ
+	private := engine.Group("/", authenticate(service, log, cfgAuth.Enabled))
+	private.POST("/shorten", api.CreateShortLink(service, log))                     // создание новой сокращённой ссылки
+	private.GET("/analytics/:short_url", api.GetAnalytics(service, log))            // получение аналитики (число и время переходов, User-Agent)
+	private.GET("/analytics/:short_url/clicks", api.GetClickLog(service, log))      // журнал переходов постранично
+	private.GET("/analytics/:short_url/export", api.ExportClicks(service, log))     // выгрузка переходов по ссылке
+	private.GET("/analytics/:short_url/:dimension", api.GetBreakdown(service, log)) // переходы по браузерам, ОС, устройствам
+	private.GET("/links", api.GetLinks(service, log))                               // список последних ссылок для UI
+	private.GET("/links/search/original", api.SearchByOriginal(service, log))       // поиск по OriginalURL
+	private.GET("/links/search/short", api.SearchByShort(service, log))             // поиск по ShortURL
+	private.PATCH("/links/:short_url", api.UpdateLink(service, log))                // изменение адреса и ограничений ссылки
+	private.DELETE("/links/:short_url", api.DeleteLink(service, log))               // перемещение ссылки в корзину
+	private.GET("/links/export", api.ExportAllClicks(service, log))                 // выгрузка переходов по всем ссылкам
+	private.GET("/links/trash", api.GetTrash(service, log))                         // содержимое корзины
+	private.POST("/links/:short_url/restore", api.RestoreLink(service, log))        // восстановление ссылки из корзины
+
+	// эндпоинты администратора
+	admin := private.Group("/admin", requireAdmin(log, cfgAuth.Enabled))
+	admin.POST("/users", api.CreateUser(service, log))      // создание пользователя и выпуск API-ключа
+	admin.GET("/ingest", api.GetIngestStats(service, log))  // счётчики конвейера записи переходов
+	admin.GET("/lookups", api.GetLookupStats(service, log)) // счётчики поиска ссылок: кэш, негативные записи, БД
+	admin.POST("/cache/warm", api.WarmCache(service, log))  // прогрев кэша популярными ссылками
 
 	// раздаём статические файлы из папки ./web
 	engine.Static("/static", "./web")
@@ -73,12 +93,19 @@ func Run(ctx context.Context, cfgServer *configuration.ConfServer, service *serv
 		// даём время на завершение текущих запросов (например, 5 секунд)
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer shutdownCancel()
-		if err := srv.Shutdown(shutdownCtx); err != nil {
-			log.Error("ошибка при graceful shutdown", "error", err)
+		shutdownErr := srv.Shutdown(shutdownCtx)
+		if shutdownErr != nil {
+			log.Error("ошибка при graceful shutdown", "error", shutdownErr)
+		} else {
+			log.Info("сервер корректно остановлен")
+		}
+
+		// новых переходов больше не будет, дописываем очередь в БД в любом случае
+		if err := service.Close(context.Background()); err != nil {
+			log.Error("ошибка при остановке сервиса", "error", err)
 			return err
 		}
-		log.Info("сервер корректно остановлен")
-		return nil
+		return shutdownErr
 
 	case err := <-errCh:
 		log.Error("сервер завершился с ошибкой", "error", err)
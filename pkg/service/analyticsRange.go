@@ -0,0 +1,189 @@
+package service
+
+import (
+	"encoding/base64"
+	"strconv"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+const (
+	// defaultAnalyticsPeriod - период аналитики, если from не передан
+	defaultAnalyticsPeriod = 30 * 24 * time.Hour
+
+	// maxTimelineBuckets - предел числа шагов временной шкалы в одном ответе
+	maxTimelineBuckets = 5000
+
+	// recentClicksLimit - сколько последних переходов встраивается в ответ аналитики
+	recentClicksLimit = 10
+
+	// defaultClickLogLimit и maxClickLogLimit - размер страницы журнала переходов по умолчанию и предельный
+	defaultClickLogLimit = 50
+	maxClickLogLimit     = 500
+
+	// dateLayout - формат даты без времени (полночь в часовом поясе запроса)
+	dateLayout = "2006-01-02"
+)
+
+// granularitySteps - минимальная длительность шага (для оценки числа шагов до запроса к БД)
+var granularitySteps = map[string]time.Duration{
+	db.GranularityMinute: time.Minute,
+	db.GranularityHour:   time.Hour,
+	db.GranularityDay:    24 * time.Hour,
+	db.GranularityWeek:   7 * 24 * time.Hour,
+	db.GranularityMonth:  28 * 24 * time.Hour,
+}
+
+// analyticsRange - проверенные параметры AnalyticsQuery
+type analyticsRange struct {
+	from        time.Time
+	to          time.Time
+	granularity string
+	tz          string
+	loc         *time.Location
+}
+
+// resolveRange проверяет параметры запроса аналитики и подставляет значения по умолчанию:
+// to - сейчас, from - за 30 дней до to, granularity - day, tz - UTC
+func resolveRange(q AnalyticsQuery, now time.Time) (*analyticsRange, error) {
+
+	r := &analyticsRange{
+		granularity: q.Granularity,
+		tz:          q.TZ,
+	}
+
+	if r.granularity == "" {
+		r.granularity = db.GranularityDay
+	}
+	step, ok := granularitySteps[r.granularity]
+	if !ok {
+		return nil, ErrInvalidGranularity
+	}
+
+	if r.tz == "" {
+		r.tz = "UTC"
+	}
+	// Local зависит от сервера и неизвестен PostgreSQL
+	loc, err := time.LoadLocation(r.tz)
+	if err != nil || r.tz == "Local" {
+		return nil, ErrInvalidTimezone
+	}
+	r.loc = loc
+
+	r.to = now
+	if q.To != "" {
+		if r.to, err = parseRangeBound(q.To, loc, true); err != nil {
+			return nil, ErrInvalidRange
+		}
+	}
+
+	r.from = r.to.Add(-defaultAnalyticsPeriod)
+	if q.From != "" {
+		if r.from, err = parseRangeBound(q.From, loc, false); err != nil {
+			return nil, ErrInvalidRange
+		}
+	}
+
+	if !r.from.Before(r.to) {
+		return nil, ErrInvalidRange
+	}
+
+	if r.to.Sub(r.from)/step > maxTimelineBuckets {
+		return nil, ErrRangeTooLarge
+	}
+
+	return r, nil
+}
+
+// parseRangeBound разбирает границу периода в формате RFC 3339 или YYYY-MM-DD;
+// дата без времени в to включает весь день (граница сдвигается на следующую полночь)
+func parseRangeBound(value string, loc *time.Location, isEnd bool) (time.Time, error) {
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(dateLayout, value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if isEnd {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
+
+// fitsBuckets сообщает, что период можно разбить на шаги granularity, не превысив предел
+func (r *analyticsRange) fitsBuckets(granularity string) bool {
+
+	return r.to.Sub(r.from)/granularitySteps[granularity] <= maxTimelineBuckets
+}
+
+// clickFilter переводит параметры запроса журнала в фильтр БД
+func clickFilter(q ClickFilterQuery) (db.ClickFilter, error) {
+
+	filter := db.ClickFilter{
+		Referer: q.Referer,
+		Device:  q.Device,
+		IsBot:   q.Bot,
+	}
+
+	loc := time.UTC
+	if q.TZ != "" {
+		var err error
+		if loc, err = time.LoadLocation(q.TZ); err != nil || q.TZ == "Local" {
+			return filter, ErrInvalidTimezone
+		}
+	}
+
+	if q.From != "" {
+		from, err := parseRangeBound(q.From, loc, false)
+		if err != nil {
+			return filter, ErrInvalidRange
+		}
+		filter.From = &from
+	}
+
+	if q.To != "" {
+		to, err := parseRangeBound(q.To, loc, true)
+		if err != nil {
+			return filter, ErrInvalidRange
+		}
+		filter.To = &to
+	}
+
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return filter, ErrInvalidRange
+	}
+
+	return filter, nil
+}
+
+// encodeCursor упаковывает id последней отданной записи в непрозрачный курсор
+func encodeCursor(id int64) string {
+
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// decodeCursor распаковывает курсор (пустой курсор - первая страница)
+func decodeCursor(cursor string) (int64, error) {
+
+	if cursor == "" {
+		return 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return id, nil
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/wb-go/wbf/logger"
+)
+
+// apiKeyPrefix помечает ключи сервиса, чтобы их было легко найти в логах и конфигурации
+const apiKeyPrefix = "us_"
+
+// adminName - учётная запись администратора, ключ которой задаётся в конфигурации
+// (все её ключи выпускаются только из AUTH_ADMIN_KEY)
+const adminName = "admin"
+
+// callerKey - ключ контекста, под которым хранится аутентифицированный вызывающий
+type callerKey struct{}
+
+// WithCaller возвращает контекст с аутентифицированным вызывающим
+func WithCaller(ctx context.Context, caller *Caller) context.Context {
+
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext возвращает вызывающего из контекста (nil, если аутентификация отключена)
+func CallerFromContext(ctx context.Context) *Caller {
+
+	caller, _ := ctx.Value(callerKey{}).(*Caller)
+
+	return caller
+}
+
+// Authenticate находит пользователя по API-ключу
+func (s *Service) Authenticate(ctx context.Context, log logger.Logger, apiKey string) (*Caller, error) {
+
+	if apiKey == "" {
+		return nil, ErrAPIKeyRequired
+	}
+
+	user, err := s.users.GetUserByKeyHash(ctx, hashAPIKey(apiKey))
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка проверки API-ключа", "error", err)
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	return &Caller{UserID: user.ID, Name: user.Name, IsAdmin: user.IsAdmin}, nil
+}
+
+// CreateUser создаёт пользователя и выпускает для него API-ключ
+// (ключ возвращается только один раз, в БД хранится лишь его хэш)
+func (s *Service) CreateUser(ctx context.Context, log logger.Logger, name string, isAdmin bool) (*ResponseUser, error) {
+
+	user, err := s.users.CreateUser(ctx, name, isAdmin)
+	if errors.Is(err, db.ErrUserExists) {
+		return nil, ErrUserNameTaken
+	}
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка создания пользователя", "error", err, "name", name)
+		return nil, err
+	}
+
+	apiKey := newAPIKey()
+	if err := s.users.AddAPIKey(ctx, user.ID, hashAPIKey(apiKey)); err != nil {
+		log.Ctx(ctx).Error("ошибка сохранения API-ключа", "error", err, "user_id", user.ID)
+		return nil, err
+	}
+
+	log.Ctx(ctx).Info("пользователю выпущен API-ключ", "user_id", user.ID, "name", user.Name, "is_admin", user.IsAdmin)
+
+	return &ResponseUser{
+		ID:        user.ID,
+		Name:      user.Name,
+		IsAdmin:   user.IsAdmin,
+		CreatedAt: user.CreatedAt,
+		APIKey:    apiKey,
+	}, nil
+}
+
+// BootstrapAdmin регистрирует ключ администратора из конфигурации, чтобы на пустой базе было кому выпускать ключи;
+// при смене AUTH_ADMIN_KEY прежние ключи администратора отзываются
+func (s *Service) BootstrapAdmin(ctx context.Context, log logger.Logger, adminKey string) error {
+
+	if adminKey == "" {
+		return nil
+	}
+
+	user, err := s.users.GetUserByName(ctx, adminName)
+	if err != nil {
+		return err
+	}
+
+	if user == nil {
+		user, err = s.users.CreateUser(ctx, adminName, true)
+		// администратора одновременно с нами создал другой экземпляр сервиса
+		if errors.Is(err, db.ErrUserExists) {
+			user, err = s.users.GetUserByName(ctx, adminName)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// ключ администратора нельзя выдать обычному пользователю, занявшему имя admin
+	if user == nil || !user.IsAdmin {
+		return fmt.Errorf("пользователь %q не является администратором: ключ из AUTH_ADMIN_KEY не зарегистрирован", adminName)
+	}
+
+	revoked, err := s.users.ReplaceAPIKeys(ctx, user.ID, hashAPIKey(adminKey))
+	if err != nil {
+		return err
+	}
+
+	log.Info("ключ администратора из конфигурации зарегистрирован", "user_id", user.ID, "revoked", revoked)
+
+	return nil
+}
+
+// ownerFilter возвращает владельца, которым ограничиваются выборки списков
+// (nil - без ограничения: аутентификация отключена или вызывающий администратор)
+func ownerFilter(ctx context.Context) *int {
+
+	caller := CallerFromContext(ctx)
+	if caller == nil || caller.IsAdmin {
+		return nil
+	}
+
+	return &caller.UserID
+}
+
+// creatorID возвращает владельца для новых ссылок (nil, если аутентификация отключена)
+func creatorID(ctx context.Context) *int {
+
+	caller := CallerFromContext(ctx)
+	if caller == nil {
+		return nil
+	}
+
+	return &caller.UserID
+}
+
+// checkAccess проверяет, что вызывающий может управлять ссылкой и видеть её аналитику
+func checkAccess(ctx context.Context, link *db.Link) error {
+
+	caller := CallerFromContext(ctx)
+	if caller == nil || caller.IsAdmin {
+		return nil
+	}
+
+	if link.OwnerID == nil || *link.OwnerID != caller.UserID {
+		return ErrLinkForbidden
+	}
+
+	return nil
+}
+
+// newAPIKey генерирует новый API-ключ
+func newAPIKey() string {
+
+	return apiKeyPrefix + strings.ToLower(rand.Text())
+}
+
+// hashAPIKey возвращает хэш ключа для хранения в БД
+// (ключи случайные и длинные, поэтому медленный хэш вроде bcrypt не нужен, а поиск по индексу остаётся возможным)
+func hashAPIKey(apiKey string) string {
+
+	sum := sha256.Sum256([]byte(apiKey))
+
+	return hex.EncodeToString(sum[:])
+}
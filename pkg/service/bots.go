@@ -0,0 +1,73 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/IPampurin/UrlShortener/pkg/configuration"
+)
+
+// botSignatures - фрагменты User-Agent ботов, краулеров и сервисов предпросмотра ссылок
+// (сравнение без учёта регистра, по вхождению подстроки); у мессенджеров и соцсетей берутся
+// токены их краулеров, а не названия приложений: встроенные браузеры приложений (Telegram, Viber,
+// LinkedIn, Pinterest, Snapchat, Яндекс) добавляют название в User-Agent, но открывают ссылки люди
+var botSignatures = []string{
+	// общие признаки
+	"bot", "crawler", "spider", "slurp", "preview", "fetcher", "scraper", "headlesschrome", "lighthouse",
+
+	// краулеры мессенджеров и социальных сетей
+	"facebookexternalhit", "facebookcatalog", "meta-externalagent", "whatsapp/", "telegrambot",
+	"slackbot", "slack-imgproxy", "discordbot", "skypeuripreview", "vkshare", "linkedinbot", "pinterestbot",
+	"twitterbot",
+
+	// поисковые системы и агрегаторы
+	"yandexbot", "yandeximages", "yandexmetrika", "yandexdirect", "yandexwebmaster", "yandexfavicons",
+	"mediapartners-google", "google-inspectiontool", "embedly", "iframely", "outbrain", "flipboard",
+
+	// HTTP-клиенты и утилиты
+	"curl/", "wget/", "python-requests", "python-urllib", "aiohttp", "go-http-client", "okhttp",
+	"java/", "apache-httpclient", "libwww-perl", "node-fetch", "axios/",
+}
+
+// botClassifier определяет, совершён ли переход ботом
+type botClassifier struct {
+	signatures []string
+}
+
+// newBotClassifier собирает встроенные сигнатуры и дополнительные шаблоны из конфигурации
+func newBotClassifier(cfg *configuration.ConfBots) *botClassifier {
+
+	signatures := make([]string, 0, len(botSignatures)+len(cfg.ExtraPatterns))
+	signatures = append(signatures, botSignatures...)
+
+	for _, pattern := range cfg.ExtraPatterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern != "" {
+			signatures = append(signatures, pattern)
+		}
+	}
+
+	return &botClassifier{signatures: signatures}
+}
+
+// IsBot возвращает true для HEAD-запросов (так проверяют ссылки сервисы предпросмотра),
+// запросов без User-Agent и User-Agent, содержащих одну из сигнатур
+func (b *botClassifier) IsBot(method, userAgent string) bool {
+
+	if method == http.MethodHead {
+		return true
+	}
+
+	userAgent = strings.ToLower(strings.TrimSpace(userAgent))
+	if userAgent == "" {
+		return true
+	}
+
+	for _, signature := range b.signatures {
+		if strings.Contains(userAgent, signature) {
+			return true
+		}
+	}
+
+	return false
+}
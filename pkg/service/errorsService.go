@@ -0,0 +1,107 @@
+package service
+
+import "errors"
+
+// категории ошибок сервиса (по ним слой API выбирает HTTP-статус)
+var (
+	ErrUnauthorized = errors.New("требуется аутентификация")  // вызывающий не представился или ключ недействителен
+	ErrConflict     = errors.New("конфликт")                  // ресурс уже существует или занят
+	ErrNotFound     = errors.New("не найдено")                // ресурса нет
+	ErrExpired      = errors.New("срок действия истёк")       // ресурс был, но больше не действует
+	ErrForbidden    = errors.New("доступ запрещён")           // у вызывающего нет прав на ресурс
+	ErrValidation   = errors.New("некорректные данные")       // входные данные не прошли проверку
+	ErrUnavailable  = errors.New("зависимость недоступна")    // операция требует выключенной или недоступной зависимости
+	ErrInternal     = errors.New("внутренняя ошибка сервиса") // сбой, о котором клиенту не сообщаются подробности
+)
+
+// Error - ошибка сервиса с категорией и стабильным машиночитаемым кодом
+type Error struct {
+	Kind    error  // одна из категорий ErrConflict, ErrNotFound, ...
+	Code    string // код для клиентов API, например "short_url_taken"
+	Message string // описание для логов
+}
+
+// Error возвращает описание ошибки
+func (e *Error) Error() string {
+
+	return e.Message
+}
+
+// Unwrap позволяет проверять категорию через errors.Is(err, ErrNotFound)
+func (e *Error) Unwrap() error {
+
+	return e.Kind
+}
+
+// конкретные ошибки сервиса
+var (
+	// ErrShortURLTaken - запрошенная короткая ссылка уже занята
+	ErrShortURLTaken = &Error{Kind: ErrConflict, Code: "short_url_taken", Message: "короткая ссылка уже занята"}
+
+	// ErrUserNameTaken - пользователь с таким именем уже есть
+	ErrUserNameTaken = &Error{Kind: ErrConflict, Code: "user_name_taken", Message: "имя пользователя уже занято"}
+
+	// ErrLinkNotFound - ссылка не найдена (или находится в корзине)
+	ErrLinkNotFound = &Error{Kind: ErrNotFound, Code: "link_not_found", Message: "ссылка не найдена"}
+
+	// ErrTrashLinkNotFound - ссылки нет в корзине
+	ErrTrashLinkNotFound = &Error{Kind: ErrNotFound, Code: "trash_link_not_found", Message: "ссылка в корзине не найдена"}
+
+	// ErrLinkForbidden - ссылка принадлежит другому пользователю
+	ErrLinkForbidden = &Error{Kind: ErrForbidden, Code: "link_forbidden", Message: "ссылка принадлежит другому пользователю"}
+
+	// ErrAdminRequired - операция доступна только администратору
+	ErrAdminRequired = &Error{Kind: ErrForbidden, Code: "admin_required", Message: "требуются права администратора"}
+
+	// ErrAPIKeyRequired - запрос без API-ключа
+	ErrAPIKeyRequired = &Error{Kind: ErrUnauthorized, Code: "api_key_required", Message: "не передан API-ключ"}
+
+	// ErrInvalidAPIKey - API-ключ неизвестен или отозван
+	ErrInvalidAPIKey = &Error{Kind: ErrUnauthorized, Code: "invalid_api_key", Message: "недействительный API-ключ"}
+
+	// ErrLinkExpired - срок действия ссылки истёк или исчерпан бюджет переходов
+	ErrLinkExpired = &Error{Kind: ErrExpired, Code: "link_expired", Message: "срок действия ссылки истёк"}
+
+	// ErrExpiresInPast - срок действия ссылки задан в прошлом
+	ErrExpiresInPast = &Error{Kind: ErrValidation, Code: "expires_at_in_past", Message: "expires_at должен быть в будущем"}
+
+	// ErrInvalidRedirectType - неизвестный способ перенаправления
+	ErrInvalidRedirectType = &Error{Kind: ErrValidation, Code: "invalid_redirect_type", Message: "неизвестный способ перенаправления"}
+
+	// ErrUnknownDimension - запрошена группировка по неизвестному измерению
+	ErrUnknownDimension = &Error{Kind: ErrValidation, Code: "unknown_dimension", Message: "неизвестное измерение аналитики"}
+
+	// ErrInvalidRange - границы периода аналитики не разобраны или from не раньше to
+	ErrInvalidRange = &Error{Kind: ErrValidation, Code: "invalid_range", Message: "неверный период: from и to в формате RFC 3339 или YYYY-MM-DD, from раньше to"}
+
+	// ErrInvalidGranularity - неизвестный шаг временной шкалы
+	ErrInvalidGranularity = &Error{Kind: ErrValidation, Code: "invalid_granularity", Message: "шаг должен быть minute, hour, day, week или month"}
+
+	// ErrInvalidTimezone - неизвестный часовой пояс
+	ErrInvalidTimezone = &Error{Kind: ErrValidation, Code: "invalid_timezone", Message: "неизвестный часовой пояс"}
+
+	// ErrRangeTooLarge - период слишком велик для выбранного шага
+	ErrRangeTooLarge = &Error{Kind: ErrValidation, Code: "range_too_large", Message: "слишком много шагов: сократите период или увеличьте шаг"}
+
+	// ErrInvalidCursor - курсор журнала переходов повреждён
+	ErrInvalidCursor = &Error{Kind: ErrValidation, Code: "invalid_cursor", Message: "неверный курсор"}
+
+	// ErrInvalidExportFormat - неизвестный формат выгрузки
+	ErrInvalidExportFormat = &Error{Kind: ErrValidation, Code: "invalid_export_format", Message: "формат выгрузки должен быть csv, ndjson или parquet"}
+
+	// ErrNothingToUpdate - в запросе на изменение нет ни одного поля
+	ErrNothingToUpdate = &Error{Kind: ErrValidation, Code: "nothing_to_update", Message: "нет полей для изменения"}
+
+	// ErrShortURLExhausted - за отведённое число попыток не удалось подобрать свободную короткую ссылку
+	// (запрос можно повторить: длина генерируемых ссылок растёт с долей коллизий)
+	ErrShortURLExhausted = &Error{Kind: ErrUnavailable, Code: "short_url_exhausted", Message: "не удалось подобрать свободную короткую ссылку"}
+
+	// ErrShortURLLimit - длина кодов стратегии генерации достигла предела, а свободный код не нашёлся
+	ErrShortURLLimit = &Error{Kind: ErrUnavailable, Code: "short_url_limit", Message: "короткие ссылки достигли предельной длины, свободных больше нет"}
+
+	// ErrCacheUnavailable - кэш выключен или Redis недоступен
+	ErrCacheUnavailable = &Error{Kind: ErrUnavailable, Code: "cache_unavailable", Message: "кэш выключен или Redis недоступен"}
+
+	// ErrClickDropped - переход не принят в очередь записи (очередь переполнена или конвейер остановлен)
+	ErrClickDropped = &Error{Kind: ErrUnavailable, Code: "click_dropped", Message: "переход не записан: очередь переполнена"}
+)
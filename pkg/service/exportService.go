@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/IPampurin/UrlShortener/pkg/export"
+	"github.com/wb-go/wbf/logger"
+)
+
+// Export - подготовленная выгрузка: права и параметры уже проверены, строки читаются из БД в Stream
+type Export struct {
+	ContentType string // MIME-тип формата
+	FileName    string // имя файла для Content-Disposition
+
+	format  string
+	linkID  *int
+	ownerID *int
+	filter  db.ClickFilter
+	svc     *Service
+	log     logger.Logger
+}
+
+// ExportClicks готовит выгрузку переходов по ссылке shortURL
+func (s *Service) ExportClicks(ctx context.Context, log logger.Logger, shortURL string, q ExportQuery) (*Export, error) {
+
+	exp, err := s.newExport(log, q)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := s.ownedLink(ctx, shortURL, false)
+	if err != nil {
+		log.Ctx(ctx).Info("выгрузка переходов недоступна", "short_url", shortURL, "error", err)
+		return nil, err
+	}
+
+	exp.linkID = &link.ID
+	exp.FileName = fmt.Sprintf("clicks-%s-%s.%s", link.ShortURL, time.Now().Format(dateLayout), exp.format)
+
+	return exp, nil
+}
+
+// ExportAllClicks готовит выгрузку переходов по всем ссылкам вызывающего (администратор получает все ссылки)
+func (s *Service) ExportAllClicks(ctx context.Context, log logger.Logger, q ExportQuery) (*Export, error) {
+
+	exp, err := s.newExport(log, q)
+	if err != nil {
+		return nil, err
+	}
+
+	exp.ownerID = ownerFilter(ctx)
+	exp.FileName = fmt.Sprintf("clicks-%s.%s", time.Now().Format(dateLayout), exp.format)
+
+	return exp, nil
+}
+
+// newExport проверяет формат и фильтры выгрузки
+func (s *Service) newExport(log logger.Logger, q ExportQuery) (*Export, error) {
+
+	format := q.Format
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if !export.Supported(format) {
+		return nil, ErrInvalidExportFormat
+	}
+
+	filter, err := clickFilter(q.ClickFilterQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Export{
+		ContentType: export.ContentType(format),
+		format:      format,
+		filter:      filter,
+		svc:         s,
+		log:         log,
+	}, nil
+}
+
+// Stream пишет выгрузку в w, читая переходы из БД порциями
+// (ошибка посреди выгрузки означает, что клиент получил неполный файл)
+func (e *Export) Stream(ctx context.Context, w io.Writer) error {
+
+	enc, err := export.NewEncoder(e.format, w)
+	if err != nil {
+		return err
+	}
+
+	rows := 0
+	err = e.svc.analytics.StreamClicks(ctx, e.linkID, e.ownerID, e.filter, func(shortURL string, a *db.Analytics) error {
+		rows++
+		return enc.Write(toExportRow(shortURL, a))
+	})
+	if err != nil {
+		e.log.Ctx(ctx).Error("выгрузка переходов прервана", "file", e.FileName, "rows", rows, "error", err)
+		return err
+	}
+
+	if err = enc.Close(); err != nil {
+		e.log.Ctx(ctx).Error("ошибка завершения выгрузки переходов", "file", e.FileName, "error", err)
+		return err
+	}
+
+	e.log.Ctx(ctx).Info("переходы выгружены", "file", e.FileName, "rows", rows)
+
+	return nil
+}
+
+// toExportRow преобразует запись о переходе в строку выгрузки
+func toExportRow(shortURL string, a *db.Analytics) *export.Row {
+
+	ip := ""
+	if a.IPAddress != nil {
+		ip = a.IPAddress.String()
+	}
+
+	return &export.Row{
+		ShortURL:       shortURL,
+		AccessedAt:     a.AccessedAt,
+		UserAgent:      a.UserAgent,
+		IPAddress:      ip,
+		Referer:        a.Referer,
+		IsBot:          a.IsBot,
+		IsRepeat:       a.IsRepeat,
+		Browser:        a.Browser,
+		BrowserVersion: a.BrowserVersion,
+		OS:             a.OS,
+		OSVersion:      a.OSVersion,
+		Device:         a.Device,
+		Country:        a.Country,
+		Region:         a.Region,
+		City:           a.City,
+		ASN:            a.ASN,
+		ASOrg:          a.ASOrg,
+	}
+}
@@ -1,27 +1,296 @@
 package service
 
 import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
 	"math/rand/v2"
+	"strings"
+	"sync"
+
+	"github.com/IPampurin/UrlShortener/pkg/configuration"
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+const (
+	sizeShortUrl = 6  // длина сгенерированной короткой ссылки ShortURL по умолчанию
+	maxShortUrl  = 50 // предельная длина short_url (VARCHAR(50) в таблице links)
+
+	// base62 - алфавит кодов: только латиница и цифры, которые не портят мессенджеры и разбор URL
+	base62 = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+	collisionWindow = 100 // число попыток, по которому оценивается доля коллизий
+)
+
+// стратегии генерации коротких ссылок (SHORT_GENERATOR)
+const (
+	StrategyRandom  = "random"  // случайная строка base62
+	StrategyCounter = "counter" // кодирование очередного links.id в духе Sqids/Hashids
+	StrategyWords   = "words"   // читаемые коды из слов, например BraveOtter
 )
 
-const sizeShortUrl = 6 // длина сгенерированной короткой ссылки ShortURL по умолчанию
+// Code - кандидат в короткие ссылки
+type Code struct {
+	Value  string // короткая ссылка
+	LinkID int    // зарезервированный под неё links.id (0 - идентификатор назначит БД)
+}
+
+// Generator выдаёт кандидатов в короткие ссылки, уникальность кандидата проверяет вызывающий
+type Generator interface {
+	// Generate возвращает кандидата, length - желаемая длина (смысл зависит от стратегии)
+	Generate(ctx context.Context, length int) (Code, error)
+
+	// MaxLength возвращает наибольшую желаемую длину, после которой коды стратегии больше не растут
+	MaxLength() int
+}
+
+// NewGenerator создаёт генератор стратегии из конфигурации
+// (counter-стратегии нужен доступ к последовательности links.id)
+func NewGenerator(cfgGen *configuration.ConfGenerator, link db.LinkMethods) (Generator, error) {
+
+	switch cfgGen.Strategy {
+	case StrategyRandom, "":
+		return randomGenerator{}, nil
+	case StrategyCounter:
+		return newCounterGenerator(link, cfgGen.Salt), nil
+	case StrategyWords:
+		return wordsGenerator{}, nil
+	default:
+		return nil, fmt.Errorf("неизвестная стратегия генерации коротких ссылок: %q", cfgGen.Strategy)
+	}
+}
 
-// NewRandomString возвращает случайную строку указанной длины
+// NewRandomString возвращает случайную строку указанной длины из алфавита base62
 func NewRandomString(size int) string {
 
 	if size == 0 {
 		size = sizeShortUrl
 	}
 
-	chars := []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
-		"abcdefghijklmnopqrstuvwxyz" +
-		"0123456789" +
-		"+-_!")
-
-	b := make([]rune, size)
+	b := make([]byte, size)
 	for i := range b {
-		b[i] = chars[rand.N(len(chars))]
+		b[i] = base62[rand.N(len(base62))]
+	}
+
+	return string(b)
+}
+
+// randomGenerator - случайные коды base62 заданной длины
+type randomGenerator struct{}
+
+// Generate возвращает случайную строку длины length
+func (randomGenerator) Generate(_ context.Context, length int) (Code, error) {
+
+	return Code{Value: NewRandomString(length)}, nil
+}
+
+// MaxLength - коды растут до предельной длины short_url
+func (randomGenerator) MaxLength() int {
+
+	return maxShortUrl
+}
+
+// counterGenerator кодирует очередной links.id в строку base62 фиксированной длины:
+// номер перемешивается обратимым умножением по модулю 62^length, а алфавит - солью,
+// поэтому соседние ссылки не выглядят как последовательные, но коды не повторяются
+type counterGenerator struct {
+	link     db.LinkMethods
+	alphabet string
+	seed     uint64
+}
+
+// maxCounterLength - наибольшая длина, при которой 62^length помещается в uint64
+const maxCounterLength = 10
+
+func newCounterGenerator(link db.LinkMethods, salt string) *counterGenerator {
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(salt))
+	seed := h.Sum64()
+
+	// перемешиваем алфавит детерминированно от соли
+	alphabet := []byte(base62)
+	rnd := rand.New(rand.NewPCG(seed, ^seed))
+	rnd.Shuffle(len(alphabet), func(i, j int) {
+		alphabet[i], alphabet[j] = alphabet[j], alphabet[i]
+	})
+
+	return &counterGenerator{
+		link:     link,
+		alphabet: string(alphabet),
+		seed:     seed,
+	}
+}
+
+// Generate резервирует очередной links.id и возвращает его код
+func (g *counterGenerator) Generate(ctx context.Context, length int) (Code, error) {
+
+	id, err := g.link.NextLinkID(ctx)
+	if err != nil {
+		return Code{}, err
+	}
+
+	return Code{Value: g.encode(uint64(id), length), LinkID: id}, nil
+}
+
+// MaxLength - коды растут до длины, при которой 62^length помещается в uint64
+func (g *counterGenerator) MaxLength() int {
+
+	return maxCounterLength
+}
+
+// encode переводит id в код длины не меньше length (длина растёт, если id не помещается)
+func (g *counterGenerator) encode(id uint64, length int) string {
+
+	length = min(max(length, 1), maxCounterLength)
+
+	space := pow62(length)
+	for id >= space && length < maxCounterLength {
+		length++
+		space = pow62(length)
+	}
+
+	// множитель взаимно прост с 62^length (нечётный и не кратен 31), значит отображение - биекция
+	mult := g.seed%space | 1
+	for mult%31 == 0 {
+		mult += 2
+	}
+	offset := (g.seed >> 32) % space
+
+	x := (mulMod(id%space, mult, space) + offset) % space
+
+	b := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		b[i] = g.alphabet[x%62]
+		x /= 62
 	}
 
 	return string(b)
 }
+
+// pow62 возвращает 62^n
+func pow62(n int) uint64 {
+
+	p := uint64(1)
+	for range n {
+		p *= 62
+	}
+
+	return p
+}
+
+// mulMod возвращает a*b mod m без переполнения
+func mulMod(a, b, m uint64) uint64 {
+
+	hi, lo := bits.Mul64(a, b)
+
+	return bits.Rem64(hi, lo, m)
+}
+
+// wordsGenerator собирает код из слов: одно слово на каждые три символа желаемой длины, но не меньше двух
+// и не больше maxWords, чтобы код из самых длинных слов помещался в short_url
+type wordsGenerator struct{}
+
+// maxWords - наибольшее число слов в коде: прилагательное и существительные самой большой длины
+// укладываются в maxShortUrl символов
+var maxWords = 1 + (maxShortUrl-longest(adjectives))/longest(nouns)
+
+// longest возвращает длину самого длинного слова
+func longest(words []string) int {
+
+	n := 0
+	for _, w := range words {
+		n = max(n, len(w))
+	}
+
+	return n
+}
+
+// Generate возвращает код вида BraveOtter или BraveOtterRiver
+func (wordsGenerator) Generate(_ context.Context, length int) (Code, error) {
+
+	count := min(max((length+2)/3, 2), maxWords)
+
+	var b strings.Builder
+	b.WriteString(adjectives[rand.N(len(adjectives))])
+	for range count - 1 {
+		b.WriteString(nouns[rand.N(len(nouns))])
+	}
+
+	return Code{Value: b.String()}, nil
+}
+
+// MaxLength - желаемая длина, с которой код состоит из maxWords слов
+func (wordsGenerator) MaxLength() int {
+
+	return 3*maxWords - 2
+}
+
+// lengthTuner хранит текущую длину генерируемых кодов и увеличивает её (не больше maxLength),
+// когда доля коллизий за последние collisionWindow попыток превышает порог
+type lengthTuner struct {
+	mu         sync.Mutex
+	length     int
+	maxLength  int
+	threshold  float64
+	attempts   int
+	collisions int
+}
+
+func newLengthTuner(length, maxLength int, threshold float64) *lengthTuner {
+
+	if length <= 0 {
+		length = sizeShortUrl
+	}
+	maxLength = min(maxLength, maxShortUrl)
+
+	return &lengthTuner{
+		length:    min(length, maxLength),
+		maxLength: maxLength,
+		threshold: threshold,
+	}
+}
+
+// Length возвращает текущую длину кодов
+func (t *lengthTuner) Length() int {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.length
+}
+
+// Exhausted сообщает, что длина кодов достигла предела и дальше не растёт
+func (t *lengthTuner) Exhausted() bool {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.length >= t.maxLength
+}
+
+// Record учитывает результат попытки и возвращает true, если длина была увеличена
+func (t *lengthTuner) Record(collided bool) bool {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.attempts++
+	if collided {
+		t.collisions++
+	}
+
+	if t.attempts < collisionWindow {
+		return false
+	}
+
+	grown := false
+	if t.threshold > 0 && float64(t.collisions)/float64(t.attempts) > t.threshold && t.length < t.maxLength {
+		t.length++
+		grown = true
+	}
+	t.attempts, t.collisions = 0, 0
+
+	return grown
+}
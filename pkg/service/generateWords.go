@@ -0,0 +1,22 @@
+package service
+
+// словари для стратегии words (только латиница, без разделителей, чтобы код оставался в base62)
+var (
+	adjectives = []string{
+		"Amber", "Bold", "Brave", "Bright", "Calm", "Clever", "Cosmic", "Crisp",
+		"Daring", "Eager", "Fancy", "Fast", "Fierce", "Gentle", "Giant", "Golden",
+		"Happy", "Honest", "Jolly", "Keen", "Kind", "Lucky", "Lunar", "Mellow",
+		"Mighty", "Misty", "Noble", "Polar", "Proud", "Quick", "Quiet", "Rapid",
+		"Royal", "Rusty", "Shiny", "Silent", "Silver", "Smart", "Solar", "Steady",
+		"Sunny", "Swift", "Tidy", "Vivid", "Warm", "Wild", "Wise", "Witty",
+	}
+
+	nouns = []string{
+		"Badger", "Bear", "Beaver", "Bison", "Cedar", "Comet", "Coral", "Crane",
+		"Delta", "Dune", "Eagle", "Falcon", "Fern", "Fjord", "Fox", "Glacier",
+		"Harbor", "Hawk", "Heron", "Island", "Lake", "Lark", "Lynx", "Maple",
+		"Meadow", "Moose", "Nova", "Oak", "Orbit", "Otter", "Owl", "Panda",
+		"Pebble", "Pine", "Planet", "Raven", "Reef", "River", "Robin", "Sparrow",
+		"Spruce", "Stone", "Storm", "Tiger", "Valley", "Walrus", "Willow", "Wolf",
+	}
+)
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+)
+
+// fakeSequence - последовательность links.id для counter-стратегии
+type fakeSequence struct {
+	db.LinkMethods
+	id int
+}
+
+func (f *fakeSequence) NextLinkID(context.Context) (int, error) {
+
+	f.id++
+
+	return f.id, nil
+}
+
+func TestGeneratorsFitShortURL(t *testing.T) {
+
+	generators := map[string]Generator{
+		StrategyRandom:  randomGenerator{},
+		StrategyCounter: newCounterGenerator(&fakeSequence{}, "соль"),
+		StrategyWords:   wordsGenerator{},
+	}
+
+	for name, g := range generators {
+		t.Run(name, func(t *testing.T) {
+			if g.MaxLength() > maxShortUrl {
+				t.Fatalf("MaxLength() = %d, больше предела short_url %d", g.MaxLength(), maxShortUrl)
+			}
+
+			// длину выше MaxLength генератор не получает: её ограничивает lengthTuner
+			for length := 1; length <= g.MaxLength(); length++ {
+				for range 50 {
+					code, err := g.Generate(context.Background(), length)
+					if err != nil {
+						t.Fatalf("Generate(%d): %v", length, err)
+					}
+					if code.Value == "" || len(code.Value) > maxShortUrl {
+						t.Fatalf("Generate(%d) = %q: длина %d вне (0, %d]", length, code.Value, len(code.Value), maxShortUrl)
+					}
+					if strings.Trim(code.Value, base62) != "" {
+						t.Fatalf("Generate(%d) = %q: символы вне base62", length, code.Value)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRandomGeneratorLength(t *testing.T) {
+
+	for _, length := range []int{1, sizeShortUrl, maxShortUrl} {
+		code, _ := randomGenerator{}.Generate(context.Background(), length)
+		if len(code.Value) != length {
+			t.Errorf("Generate(%d) = %q, ожидалась длина %d", length, code.Value, length)
+		}
+	}
+
+	if got := NewRandomString(0); len(got) != sizeShortUrl {
+		t.Errorf("NewRandomString(0) = %q, ожидалась длина по умолчанию %d", got, sizeShortUrl)
+	}
+}
+
+func TestWordsGeneratorLongestWords(t *testing.T) {
+
+	// код из самого длинного прилагательного и maxWords-1 самых длинных существительных
+	longestCode := longest(adjectives) + (maxWords-1)*longest(nouns)
+	if longestCode > maxShortUrl {
+		t.Fatalf("код из %d слов может занять %d символов, предел %d", maxWords, longestCode, maxShortUrl)
+	}
+	if longestCode+longest(nouns) <= maxShortUrl {
+		t.Errorf("maxWords = %d занижен: поместилось бы ещё одно слово", maxWords)
+	}
+}
+
+func TestCounterEncode(t *testing.T) {
+
+	g := newCounterGenerator(&fakeSequence{}, "соль")
+
+	// в пределах 62^2 коды двухсимвольные и не повторяются
+	seen := make(map[string]uint64)
+	for id := range pow62(2) {
+		code := g.encode(id, 2)
+		if len(code) != 2 {
+			t.Fatalf("encode(%d, 2) = %q, ожидалась длина 2", id, code)
+		}
+		if prev, ok := seen[code]; ok {
+			t.Fatalf("encode(%d, 2) = %q совпал с кодом id %d", id, code, prev)
+		}
+		seen[code] = id
+	}
+
+	// id, не помещающийся в 62^length, удлиняет код
+	if code := g.encode(pow62(2), 2); len(code) != 3 {
+		t.Errorf("encode(62^2, 2) = %q, ожидалась длина 3", code)
+	}
+
+	// длина ограничена maxCounterLength
+	if code := g.encode(1, maxShortUrl); len(code) != maxCounterLength {
+		t.Errorf("encode(1, %d) = %q, ожидалась длина %d", maxShortUrl, code, maxCounterLength)
+	}
+
+	// соль меняет коды
+	other := newCounterGenerator(&fakeSequence{}, "другая соль")
+	if g.encode(42, 6) == other.encode(42, 6) {
+		t.Errorf("коды с разной солью совпали: %q", g.encode(42, 6))
+	}
+}
+
+func TestLengthTuner(t *testing.T) {
+
+	t.Run("по умолчанию и предел short_url", func(t *testing.T) {
+		tuner := newLengthTuner(0, 1000, 0.5)
+		if tuner.Length() != sizeShortUrl {
+			t.Errorf("Length() = %d, ожидалось %d", tuner.Length(), sizeShortUrl)
+		}
+		if tuner.maxLength != maxShortUrl {
+			t.Errorf("maxLength = %d, ожидалось %d", tuner.maxLength, maxShortUrl)
+		}
+	})
+
+	t.Run("начальная длина не больше предела стратегии", func(t *testing.T) {
+		tuner := newLengthTuner(20, maxCounterLength, 0.5)
+		if tuner.Length() != maxCounterLength || !tuner.Exhausted() {
+			t.Errorf("Length() = %d, Exhausted() = %v, ожидалось %d и true", tuner.Length(), tuner.Exhausted(), maxCounterLength)
+		}
+	})
+
+	t.Run("рост при доле коллизий выше порога", func(t *testing.T) {
+		tuner := newLengthTuner(6, 7, 0.5)
+
+		grown := false
+		for i := range collisionWindow {
+			grown = tuner.Record(i%4 != 0) // 75% коллизий
+		}
+		if !grown || tuner.Length() != 7 {
+			t.Fatalf("после окна с 75%% коллизий grown = %v, Length() = %d, ожидалось true и 7", grown, tuner.Length())
+		}
+		if !tuner.Exhausted() {
+			t.Error("длина достигла предела, но Exhausted() = false")
+		}
+
+		// дальше предела длина не растёт
+		for range collisionWindow {
+			if tuner.Record(true) {
+				t.Fatal("длина выросла сверх предела")
+			}
+		}
+		if tuner.Length() != 7 {
+			t.Errorf("Length() = %d, ожидалось 7", tuner.Length())
+		}
+	})
+
+	t.Run("без роста при доле коллизий ниже порога", func(t *testing.T) {
+		tuner := newLengthTuner(6, maxShortUrl, 0.5)
+		for i := range 3 * collisionWindow {
+			if tuner.Record(i%4 == 0) { // 25% коллизий
+				t.Fatal("длина выросла при доле коллизий ниже порога")
+			}
+		}
+		if tuner.Length() != 6 || tuner.Exhausted() {
+			t.Errorf("Length() = %d, Exhausted() = %v, ожидалось 6 и false", tuner.Length(), tuner.Exhausted())
+		}
+	})
+
+	t.Run("нулевой порог отключает рост", func(t *testing.T) {
+		tuner := newLengthTuner(6, maxShortUrl, 0)
+		for range collisionWindow {
+			tuner.Record(true)
+		}
+		if tuner.Length() != 6 {
+			t.Errorf("Length() = %d, ожидалось 6", tuner.Length())
+		}
+	})
+}
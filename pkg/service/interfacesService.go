@@ -3,27 +3,74 @@ package service
 import (
 	"context"
 
+	"github.com/IPampurin/UrlShortener/pkg/cache"
+	"github.com/IPampurin/UrlShortener/pkg/ingest"
 	"github.com/wb-go/wbf/logger"
 )
 
 type ServiceMethods interface {
+	// Authenticate возвращает пользователя, которому принадлежит API-ключ
+	Authenticate(ctx context.Context, log logger.Logger, apiKey string) (*Caller, error)
+
+	// CreateUser создаёт пользователя и выпускает ему API-ключ
+	CreateUser(ctx context.Context, log logger.Logger, name string, isAdmin bool) (*ResponseUser, error)
+
+	// далее методы работают от имени вызывающего из контекста (WithCaller):
+	// списки, поиск и аналитика ограничены его ссылками, чужие ссылки дают ErrLinkForbidden
+
 	// CreateShortLink создаёт новую короткую ссылку
-	CreateShortLink(ctx context.Context, log logger.Logger, originalURL, customShort string) (*ResponseLink, error)
+	CreateShortLink(ctx context.Context, log logger.Logger, originalURL, customShort string, opts CreateOptions) (*ResponseLink, error)
 
-	// ShortLinkInfo возвращает информацию о ссылке по её короткому идентификатору (для редиректа)
+	// ShortLinkInfo возвращает информацию о ссылке по её короткому идентификатору (для редиректа),
+	// для неизвестной ссылки возвращает ErrLinkNotFound, для просроченной - ErrLinkExpired
 	ShortLinkInfo(ctx context.Context, log logger.Logger, shortURL string) (*ResponseLink, error)
 
-	// ShortLinkAnalytics возвращает детальную информацию о ссылке и все переходы по ней
-	ShortLinkAnalytics(ctx context.Context, log logger.Logger, shortURL string) (*ResponseAnalytics, error)
+	// UpdateLink изменяет адрес перенаправления и ограничения ссылки (ErrLinkNotFound, если ссылка не найдена)
+	UpdateLink(ctx context.Context, log logger.Logger, shortURL string, opts UpdateOptions) (*ResponseLink, error)
+
+	// DeleteLink перемещает ссылку в корзину (ErrLinkNotFound, если ссылка не найдена)
+	DeleteLink(ctx context.Context, log logger.Logger, shortURL string) (*ResponseLink, error)
+
+	// RestoreLink восстанавливает ссылку из корзины (ErrTrashLinkNotFound, если в корзине её нет)
+	RestoreLink(ctx context.Context, log logger.Logger, shortURL string) (*ResponseLink, error)
+
+	// DeletedLinks возвращает содержимое корзины
+	DeletedLinks(ctx context.Context, log logger.Logger) ([]*ResponseLink, error)
+
+	// ShortLinkAnalytics возвращает детальную информацию о ссылке, все переходы по ней
+	// и временную шкалу переходов за период из q
+	ShortLinkAnalytics(ctx context.Context, log logger.Logger, shortURL string, q AnalyticsQuery) (*ResponseAnalytics, error)
+
+	// ClickLog возвращает страницу журнала переходов по ссылке с фильтрами из q
+	ClickLog(ctx context.Context, log logger.Logger, shortURL string, q ClickLogQuery) (*ResponseClicks, error)
+
+	// ExportClicks готовит потоковую выгрузку переходов по ссылке в формате q.Format
+	ExportClicks(ctx context.Context, log logger.Logger, shortURL string, q ExportQuery) (*Export, error)
+
+	// ExportAllClicks готовит потоковую выгрузку переходов по всем ссылкам вызывающего
+	ExportAllClicks(ctx context.Context, log logger.Logger, q ExportQuery) (*Export, error)
+
+	// ShortLinkBreakdown возвращает переходы по ссылке, сгруппированные по измерению (браузер, ОС, устройство и т.д.)
+	ShortLinkBreakdown(ctx context.Context, log logger.Logger, shortURL, dimension string, bots bool) (*ResponseBreakdown, error)
 
 	// LastLinks возвращает список последних сокращённых ссылок
 	LastLinks(ctx context.Context, log logger.Logger) ([]*ResponseLink, error)
 
-	// RecordClick сохраняет информацию о переходе по ссылке (после редиректа)
-	RecordClick(ctx context.Context, log logger.Logger, linkID int, userAgent, ip, referer string) error
+	// RecordClick ставит переход по ссылке в очередь на запись (счётчик переходов увеличивается при записи,
+	// переходы ботов в счётчик не попадают)
+	RecordClick(ctx context.Context, log logger.Logger, linkID int, method, userAgent, ip, referer string) error
+
+	// IngestStats возвращает счётчики конвейера записи переходов
+	IngestStats() ingest.Stats
+
+	// WarmCache прогревает кэш ссылками, по которым больше всего переходили за период прогрева
+	WarmCache(ctx context.Context, log logger.Logger) (cache.WarmResult, error)
+
+	// LookupStats возвращает счётчики поиска ссылок при перенаправлении (кэш, негативные записи, БД)
+	LookupStats() LookupStats
 
-	// IncrementClicks увеличивает счётчик переходов по ссылке (вызывается вместе с RecordClick)
-	IncrementClicks(ctx context.Context, log logger.Logger, linkID int64) error
+	// Health возвращает состояние сервиса и его зависимостей
+	Health() ResponseHealth
 
 	// SearchByOriginalURL ищет ссылки, OriginalURL которых содержит подстроку query
 	SearchByOriginalURL(ctx context.Context, log logger.Logger, query string) ([]*ResponseLink, error)
@@ -1,14 +1,61 @@
 package service
 
-import "time"
+import (
+	"time"
+
+	"github.com/IPampurin/UrlShortener/pkg/cache"
+)
+
+// Caller - аутентифицированный пользователь API, от имени которого выполняется запрос
+type Caller struct {
+	UserID  int
+	Name    string
+	IsAdmin bool
+}
+
+// ResponseUser - ответ на создание пользователя (POST /admin/users выход)
+type ResponseUser struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	IsAdmin   bool      `json:"is_admin"`
+	CreatedAt time.Time `json:"created_at"`
+	APIKey    string    `json:"api_key"` // показывается только при создании
+}
+
+// CreateOptions - необязательные параметры создания ссылки (POST /shorten)
+type CreateOptions struct {
+	ExpiresAt *time.Time // момент, после которого ссылка перестаёт работать
+	MaxClicks *int       // допустимое количество переходов
+
+	RedirectType string // способ перенаправления: 301, 302, 307, 308 или interstitial (пусто - 302)
+	PassQuery    bool   // добавлять параметры запроса посетителя к OriginalURL
+}
+
+// UpdateOptions - изменяемые параметры ссылки (PATCH /links/:short_url), nil - поле не меняется
+type UpdateOptions struct {
+	OriginalURL    *string    // новый адрес перенаправления
+	ExpiresAt      *time.Time // новый срок действия
+	MaxClicks      *int       // новый бюджет переходов
+	ResetExpiresAt bool       // снять ограничение по сроку действия
+	ResetMaxClicks bool       // снять ограничение по количеству переходов
+	RedirectType   *string    // новый способ перенаправления
+	PassQuery      *bool      // передавать ли параметры запроса посетителя
+}
 
 // ResponseLink - ответ на успешное создание (POST /shorten выход) или запрос данных (элемент на GET /links выход)
 type ResponseLink struct {
-	ID          int       `json:"-"`
-	ShortURL    string    `json:"short_url"`
-	OriginalURL string    `json:"original_url"`
-	CreatedAt   time.Time `json:"created_at"`
-	ClicksCount int       `json:"clicks_count"`
+	ID          int        `json:"-"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ClicksCount int        `json:"clicks_count"`
+	DedupClicks int        `json:"dedup_clicks_count"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	MaxClicks   *int       `json:"max_clicks,omitempty"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+
+	RedirectType string `json:"redirect_type"`
+	PassQuery    bool   `json:"pass_query"`
 }
 
 // FollowLink - информация об одном переходе (для аналитики)
@@ -17,13 +64,120 @@ type FollowLink struct {
 	UserAgent  string    `json:"user_agent"`
 	IPAddress  string    `json:"ip_address,omitempty"`
 	Referer    string    `json:"referer,omitempty"`
+	IsBot      bool      `json:"is_bot"`
+	IsRepeat   bool      `json:"is_repeat"`
+	Browser    string    `json:"browser,omitempty"`
+	OS         string    `json:"os,omitempty"`
+	Device     string    `json:"device,omitempty"`
+	Country    string    `json:"country,omitempty"`
+	City       string    `json:"city,omitempty"`
+}
+
+// AnalyticsQuery - параметры периода аналитики из запроса (пустые значения - по умолчанию)
+type AnalyticsQuery struct {
+	From        string // начало периода (RFC 3339 или YYYY-MM-DD)
+	To          string // конец периода, не включая (дата YYYY-MM-DD включает весь день)
+	Granularity string // шаг временной шкалы: minute, hour, day, week, month
+	TZ          string // часовой пояс IANA (Europe/Moscow), по умолчанию UTC
+}
+
+// ClickFilterQuery - фильтры переходов из запроса (пустые значения не ограничивают выборку)
+type ClickFilterQuery struct {
+	From    string // переходы не раньше (RFC 3339 или YYYY-MM-DD)
+	To      string // переходы раньше (дата YYYY-MM-DD включает весь день)
+	TZ      string // часовой пояс для дат без времени, по умолчанию UTC
+	Referer string // подстрока Referer
+	Device  string // класс устройства: desktop, mobile, tablet или bot
+	Bot     *bool  // только боты или только люди
+}
+
+// ClickLogQuery - параметры страницы журнала переходов
+type ClickLogQuery struct {
+	ClickFilterQuery
+
+	Cursor string // курсор из next_cursor предыдущей страницы
+	Limit  int    // размер страницы (по умолчанию 50, не больше 500)
+}
+
+// ExportQuery - параметры выгрузки переходов
+type ExportQuery struct {
+	ClickFilterQuery
+
+	Format string // csv (по умолчанию), ndjson или parquet
+}
+
+// ResponseClicks - ответ для GET /analytics/:short_url/clicks
+type ResponseClicks struct {
+	Clicks     []FollowLink `json:"clicks"`
+	NextCursor string       `json:"next_cursor,omitempty"` // пусто - это последняя страница
+}
+
+// TimelinePoint - переходы за один шаг временной шкалы
+type TimelinePoint struct {
+	Start  time.Time `json:"start"`
+	Clicks int       `json:"clicks"`
+}
+
+// ResponsePeriod - период, за который посчитаны агрегаты
+type ResponsePeriod struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Granularity string    `json:"granularity"`
+	TZ          string    `json:"tz"`
+}
+
+// ResponseBreakdown - ответ для GET /analytics/:short_url/:dimension
+type ResponseBreakdown struct {
+	Dimension string         `json:"dimension"`
+	Bots      bool           `json:"bots"`
+	Clicks    map[string]int `json:"clicks"`
 }
 
 // ResponseAnalytics - полный ответ для GET /analytics/:short_url
 type ResponseAnalytics struct {
-	Link              ResponseLink   `json:"link"`
-	Analytics         []FollowLink   `json:"analytics"`
-	ClicksByDay       map[string]int `json:"clicks_by_day,omitempty"`
-	ClicksByMonth     map[string]int `json:"clicks_by_month,omitempty"`
-	ClicksByUserAgent map[string]int `json:"clicks_by_user_agent,omitempty"`
+	Link              ResponseLink    `json:"link"`
+	Analytics         []FollowLink    `json:"analytics"`
+	Period            ResponsePeriod  `json:"period"`
+	Timeline          []TimelinePoint `json:"timeline"`
+	ClicksByDay       map[string]int  `json:"clicks_by_day,omitempty"`
+	ClicksByMonth     map[string]int  `json:"clicks_by_month,omitempty"`
+	ClicksByUserAgent map[string]int  `json:"clicks_by_user_agent,omitempty"`
+	ClicksByBrowser   map[string]int  `json:"clicks_by_browser,omitempty"`
+	ClicksByOS        map[string]int  `json:"clicks_by_os,omitempty"`
+	ClicksByDevice    map[string]int  `json:"clicks_by_device,omitempty"`
+	ClicksByCountry   map[string]int  `json:"clicks_by_country,omitempty"`
+	ClicksByCity      map[string]int  `json:"clicks_by_city,omitempty"`
+	ClicksByReferer   map[string]int  `json:"clicks_by_referer,omitempty"`
+
+	// оценка уникальных посетителей за период (по дням UTC; за свёрнутые дни - точное число из сводок)
+	UniqueVisitors int            `json:"unique_visitors"`
+	UniqueByDay    map[string]int `json:"unique_by_day,omitempty"`
+
+	// разделение трафика: агрегаты выше считаются только по людям, переходы ботов - отдельно
+	HumanClicks          int            `json:"human_clicks"`
+	BotClicks            int            `json:"bot_clicks"`
+	BotClicksByUserAgent map[string]int `json:"bot_clicks_by_user_agent,omitempty"`
+}
+
+// LookupStats - снимок счётчиков поиска ссылок при перенаправлении (GET /admin/lookups)
+type LookupStats struct {
+	Hits      uint64 `json:"hits"`      // ссылка отдана из кэша
+	Negative  uint64 `json:"negative"`  // ответ "не найдена" из негативной записи кэша, без обращения к БД
+	Refreshes uint64 `json:"refreshes"` // запись кэша обновлена из БД до истечения TTL
+	Misses    uint64 `json:"misses"`    // запросов, которым понадобилась БД (включая досрочные обновления)
+	Loads     uint64 `json:"loads"`     // обращений к БД
+	Coalesced uint64 `json:"coalesced"` // запросов, дождавшихся результата чужого обращения к БД
+	NotFound  uint64 `json:"not_found"` // обращений к БД, не нашедших ссылку (сохранены негативные записи)
+}
+
+// состояния сервиса (ResponseHealth.Status)
+const (
+	HealthOK       = "ok"       // все зависимости работают (или выключены в конфигурации)
+	HealthDegraded = "degraded" // Redis недоступен: ссылки читаются из БД, посетители и дедупликация - запасным способом
+)
+
+// ResponseHealth - состояние сервиса (GET /health выход)
+type ResponseHealth struct {
+	Status string       `json:"status"` // ok или degraded
+	Cache  cache.Status `json:"cache"`  // состояние кэша
 }
@@ -2,18 +2,31 @@ package service
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"net"
 	"time"
 
+	"github.com/IPampurin/UrlShortener/pkg/cache"
 	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/IPampurin/UrlShortener/pkg/ingest"
 	"github.com/wb-go/wbf/logger"
 )
 
 // CreateShortLink создаёт новую короткую ссылку
 // (если customShort не пуст, проверяет его уникальность,
-// если оригинальный URL уже существует, возвращает последнюю созданную ссылку,
+// если оригинальный URL уже существует и ограничения не заданы, возвращает последнюю созданную бессрочную ссылку,
 // в противном случае генерирует случайный shortURL и сохраняет ссылку в БД и кэш)
-func (s *Service) CreateShortLink(ctx context.Context, log logger.Logger, originalURL, customUrl string) (*ResponseLink, error) {
+func (s *Service) CreateShortLink(ctx context.Context, log logger.Logger, originalURL, customUrl string, opts CreateOptions) (*ResponseLink, error) {
+
+	if opts.ExpiresAt != nil && !opts.ExpiresAt.After(time.Now()) {
+		return nil, ErrExpiresInPast
+	}
+	if opts.RedirectType == "" {
+		opts.RedirectType = db.RedirectFound
+	}
+	if !validRedirectType(opts.RedirectType) {
+		return nil, ErrInvalidRedirectType
+	}
 
 	// 1. Если задан кастомный short, проверяем уникальность
 	if customUrl != "" {
@@ -22,57 +35,48 @@ func (s *Service) CreateShortLink(ctx context.Context, log logger.Logger, origin
 			return nil, err
 		}
 		if existing != nil {
-			return nil, fmt.Errorf("короткая ссылка уже занята")
+			return nil, ErrShortURLTaken
 		}
 	}
 
 	// 2. Проверяем, есть ли уже такая оригинальная ссылка
-	links, err := s.link.GetLinkByOriginalURL(ctx, originalURL)
-	if err != nil {
-		return nil, err
+	// (ссылки с ограничениями не переиспользуем: у каждой свой срок и бюджет переходов,
+	// переиспользуемая ссылка должна перенаправлять так же, как запрошено)
+	limited := opts.ExpiresAt != nil || opts.MaxClicks != nil
+	key := cache.OriginalKey{
+		OriginalURL:  originalURL,
+		OwnerID:      creatorID(ctx),
+		RedirectType: opts.RedirectType,
+		PassQuery:    opts.PassQuery,
 	}
-	if len(links) > 0 {
-		// выбираем последнюю созданную ссылку
-		latest := links[0]
-		for _, l := range links {
-			if l.CreatedAt.After(latest.CreatedAt) {
-				latest = l
-			}
+	if !limited {
+		latest, err := s.reusableLink(ctx, log, key)
+		if err != nil {
+			return nil, err
 		}
-		if s.cache != nil {
+		if latest != nil {
 			if err := s.cache.SetLink(ctx, latest.ShortURL, latest); err != nil {
 				log.Ctx(ctx).Error("ошибка сохранения в кэш", "error", err)
 			}
-		}
-		log.Ctx(ctx).Info("найдена существующая ссылка", "short_url", latest.ShortURL, "original_url", originalURL)
-
-		return toResponseLink(latest), nil
-	}
+			log.Ctx(ctx).Info("найдена существующая ссылка", "short_url", latest.ShortURL, "original_url", originalURL)
 
-	// 3. Генерируем shortURL, если не задан
-	shortURL := customUrl
-	if shortURL == "" {
-		for {
-			shortURL = NewRandomString(0)
-			existing, err := s.link.GetLinkByShortURL(ctx, shortURL)
-			if err != nil {
-				return nil, err // ошибка БД
-			}
-			if existing == nil {
-				break
-			}
+			return toResponseLink(latest), nil
 		}
 	}
 
-	// 4. Создаём новую ссылку
-	link, err := s.link.CreateLink(ctx, originalURL, shortURL, customUrl != "")
+	// 3. Создаём новую ссылку (shortURL генерируется, если не задан)
+	link, err := s.insertLink(ctx, log, originalURL, customUrl, opts)
 	if err != nil {
 		return nil, err
 	}
+	shortURL := link.ShortURL
 
-	// 5. Сохраняем в кэш
-	if s.cache != nil {
-		if err := s.cache.SetLink(ctx, shortURL, link); err != nil {
+	// 4. Сохраняем в кэш (бессрочная ссылка теперь последняя для своего URL и переиспользуется)
+	if err := s.cache.SetLink(ctx, shortURL, link); err != nil {
+		log.Ctx(ctx).Error("ошибка сохранения в кэш", "error", err)
+	}
+	if !limited {
+		if err := s.cache.SetOriginal(ctx, key, shortURL); err != nil {
 			log.Ctx(ctx).Error("ошибка сохранения в кэш", "error", err)
 		}
 	}
@@ -85,33 +89,192 @@ func (s *Service) CreateShortLink(ctx context.Context, log logger.Logger, origin
 	return toResponseLink(link), nil
 }
 
-// ShortLinkInfo возвращает информацию о ссылке по shortURL
-func (s *Service) ShortLinkInfo(ctx context.Context, log logger.Logger, shortURL string) (*ResponseLink, error) {
+// reusableLink возвращает последнюю созданную бессрочную ссылку на тот же URL с теми же владельцем
+// и параметрами перенаправления (nil - такой нет): сначала по обратному индексу в кэше,
+// затем из БД (найденная в БД ссылка запоминается в индексе)
+func (s *Service) reusableLink(ctx context.Context, log logger.Logger, key cache.OriginalKey) (*db.Link, error) {
 
-	if s.cache != nil {
-		link, err := s.cache.GetLink(ctx, shortURL)
+	shortURL, err := s.cache.GetOriginal(ctx, key)
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка получения из кэша", "error", err)
+	}
+	if shortURL != "" {
+		entry, err := s.cache.GetLink(ctx, shortURL)
 		if err != nil {
 			log.Ctx(ctx).Error("ошибка получения из кэша", "error", err)
 		}
-		if link != nil {
-			log.Ctx(ctx).Debug("ссылка получена из кэша", "short_url", shortURL)
-			return toResponseLink(link), nil
+		link := entry.Link
+		if link == nil && !entry.Missing {
+			if link, err = s.link.GetLinkByShortURL(ctx, shortURL); err != nil {
+				return nil, err
+			}
+		}
+		if reusable(link, key) {
+			log.Ctx(ctx).Debug("ссылка найдена по обратному индексу кэша", "short_url", shortURL)
+			return link, nil
 		}
+		// ссылка изменилась или ушла в корзину после того, как попала в индекс
+		log.Ctx(ctx).Debug("запись обратного индекса устарела", "short_url", shortURL)
 	}
 
-	link, err := s.link.GetLinkByShortURL(ctx, shortURL)
+	links, err := s.link.GetLinkByOriginalURL(ctx, key.OriginalURL, key.OwnerID)
 	if err != nil {
 		return nil, err
 	}
+
+	// выбираем последнюю созданную бессрочную ссылку
+	var latest *db.Link
+	for _, l := range links {
+		if !reusable(l, key) {
+			continue
+		}
+		if latest == nil || l.CreatedAt.After(latest.CreatedAt) {
+			latest = l
+		}
+	}
+
+	switch {
+	case latest != nil && latest.ShortURL != shortURL:
+		err = s.cache.SetOriginal(ctx, key, latest.ShortURL)
+	case latest == nil && shortURL != "":
+		err = s.cache.DeleteOriginal(ctx, key)
+	}
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка сохранения в кэш", "error", err)
+	}
+
+	return latest, nil
+}
+
+// reusable сообщает, можно ли вернуть ссылку вместо новой для оригинального URL с параметрами key
+func reusable(link *db.Link, key cache.OriginalKey) bool {
+
+	switch {
+	case link == nil || link.DeletedAt != nil:
+		return false
+	case link.ExpiresAt != nil || link.MaxClicks != nil:
+		return false
+	case link.OriginalURL != key.OriginalURL || link.RedirectType != key.RedirectType || link.PassQuery != key.PassQuery:
+		return false
+	case key.OwnerID != nil && (link.OwnerID == nil || *link.OwnerID != *key.OwnerID):
+		return false
+	}
+
+	return true
+}
+
+// originalKey - ключ обратного индекса, под которым ссылка переиспользуется
+func originalKey(link *db.Link) cache.OriginalKey {
+
+	return cache.OriginalKey{
+		OriginalURL:  link.OriginalURL,
+		OwnerID:      link.OwnerID,
+		RedirectType: link.RedirectType,
+		PassQuery:    link.PassQuery,
+	}
+}
+
+// insertLink сохраняет ссылку с кастомным или сгенерированным shortURL; уникальность проверяет сама БД:
+// кастомный shortURL, занятый параллельным запросом, - ErrShortURLTaken, а сгенерированный при коллизии
+// подбирается заново не более maxAttempts раз (каждая коллизия учитывается при подстройке длины)
+func (s *Service) insertLink(ctx context.Context, log logger.Logger, originalURL, customUrl string, opts CreateOptions) (*db.Link, error) {
+
+	linkOpts := db.LinkOptions{
+		ExpiresAt: opts.ExpiresAt,
+		MaxClicks: opts.MaxClicks,
+		OwnerID:   creatorID(ctx),
+
+		RedirectType: opts.RedirectType,
+		PassQuery:    opts.PassQuery,
+	}
+
+	if customUrl != "" {
+		link, err := s.link.CreateLink(ctx, originalURL, customUrl, true, linkOpts)
+		if errors.Is(err, db.ErrShortURLExists) {
+			return nil, ErrShortURLTaken
+		}
+		return link, err
+	}
+
+	for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+
+		code, err := s.generator.Generate(ctx, s.length.Length())
+		if err != nil {
+			return nil, err
+		}
+
+		linkOpts.ID = code.LinkID
+		link, err := s.link.CreateLink(ctx, originalURL, code.Value, false, linkOpts)
+		collided := errors.Is(err, db.ErrShortURLExists)
+		if err != nil && !collided {
+			return nil, err // ошибка БД
+		}
+
+		if s.length.Record(collided) {
+			log.Ctx(ctx).Warn("доля коллизий превысила порог, длина коротких ссылок увеличена",
+				"length", s.length.Length())
+		}
+
+		if !collided {
+			return link, nil
+		}
+
+		log.Ctx(ctx).Debug("коллизия короткой ссылки", "short_url", code.Value, "attempt", attempt)
+	}
+
+	// длина больше не растёт: коды стратегии закончились, повторные запросы не помогут
+	if s.length.Exhausted() {
+		log.Ctx(ctx).Error("коды стратегии генерации достигли предельной длины", "length", s.length.Length())
+		return nil, ErrShortURLLimit
+	}
+
+	return nil, ErrShortURLExhausted
+}
+
+// ShortLinkInfo возвращает информацию о ссылке по shortURL
+func (s *Service) ShortLinkInfo(ctx context.Context, log logger.Logger, shortURL string) (*ResponseLink, error) {
+
+	entry, err := s.cache.GetLink(ctx, shortURL)
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка получения из кэша", "error", err)
+	}
+
+	switch {
+	case entry.Missing:
+		s.lookups.negative.Add(1)
+		log.Ctx(ctx).Debug("ссылки нет: негативная запись кэша", "short_url", shortURL)
+		return nil, ErrLinkNotFound
+	case entry.Link != nil && !entry.Refresh:
+		s.lookups.hits.Add(1)
+		if isExpired(entry.Link, time.Now()) {
+			log.Ctx(ctx).Info("ссылка из кэша больше не действует", "short_url", shortURL)
+			return nil, ErrLinkExpired
+		}
+		log.Ctx(ctx).Debug("ссылка получена из кэша", "short_url", shortURL)
+		return toResponseLink(entry.Link), nil
+	case entry.Link != nil:
+		s.lookups.refreshes.Add(1)
+		log.Ctx(ctx).Debug("запись кэша обновляется заранее", "short_url", shortURL)
+	}
+
+	link, err := s.loadLink(ctx, log, shortURL)
+	if err != nil {
+		if entry.Link == nil {
+			return nil, err
+		}
+		// досрочное обновление не удалось, а запись в кэше ещё действует
+		log.Ctx(ctx).Warn("ошибка досрочного обновления ссылки", "error", err, "short_url", shortURL)
+		link = entry.Link
+	}
 	if link == nil {
 		log.Ctx(ctx).Info("ссылка не найдена в БД", "short_url", shortURL)
-		return nil, nil
+		return nil, ErrLinkNotFound
 	}
 
-	if s.cache != nil {
-		if err := s.cache.SetLink(ctx, shortURL, link); err != nil {
-			log.Ctx(ctx).Error("ошибка сохранения в кэш", "error", err)
-		}
+	if isExpired(link, time.Now()) {
+		log.Ctx(ctx).Info("ссылка больше не действует", "short_url", shortURL,
+			"expires_at", link.ExpiresAt, "clicks_count", link.ClicksCount)
+		return nil, ErrLinkExpired
 	}
 
 	log.Ctx(ctx).Debug("ссылка получена из БД", "short_url", shortURL)
@@ -119,48 +282,396 @@ func (s *Service) ShortLinkInfo(ctx context.Context, log logger.Logger, shortURL
 	return toResponseLink(link), nil
 }
 
+// loadLink читает ссылку из БД и обновляет кэш (nil - ссылки нет или она в корзине, тогда в кэш
+// сохраняется негативная запись); одновременные запросы одной ссылки объединяются в одно обращение к БД
+func (s *Service) loadLink(ctx context.Context, log logger.Logger, shortURL string) (*db.Link, error) {
+
+	s.lookups.misses.Add(1)
+
+	result := s.flight.DoChan(shortURL, func() (any, error) {
+
+		// результат ждут и другие запросы, поэтому отмена начавшего обращение его не прерывает
+		ctx := context.WithoutCancel(ctx)
+		s.lookups.loads.Add(1)
+
+		link, err := s.link.GetLinkByShortURL(ctx, shortURL)
+		if err != nil {
+			return nil, err
+		}
+
+		if link == nil || link.DeletedAt != nil {
+			s.lookups.notFound.Add(1)
+			if err := s.cache.SetMissing(ctx, shortURL); err != nil {
+				log.Ctx(ctx).Error("ошибка сохранения негативной записи в кэш", "error", err, "short_url", shortURL)
+			}
+			return nil, nil
+		}
+
+		if !isExpired(link, time.Now()) {
+			if err := s.cache.SetLink(ctx, shortURL, link); err != nil {
+				log.Ctx(ctx).Error("ошибка сохранения в кэш", "error", err)
+			}
+		}
+
+		return link, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		link, _ := res.Val.(*db.Link)
+		return link, nil
+	}
+}
+
+// UpdateLink изменяет ссылку в БД и сбрасывает её версию в кэше,
+// чтобы перенаправление сразу шло по новому адресу
+func (s *Service) UpdateLink(ctx context.Context, log logger.Logger, shortURL string, opts UpdateOptions) (*ResponseLink, error) {
+
+	if opts.OriginalURL == nil && opts.ExpiresAt == nil && opts.MaxClicks == nil &&
+		!opts.ResetExpiresAt && !opts.ResetMaxClicks && opts.RedirectType == nil && opts.PassQuery == nil {
+		return nil, ErrNothingToUpdate
+	}
+	if opts.RedirectType != nil && !validRedirectType(*opts.RedirectType) {
+		return nil, ErrInvalidRedirectType
+	}
+	if opts.ExpiresAt != nil && !opts.ExpiresAt.After(time.Now()) {
+		return nil, ErrExpiresInPast
+	}
+
+	before, err := s.ownedLink(ctx, shortURL, false)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := s.link.UpdateLink(ctx, shortURL, db.LinkUpdate{
+		OriginalURL:    opts.OriginalURL,
+		ExpiresAt:      opts.ExpiresAt,
+		MaxClicks:      opts.MaxClicks,
+		ResetExpiresAt: opts.ResetExpiresAt,
+		ResetMaxClicks: opts.ResetMaxClicks,
+		RedirectType:   opts.RedirectType,
+		PassQuery:      opts.PassQuery,
+	})
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка изменения ссылки", "error", err, "short_url", shortURL)
+		return nil, err
+	}
+	if link == nil {
+		log.Ctx(ctx).Info("ссылка для изменения не найдена", "short_url", shortURL)
+		return nil, ErrLinkNotFound
+	}
+
+	s.invalidateLink(ctx, log, shortURL)
+	s.forgetOriginal(ctx, log, before, link)
+
+	log.Ctx(ctx).Info("ссылка изменена", "short_url", shortURL, "original_url", link.OriginalURL)
+
+	return toResponseLink(link), nil
+}
+
+// DeleteLink перемещает ссылку в корзину и удаляет её из кэша
+func (s *Service) DeleteLink(ctx context.Context, log logger.Logger, shortURL string) (*ResponseLink, error) {
+
+	if _, err := s.ownedLink(ctx, shortURL, false); err != nil {
+		return nil, err
+	}
+
+	link, err := s.link.DeleteLink(ctx, shortURL)
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка удаления ссылки", "error", err, "short_url", shortURL)
+		return nil, err
+	}
+	if link == nil {
+		log.Ctx(ctx).Info("ссылка для удаления не найдена", "short_url", shortURL)
+		return nil, ErrLinkNotFound
+	}
+
+	s.invalidateLink(ctx, log, shortURL)
+	s.forgetOriginal(ctx, log, link)
+
+	log.Ctx(ctx).Info("ссылка перемещена в корзину", "short_url", shortURL)
+
+	return toResponseLink(link), nil
+}
+
+// RestoreLink возвращает ссылку из корзины
+// (в кэш она попадёт при первом переходе, а негативная запись о ней удаляется)
+func (s *Service) RestoreLink(ctx context.Context, log logger.Logger, shortURL string) (*ResponseLink, error) {
+
+	if _, err := s.ownedLink(ctx, shortURL, true); err != nil {
+		return nil, err
+	}
+
+	link, err := s.link.RestoreLink(ctx, shortURL)
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка восстановления ссылки", "error", err, "short_url", shortURL)
+		return nil, err
+	}
+	if link == nil {
+		log.Ctx(ctx).Info("ссылка в корзине не найдена", "short_url", shortURL)
+		return nil, ErrTrashLinkNotFound
+	}
+
+	s.invalidateLink(ctx, log, shortURL)
+	s.forgetOriginal(ctx, log, link)
+
+	log.Ctx(ctx).Info("ссылка восстановлена из корзины", "short_url", shortURL)
+
+	return toResponseLink(link), nil
+}
+
+// DeletedLinks возвращает ссылки, находящиеся в корзине
+func (s *Service) DeletedLinks(ctx context.Context, log logger.Logger) ([]*ResponseLink, error) {
+
+	links, err := s.link.GetDeletedLinks(ctx, ownerFilter(ctx))
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка получения корзины", "error", err)
+		return nil, err
+	}
+
+	result := make([]*ResponseLink, len(links))
+	for i, l := range links {
+		result[i] = toResponseLink(l)
+	}
+
+	log.Ctx(ctx).Info("корзина запрошена", "count", len(result))
+
+	return result, nil
+}
+
+// ownedLink возвращает ссылку, если вызывающий может ею управлять
+// (deleted выбирает, где искать ссылку: в корзине или среди активных)
+func (s *Service) ownedLink(ctx context.Context, shortURL string, deleted bool) (*db.Link, error) {
+
+	link, err := s.link.GetLinkByShortURL(ctx, shortURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case deleted && (link == nil || link.DeletedAt == nil):
+		return nil, ErrTrashLinkNotFound
+	case !deleted && (link == nil || link.DeletedAt != nil):
+		return nil, ErrLinkNotFound
+	}
+
+	if err := checkAccess(ctx, link); err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// invalidateLink удаляет ссылку из кэша (ошибка кэша не фатальна, только логируется)
+func (s *Service) invalidateLink(ctx context.Context, log logger.Logger, shortURL string) {
+
+	if err := s.cache.DeleteLink(ctx, shortURL); err != nil {
+		log.Ctx(ctx).Error("ошибка удаления из кэша", "error", err, "short_url", shortURL)
+	}
+}
+
+// forgetOriginal удаляет ссылки из обратного индекса кэша, чтобы при создании ссылки на тот же URL
+// последняя подходящая ссылка снова выбиралась в БД (ошибка кэша не фатальна, только логируется)
+func (s *Service) forgetOriginal(ctx context.Context, log logger.Logger, links ...*db.Link) {
+
+	for _, link := range links {
+		if err := s.cache.DeleteOriginal(ctx, originalKey(link)); err != nil {
+			log.Ctx(ctx).Error("ошибка удаления из кэша", "error", err, "short_url", link.ShortURL)
+		}
+	}
+}
+
 // ShortLinkAnalytics возвращает аналитику по ссылке: список переходов и агрегированные данные
 // (агрегация на стороне БД за последний месяц (для дней и месяцев) и за всё время (по User-Agent)
-func (s *Service) ShortLinkAnalytics(ctx context.Context, log logger.Logger, shortURL string) (*ResponseAnalytics, error) {
+func (s *Service) ShortLinkAnalytics(ctx context.Context, log logger.Logger, shortURL string, q AnalyticsQuery) (*ResponseAnalytics, error) {
 
-	link, err := s.link.GetLinkByShortURL(ctx, shortURL)
+	rng, err := resolveRange(q, time.Now())
 	if err != nil {
 		return nil, err
 	}
-	if link == nil {
-		log.Ctx(ctx).Info("ссылка не найдена при запросе аналитики", "short_url", shortURL)
-		return nil, nil
+
+	link, err := s.ownedLink(ctx, shortURL, false)
+	if err != nil {
+		log.Ctx(ctx).Info("аналитика по ссылке недоступна", "short_url", shortURL, "error", err)
+		return nil, err
 	}
 
-	// получаем все переходы
-	analytics, err := s.analytics.GetAnalyticsByLinkID(ctx, link.ID)
+	// полный журнал переходов отдаётся постранично через ClickLog, здесь - только последние
+	recent, err := s.analytics.GetClicks(ctx, link.ID, db.ClickFilter{}, 0, recentClicksLimit)
 	if err != nil {
 		return nil, err
 	}
 
-	// получаем агрегаты
-	from := time.Now().AddDate(0, -1, 0) // последний месяц для демонстрации
-	to := time.Now()
+	humanClicks, err := s.analytics.CountClicks(ctx, link.ID, false)
+	if err != nil {
+		return nil, err
+	}
 
-	clicksByDay, err := s.analytics.CountClicksByDay(ctx, link.ID, from, to)
+	botClicks, err := s.analytics.CountClicks(ctx, link.ID, true)
 	if err != nil {
-		log.Ctx(ctx).Error("ошибка агрегации по дням", "error", err)
+		return nil, err
+	}
+
+	// временная шкала и агрегаты по дням и месяцам считаются только по людям,
+	// боты группируются по User-Agent отдельно
+	timeline, err := s.timeline(ctx, link.ID, rng, rng.granularity)
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка построения временной шкалы", "error", err)
 		// не фатально, можно оставить пустым
 	}
 
-	clicksByMonth, err := s.analytics.CountClicksByMonth(ctx, link.ID, from, to)
+	var clicksByDay map[string]int
+	if rng.fitsBuckets(db.GranularityDay) {
+		days, err := s.timeline(ctx, link.ID, rng, db.GranularityDay)
+		if err != nil {
+			log.Ctx(ctx).Error("ошибка агрегации по дням", "error", err)
+			// не фатально, можно оставить пустым
+		}
+		clicksByDay = bucketsMap(days, dateLayout)
+	}
+
+	months, err := s.timeline(ctx, link.ID, rng, db.GranularityMonth)
 	if err != nil {
 		log.Ctx(ctx).Error("ошибка агрегации по месяцам", "error", err)
 		// не фатально, можно оставить пустым
 	}
+	clicksByMonth := bucketsMap(months, "2006-01")
 
-	clicksByUA, err := s.analytics.CountClicksByUserAgent(ctx, link.ID)
+	clicksByUA, err := s.analytics.CountClicksByUserAgent(ctx, link.ID, false)
 	if err != nil {
 		log.Ctx(ctx).Error("ошибка агрегации по user-agent", "error", err)
 		// не фатально, можно оставить пустым
 	}
 
-	// преобразуем записи в формат ответа
+	clicksByBrowser, err := s.analytics.CountClicksByDimension(ctx, link.ID, db.DimensionBrowser, false)
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка агрегации по браузерам", "error", err)
+		// не фатально, можно оставить пустым
+	}
+
+	clicksByOS, err := s.analytics.CountClicksByDimension(ctx, link.ID, db.DimensionOS, false)
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка агрегации по ОС", "error", err)
+		// не фатально, можно оставить пустым
+	}
+
+	clicksByDevice, err := s.analytics.CountClicksByDimension(ctx, link.ID, db.DimensionDevice, false)
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка агрегации по устройствам", "error", err)
+		// не фатально, можно оставить пустым
+	}
+
+	clicksByCountry, err := s.analytics.CountClicksByCountry(ctx, link.ID, false)
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка агрегации по странам", "error", err)
+		// не фатально, можно оставить пустым
+	}
+
+	clicksByCity, err := s.analytics.CountClicksByCity(ctx, link.ID, false)
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка агрегации по городам", "error", err)
+		// не фатально, можно оставить пустым
+	}
+
+	clicksByReferer, err := s.analytics.CountClicksByDimension(ctx, link.ID, db.DimensionReferer, false)
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка агрегации по источникам", "error", err)
+		// не фатально, можно оставить пустым
+	}
+
+	uniqueVisitors, uniqueByDay, err := s.uniqueVisitors(ctx, link.ID, rng)
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка подсчёта уникальных посетителей", "error", err)
+		// не фатально, можно оставить пустым
+	}
+
+	botClicksByUA, err := s.analytics.CountClicksByUserAgent(ctx, link.ID, true)
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка агрегации ботов по user-agent", "error", err)
+		// не фатально, можно оставить пустым
+	}
+
+	log.Ctx(ctx).Info("аналитика по ссылке получена", "short_url", shortURL, "clicks_count", humanClicks+botClicks)
+
+	return &ResponseAnalytics{
+		Link:      *toResponseLink(link),
+		Analytics: toFollowLinks(recent),
+		Period: ResponsePeriod{
+			From:        rng.from.In(rng.loc),
+			To:          rng.to.In(rng.loc),
+			Granularity: rng.granularity,
+			TZ:          rng.tz,
+		},
+		Timeline:          timeline,
+		ClicksByDay:       clicksByDay,
+		ClicksByMonth:     clicksByMonth,
+		ClicksByUserAgent: clicksByUA,
+		ClicksByBrowser:   clicksByBrowser,
+		ClicksByOS:        clicksByOS,
+		ClicksByDevice:    clicksByDevice,
+		ClicksByCountry:   clicksByCountry,
+		ClicksByCity:      clicksByCity,
+		ClicksByReferer:   clicksByReferer,
+
+		UniqueVisitors: uniqueVisitors,
+		UniqueByDay:    uniqueByDay,
+
+		HumanClicks:          humanClicks,
+		BotClicks:            botClicks,
+		BotClicksByUserAgent: botClicksByUA,
+	}, nil
+}
+
+// ClickLog возвращает страницу журнала переходов по ссылке (от новых к старым)
+func (s *Service) ClickLog(ctx context.Context, log logger.Logger, shortURL string, q ClickLogQuery) (*ResponseClicks, error) {
+
+	afterID, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := clickFilter(q.ClickFilterQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultClickLogLimit
+	}
+	limit = min(limit, maxClickLogLimit)
+
+	link, err := s.ownedLink(ctx, shortURL, false)
+	if err != nil {
+		log.Ctx(ctx).Info("журнал переходов недоступен", "short_url", shortURL, "error", err)
+		return nil, err
+	}
+
+	// запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	clicks, err := s.analytics.GetClicks(ctx, link.ID, filter, afterID, limit+1)
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка получения журнала переходов", "short_url", shortURL, "error", err)
+		return nil, err
+	}
+
+	resp := &ResponseClicks{}
+	if len(clicks) > limit {
+		clicks = clicks[:limit]
+		resp.NextCursor = encodeCursor(clicks[limit-1].ID)
+	}
+	resp.Clicks = toFollowLinks(clicks)
+
+	return resp, nil
+}
+
+// toFollowLinks преобразует записи о переходах в формат ответа
+func toFollowLinks(analytics []*db.Analytics) []FollowLink {
+
 	followLinks := make([]FollowLink, len(analytics))
 	for i, a := range analytics {
 		followLinks[i] = FollowLink{
@@ -168,24 +679,129 @@ func (s *Service) ShortLinkAnalytics(ctx context.Context, log logger.Logger, sho
 			UserAgent:  a.UserAgent,
 			IPAddress:  a.IPAddress.String(),
 			Referer:    a.Referer,
+			IsBot:      a.IsBot,
+			IsRepeat:   a.IsRepeat,
+			Browser:    a.Browser,
+			OS:         a.OS,
+			Device:     a.Device,
+			Country:    a.Country,
+			City:       a.City,
+		}
+	}
+
+	return followLinks
+}
+
+// uniqueVisitors оценивает уникальных посетителей за дни (UTC), которые затрагивает период rng:
+// HyperLogLog из Redis плюс посетители, записанные в БД, пока Redis был недоступен
+// (посетитель, попавший в оба хранилища, будет посчитан дважды)
+func (s *Service) uniqueVisitors(ctx context.Context, linkID int, rng *analyticsRange) (int, map[string]int, error) {
+
+	if !rng.fitsBuckets(db.GranularityDay) {
+		return 0, nil, nil
+	}
+
+	first := rng.from.UTC().Truncate(24 * time.Hour)
+	last := rng.to.Add(-time.Nanosecond).UTC().Truncate(24 * time.Hour)
+
+	total, byDay, err := s.visitors.CountVisitors(ctx, linkID, first, last)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// дни без посетителей возвращаются с нулём, как и шаги временной шкалы
+	var days []string
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		key := day.Format(dateLayout)
+		days = append(days, key)
+		if _, ok := byDay[key]; !ok {
+			byDay[key] = 0
 		}
 	}
 
-	log.Ctx(ctx).Info("аналитика по ссылке получена", "short_url", shortURL, "clicks_count", len(analytics))
+	cacheTotal, cacheByDay, err := s.cache.CountVisitors(ctx, linkID, days)
+	switch {
+	case errors.Is(err, cache.ErrUnavailable):
+		// пока Redis недоступен, оценка включает только посетителей из БД и сводок
+	case err != nil:
+		return total, byDay, err
+	}
 
-	return &ResponseAnalytics{
-		Link:              *toResponseLink(link),
-		Analytics:         followLinks,
-		ClicksByDay:       clicksByDay,
-		ClicksByMonth:     clicksByMonth,
-		ClicksByUserAgent: clicksByUA,
+	for day, count := range cacheByDay {
+		byDay[day] += count
+	}
+	total += cacheTotal
+
+	// за свёрнутые дни сводка знает точное число посетителей, оценка по дням заменяется им
+	rolled, err := s.analytics.CountRolledVisitors(ctx, linkID, first, last)
+	if err != nil {
+		return total, byDay, err
+	}
+
+	for day, count := range rolled {
+		byDay[day] = count
+	}
+
+	return total, byDay, nil
+}
+
+// timeline строит временную шкалу переходов людей за период rng с шагом granularity
+func (s *Service) timeline(ctx context.Context, linkID int, rng *analyticsRange, granularity string) ([]TimelinePoint, error) {
+
+	buckets, err := s.analytics.CountClicksByPeriod(ctx, linkID, rng.from, rng.to, granularity, rng.tz, false)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]TimelinePoint, len(buckets))
+	for i, b := range buckets {
+		points[i] = TimelinePoint{Start: b.Start.In(rng.loc), Clicks: b.Clicks}
+	}
+
+	return points, nil
+}
+
+// bucketsMap превращает временную шкалу в карту "начало шага в формате layout" -> переходы
+func bucketsMap(points []TimelinePoint, layout string) map[string]int {
+
+	m := make(map[string]int, len(points))
+	for _, p := range points {
+		m[p.Start.Format(layout)] = p.Clicks
+	}
+
+	return m
+}
+
+// ShortLinkBreakdown возвращает переходы людей (или ботов при bots = true), сгруппированные по измерению
+func (s *Service) ShortLinkBreakdown(ctx context.Context, log logger.Logger, shortURL, dimension string, bots bool) (*ResponseBreakdown, error) {
+
+	if !validDimension(dimension) {
+		return nil, ErrUnknownDimension
+	}
+
+	link, err := s.ownedLink(ctx, shortURL, false)
+	if err != nil {
+		log.Ctx(ctx).Info("аналитика по ссылке недоступна", "short_url", shortURL, "error", err)
+		return nil, err
+	}
+
+	clicks, err := s.analytics.CountClicksByDimension(ctx, link.ID, dimension, bots)
+	if err != nil {
+		log.Ctx(ctx).Error("ошибка агрегации по измерению", "dimension", dimension, "error", err)
+		return nil, err
+	}
+
+	return &ResponseBreakdown{
+		Dimension: dimension,
+		Bots:      bots,
+		Clicks:    clicks,
 	}, nil
 }
 
 // LastLinks возвращает последние ссылки (по умолчанию 20 строк)
 func (s *Service) LastLinks(ctx context.Context, log logger.Logger) ([]*ResponseLink, error) {
 
-	links, err := s.link.GetLinks(ctx)
+	links, err := s.link.GetLinks(ctx, ownerFilter(ctx))
 	if err != nil {
 		log.Ctx(ctx).Error("ошибка получения последних ссылок", "error", err)
 		return nil, err
@@ -201,36 +817,72 @@ func (s *Service) LastLinks(ctx context.Context, log logger.Logger) ([]*Response
 	return result, nil
 }
 
-// RecordClick сохраняет информацию о переходе поссылке
-func (s *Service) RecordClick(ctx context.Context, log logger.Logger, linkID int, userAgent, ip, referer string) error {
+// RecordClick ставит переход по ссылке в очередь конвейера записи
+// (не блокируется: при переполнении очереди переход отбрасывается и учитывается в IngestStats)
+func (s *Service) RecordClick(ctx context.Context, log logger.Logger, linkID int, method, userAgent, ip, referer string) error {
+
+	click := &db.Analytics{
+		LinkID:     linkID,
+		AccessedAt: time.Now(),
+		UserAgent:  userAgent,
+		IPAddress:  net.ParseIP(ip), // если пусто, вернёт nil
+		Referer:    referer,
+		IsBot:      s.bots.IsBot(method, userAgent),
+	}
 
-	err := s.analytics.SaveAnalytics(ctx, linkID, time.Now(), userAgent, ip, referer)
-	if err != nil {
-		log.Ctx(ctx).Error("ошибка сохранения аналитики", "error", err, "link_id", linkID)
-		return err
+	if !s.clicks.Submit(click) {
+		log.Ctx(ctx).Warn("переход отброшен: очередь записи переполнена", "link_id", linkID)
+		return ErrClickDropped
 	}
 
-	log.Ctx(ctx).Debug("переход сохранён", "link_id", linkID, "user_agent", userAgent)
+	log.Ctx(ctx).Debug("переход поставлен в очередь", "link_id", linkID, "user_agent", userAgent, "is_bot", click.IsBot)
 
 	return nil
 }
 
-// IncrementClicks увеличивает счётчик переходов по ссылке на единицу
-func (s *Service) IncrementClicks(ctx context.Context, log logger.Logger, linkID int64) error {
+// IngestStats возвращает счётчики конвейера записи переходов
+func (s *Service) IngestStats() ingest.Stats {
+
+	return s.clicks.Stats()
+}
+
+// Health возвращает состояние сервиса: без Redis он продолжает работать, но в деградированном режиме
+func (s *Service) Health() ResponseHealth {
+
+	health := ResponseHealth{Status: HealthOK, Cache: s.cache.Status()}
+	if health.Cache.State == cache.StateDegraded {
+		health.Status = HealthDegraded
+	}
+
+	return health
+}
+
+// WarmCache прогревает кэш популярными ссылками по запросу администратора
+func (s *Service) WarmCache(ctx context.Context, log logger.Logger) (cache.WarmResult, error) {
 
-	err := s.link.IncrementClicks(ctx, linkID)
+	result, err := s.cache.Warm(ctx)
+	if errors.Is(err, cache.ErrUnavailable) {
+		return result, ErrCacheUnavailable
+	}
 	if err != nil {
-		log.Ctx(ctx).Error("ошибка увеличения счётчика", "error", err, "link_id", linkID)
-		return err
+		return result, err
 	}
 
-	return nil
+	log.Ctx(ctx).Info("кэш прогрет по запросу", "candidates", result.Candidates, "loaded", result.Loaded, "duration", result.Duration)
+
+	return result, nil
+}
+
+// LookupStats возвращает счётчики поиска ссылок при перенаправлении
+func (s *Service) LookupStats() LookupStats {
+
+	return s.lookups.snapshot()
 }
 
 // SearchByOriginalURL ищет ссылки, OriginalURL которых содержит query (регистронезависимо)
 func (s *Service) SearchByOriginalURL(ctx context.Context, log logger.Logger, query string) ([]*ResponseLink, error) {
 
-	links, err := s.link.SearchByOriginalURL(ctx, query)
+	links, err := s.link.SearchByOriginalURL(ctx, query, ownerFilter(ctx))
 	if err != nil {
 		log.Ctx(ctx).Error("ошибка поиска по OriginalURL", "error", err, "query", query)
 		return nil, err
@@ -249,7 +901,7 @@ func (s *Service) SearchByOriginalURL(ctx context.Context, log logger.Logger, qu
 // SearchByShortURL ищет ссылки, ShortURL которых содержит query (регистронезависимо)
 func (s *Service) SearchByShortURL(ctx context.Context, log logger.Logger, query string) ([]*ResponseLink, error) {
 
-	links, err := s.link.SearchByShortURL(ctx, query)
+	links, err := s.link.SearchByShortURL(ctx, query, ownerFilter(ctx))
 	if err != nil {
 		log.Ctx(ctx).Error("ошибка поиска по ShortURL", "error", err, "query", query)
 		return nil, err
@@ -274,5 +926,61 @@ func toResponseLink(l *db.Link) *ResponseLink {
 		OriginalURL: l.OriginalURL,
 		CreatedAt:   l.CreatedAt,
 		ClicksCount: l.ClicksCount,
+		DedupClicks: l.DedupClicksCount,
+		ExpiresAt:   l.ExpiresAt,
+		MaxClicks:   l.MaxClicks,
+		DeletedAt:   l.DeletedAt,
+
+		RedirectType: redirectTypeOf(l),
+		PassQuery:    l.PassQuery,
+	}
+}
+
+// validRedirectType сообщает, поддерживается ли способ перенаправления
+func validRedirectType(redirectType string) bool {
+
+	switch redirectType {
+	case db.RedirectMovedPermanently, db.RedirectFound, db.RedirectTemporary,
+		db.RedirectPermanent, db.RedirectInterstitial:
+		return true
+	}
+
+	return false
+}
+
+// redirectTypeOf возвращает способ перенаправления ссылки
+// (у записей кэша, сохранённых до появления поля, он пустой - считаем его 302)
+func redirectTypeOf(l *db.Link) string {
+
+	if l.RedirectType == "" {
+		return db.RedirectFound
+	}
+
+	return l.RedirectType
+}
+
+// isExpired сообщает, истёк ли срок действия ссылки или исчерпан её бюджет переходов на момент now
+func isExpired(l *db.Link, now time.Time) bool {
+
+	if l.ExpiresAt != nil && !now.Before(*l.ExpiresAt) {
+		return true
+	}
+	if l.MaxClicks != nil && l.ClicksCount >= *l.MaxClicks {
+		return true
 	}
+
+	return false
+}
+
+// validDimension проверяет, что по измерению можно группировать переходы
+func validDimension(dimension string) bool {
+
+	switch dimension {
+	case db.DimensionUserAgent, db.DimensionBrowser, db.DimensionBrowserVersion,
+		db.DimensionOS, db.DimensionOSVersion, db.DimensionDevice,
+		db.DimensionCountry, db.DimensionRegion, db.DimensionCity, db.DimensionASN, db.DimensionReferer:
+		return true
+	}
+
+	return false
 }
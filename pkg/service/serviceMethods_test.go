@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/wb-go/wbf/logger"
+)
+
+// fakeLinks - хранилище ссылок, в котором заняты короткие ссылки из taken
+// (остальные методы LinkMethods тестам не нужны)
+type fakeLinks struct {
+	db.LinkMethods
+	taken   map[string]bool
+	inserts int
+}
+
+func (f *fakeLinks) CreateLink(_ context.Context, originalURL, shortURL string, isCustom bool, opts db.LinkOptions) (*db.Link, error) {
+
+	f.inserts++
+	if f.taken[shortURL] {
+		return nil, db.ErrShortURLExists
+	}
+	f.taken[shortURL] = true
+
+	return &db.Link{ID: opts.ID, ShortURL: shortURL, OriginalURL: originalURL, IsCustom: isCustom}, nil
+}
+
+// sequenceGenerator выдаёт коды по порядку, последний - бесконечно
+type sequenceGenerator struct {
+	codes []string
+	next  int
+}
+
+func (g *sequenceGenerator) Generate(context.Context, int) (Code, error) {
+
+	code := g.codes[min(g.next, len(g.codes)-1)]
+	g.next++
+
+	return Code{Value: code}, nil
+}
+
+func (g *sequenceGenerator) MaxLength() int {
+
+	return maxShortUrl
+}
+
+func testLogger(t *testing.T) logger.Logger {
+
+	t.Helper()
+
+	log, err := logger.InitLogger(logger.SlogEngine, "UrlShortener", "test", logger.WithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("ошибка создания логгера: %v", err)
+	}
+
+	return log
+}
+
+func TestInsertLink(t *testing.T) {
+
+	const maxAttempts = 5
+
+	tests := []struct {
+		name      string
+		taken     []string
+		codes     []string
+		custom    string
+		length    int
+		wantErr   error
+		wantShort string
+		inserts   int
+	}{
+		{"свободный код", nil, []string{"AAAAAA"}, "", 6, nil, "AAAAAA", 1},
+		{"коллизии до свободного кода", []string{"AAAAAA", "BBBBBB"}, []string{"AAAAAA", "BBBBBB", "CCCCCC"}, "", 6, nil, "CCCCCC", 3},
+		{"попытки исчерпаны", []string{"AAAAAA"}, []string{"AAAAAA"}, "", 6, ErrShortURLExhausted, "", maxAttempts},
+		{"длина на пределе", []string{"AAAAAA"}, []string{"AAAAAA"}, "", maxShortUrl, ErrShortURLLimit, "", maxAttempts},
+		{"свободный кастомный код", nil, nil, "my-link", 6, nil, "my-link", 1},
+		{"кастомный код занят параллельно", []string{"my-link"}, nil, "my-link", 6, ErrShortURLTaken, "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			links := &fakeLinks{taken: make(map[string]bool)}
+			for _, short := range tt.taken {
+				links.taken[short] = true
+			}
+
+			s := &Service{
+				link:        links,
+				generator:   &sequenceGenerator{codes: tt.codes},
+				length:      newLengthTuner(tt.length, maxShortUrl, 0),
+				maxAttempts: maxAttempts,
+			}
+
+			link, err := s.insertLink(context.Background(), testLogger(t), "https://example.com", tt.custom, CreateOptions{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("insertLink: ошибка %v, ожидалась %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && link.ShortURL != tt.wantShort {
+				t.Errorf("insertLink: короткая ссылка %q, ожидалась %q", link.ShortURL, tt.wantShort)
+			}
+			if links.inserts != tt.inserts {
+				t.Errorf("insertLink: %d вставок в БД, ожидалось %d", links.inserts, tt.inserts)
+			}
+		})
+	}
+}
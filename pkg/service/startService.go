@@ -2,24 +2,89 @@ package service
 
 import (
 	"context"
+	"sync/atomic"
 
 	"github.com/IPampurin/UrlShortener/pkg/cache"
+	"github.com/IPampurin/UrlShortener/pkg/configuration"
 	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/IPampurin/UrlShortener/pkg/ingest"
+	"golang.org/x/sync/singleflight"
 )
 
 type Service struct {
 	link      db.LinkMethods
 	analytics db.AnalyticsMethods
+	users     db.UserMethods
+	visitors  db.VisitorMethods
 	cache     cache.CacheMethods
+	clicks    ingest.IngestMethods
+
+	generator   Generator    // стратегия генерации коротких ссылок
+	length      *lengthTuner // текущая длина генерируемых ссылок
+	maxAttempts int          // предел попыток подобрать свободную короткую ссылку
+
+	bots *botClassifier // распознавание переходов ботов
+
+	flight  singleflight.Group // объединение одновременных обращений к БД за одной ссылкой
+	lookups lookupCounters     // счётчики поиска ссылок при перенаправлении
+}
+
+// lookupCounters - счётчики поиска ссылок при перенаправлении
+type lookupCounters struct {
+	hits      atomic.Uint64
+	negative  atomic.Uint64
+	refreshes atomic.Uint64
+	misses    atomic.Uint64
+	loads     atomic.Uint64
+	notFound  atomic.Uint64
 }
 
-func InitService(ctx context.Context, storage *db.DataBase, cache *cache.Cache) *Service {
+// snapshot возвращает текущие значения счётчиков
+// (loads читается раньше misses, поэтому объединённых запросов не бывает меньше нуля)
+func (l *lookupCounters) snapshot() LookupStats {
+
+	loads := l.loads.Load()
+	stats := LookupStats{
+		Hits:      l.hits.Load(),
+		Negative:  l.negative.Load(),
+		Refreshes: l.refreshes.Load(),
+		Misses:    l.misses.Load(),
+		Loads:     loads,
+		NotFound:  l.notFound.Load(),
+	}
+	stats.Coalesced = stats.Misses - loads
+
+	return stats
+}
+
+func InitService(ctx context.Context, storage db.Storage, cache cache.CacheMethods, clicks *ingest.Pipeline,
+	cfgGen *configuration.ConfGenerator, cfgBots *configuration.ConfBots) (*Service, error) {
+
+	generator, err := NewGenerator(cfgGen, storage)
+	if err != nil {
+		return nil, err
+	}
 
 	svc := &Service{
-		link:      storage, // *db.DataBase реализует LinkMethods
-		analytics: storage, // *db.DataBase реализует AnalyticsMethods
-		cache:     cache,   // *cache.Cache реализует CacheMethods
+		link:      storage, // db.Storage включает LinkMethods
+		analytics: storage, // db.Storage включает AnalyticsMethods
+		users:     storage, // db.Storage включает UserMethods
+		visitors:  storage, // db.Storage включает VisitorMethods
+		cache:     cache,   // *cache.Cache или cache.Disabled
+		clicks:    clicks,  // *ingest.Pipeline реализует IngestMethods
+
+		generator:   generator,
+		length:      newLengthTuner(cfgGen.Length, generator.MaxLength(), cfgGen.CollisionThreshold),
+		maxAttempts: max(cfgGen.MaxAttempts, 1),
+
+		bots: newBotClassifier(cfgBots),
 	}
 
-	return svc
+	return svc, nil
+}
+
+// Close останавливает фоновые подсистемы сервиса, дожидаясь записи накопленных переходов
+func (s *Service) Close(ctx context.Context) error {
+
+	return s.clicks.Close(ctx)
 }
@@ -0,0 +1,21 @@
+package useragent
+
+// классы устройств
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+// Other - семейство браузера или ОС, которое не удалось распознать
+const Other = "Other"
+
+// Info - результат разбора строки User-Agent
+type Info struct {
+	Browser        string // семейство браузера (Chrome, Firefox, Safari, ...)
+	BrowserVersion string // мажорная версия браузера
+	OS             string // семейство ОС (Windows, Android, iOS, ...)
+	OSVersion      string // версия ОС (не более двух компонент)
+	Device         string // класс устройства: desktop, mobile, tablet или bot
+}
@@ -0,0 +1,183 @@
+package useragent
+
+import (
+	"strings"
+)
+
+// browserRule - признак семейства браузера: токен, за которым следует версия
+type browserRule struct {
+	family string
+	token  string
+}
+
+// browserRules - порядок важен: браузеры на Chromium упоминают Chrome и Safari,
+// а Chrome упоминает Safari, поэтому более специфичные токены проверяются раньше
+var browserRules = []browserRule{
+	{"Edge", "Edg/"},
+	{"Edge", "EdgA/"},
+	{"Edge", "EdgiOS/"},
+	{"Edge", "Edge/"},
+	{"Opera", "OPR/"},
+	{"Opera", "OPiOS/"},
+	{"Yandex Browser", "YaBrowser/"},
+	{"Samsung Internet", "SamsungBrowser/"},
+	{"Vivaldi", "Vivaldi/"},
+	{"Firefox", "Firefox/"},
+	{"Firefox", "FxiOS/"},
+	{"Chrome", "CriOS/"},
+	{"Chrome", "Chrome/"},
+	{"Safari", "Version/"},
+	{"Opera", "Opera/"},
+}
+
+// windowsVersions - соответствие версий ядра Windows NT маркетинговым названиям
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.1":  "XP",
+}
+
+// Parse разбирает строку User-Agent; isBot - результат классификации бота,
+// для ботов класс устройства всегда bot
+func Parse(userAgent string, isBot bool) Info {
+
+	var info Info
+
+	info.Browser, info.BrowserVersion = parseBrowser(userAgent)
+	info.OS, info.OSVersion = parseOS(userAgent)
+	info.Device = parseDevice(userAgent, info.OS)
+
+	if isBot {
+		info.Device = DeviceBot
+	}
+
+	return info
+}
+
+// parseBrowser определяет семейство и мажорную версию браузера
+func parseBrowser(ua string) (string, string) {
+
+	for _, rule := range browserRules {
+		version, ok := versionAfter(ua, rule.token)
+		if !ok {
+			continue
+		}
+		// Version/ без Safari встречается у встроенных WebView и ботов
+		if rule.token == "Version/" && !strings.Contains(ua, "Safari/") {
+			continue
+		}
+		return rule.family, majorVersion(version)
+	}
+
+	// Internet Explorer: MSIE x.y до 11 версии, Trident/7.0; rv:11.0 - 11 версия
+	if version, ok := versionAfter(ua, "MSIE "); ok {
+		return "Internet Explorer", majorVersion(version)
+	}
+	if strings.Contains(ua, "Trident/") {
+		version, _ := versionAfter(ua, "rv:")
+		return "Internet Explorer", majorVersion(version)
+	}
+
+	return Other, ""
+}
+
+// parseOS определяет семейство и версию ОС
+func parseOS(ua string) (string, string) {
+
+	switch {
+	case strings.Contains(ua, "Windows Phone"):
+		version, _ := versionAfter(ua, "Windows Phone ")
+		return "Windows Phone", shortVersion(version)
+
+	case strings.Contains(ua, "Windows"):
+		version, _ := versionAfter(ua, "Windows NT ")
+		if name, ok := windowsVersions[shortVersion(version)]; ok {
+			return "Windows", name
+		}
+		return "Windows", shortVersion(version)
+
+	// iPadOS 13+ по умолчанию представляется как macOS, отличить его по User-Agent нельзя
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad") || strings.Contains(ua, "iPod"):
+		version, ok := versionAfter(ua, "iPhone OS ")
+		if !ok {
+			version, _ = versionAfter(ua, "CPU OS ")
+		}
+		return "iOS", shortVersion(version)
+
+	case strings.Contains(ua, "Android"):
+		version, _ := versionAfter(ua, "Android ")
+		return "Android", shortVersion(version)
+
+	case strings.Contains(ua, "CrOS"):
+		return "Chrome OS", ""
+
+	case strings.Contains(ua, "Mac OS X"):
+		version, _ := versionAfter(ua, "Mac OS X ")
+		return "macOS", shortVersion(version)
+
+	case strings.Contains(ua, "Linux"):
+		return "Linux", ""
+	}
+
+	return Other, ""
+}
+
+// parseDevice определяет класс устройства по платформе и признаку Mobile
+func parseDevice(ua, os string) string {
+
+	switch {
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet"):
+		return DeviceTablet
+
+	// планшеты на Android не добавляют Mobile в User-Agent
+	case os == "Android" && !strings.Contains(ua, "Mobile"):
+		return DeviceTablet
+
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod") ||
+		os == "Android" || os == "Windows Phone":
+		return DeviceMobile
+	}
+
+	return DeviceDesktop
+}
+
+// versionAfter возвращает версию, идущую сразу за token (цифры, точки и подчёркивания)
+func versionAfter(ua, token string) (string, bool) {
+
+	i := strings.Index(ua, token)
+	if i < 0 {
+		return "", false
+	}
+
+	rest := ua[i+len(token):]
+	end := strings.IndexFunc(rest, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '_'
+	})
+	if end >= 0 {
+		rest = rest[:end]
+	}
+
+	return strings.ReplaceAll(rest, "_", "."), true
+}
+
+// majorVersion оставляет только мажорную часть версии (120.0.6099.109 -> 120)
+func majorVersion(version string) string {
+
+	major, _, _ := strings.Cut(version, ".")
+
+	return major
+}
+
+// shortVersion оставляет не более двух компонент версии (10.15.7 -> 10.15)
+func shortVersion(version string) string {
+
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+
+	return strings.Trim(strings.Join(parts, "."), ".")
+}
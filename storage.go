@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IPampurin/UrlShortener/pkg/configuration"
+	"github.com/IPampurin/UrlShortener/pkg/db"
+	"github.com/IPampurin/UrlShortener/pkg/db/memory"
+	"github.com/IPampurin/UrlShortener/pkg/db/sqlite"
+	"github.com/wb-go/wbf/logger"
+)
+
+// хранилища сервиса (значения DB_BACKEND)
+const (
+	backendPostgres = "postgres"
+	backendSQLite   = "sqlite"
+	backendMemory   = "memory"
+)
+
+// initStorage открывает хранилище backend с параметрами из cfgDb
+func initStorage(ctx context.Context, backend string, cfgDb *configuration.ConfDB, log logger.Logger) (db.Storage, error) {
+
+	switch backend {
+	case backendPostgres:
+		return db.InitDB(ctx, cfgDb, log)
+	case backendSQLite:
+		return sqlite.InitSQLite(ctx, cfgDb, log)
+	case backendMemory:
+		return memory.InitMemory(log), nil
+	}
+
+	return nil, fmt.Errorf("неизвестное хранилище %q (допустимо: %s, %s, %s)", backend, backendPostgres, backendSQLite, backendMemory)
+}